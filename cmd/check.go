@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+
+	"github.com/travis-james/system-monitor/pkg/check"
+	"github.com/travis-james/system-monitor/pkg/metrics"
+	"github.com/travis-james/system-monitor/pkg/metrics/host"
+	"github.com/travis-james/system-monitor/pkg/snapshot"
+)
+
+// runCheck measures one metric and prints a Nagios plugin status line,
+// exiting with the plugin exit code of the status. Anything that stops the
+// check from being done, including bad flags, is UNKNOWN.
+func runCheck(args []string) {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	metric := fs.String("metric", "", "metric to check (cpu, disk, memory, process)")
+	field := fs.String("field", "", "field of the metric to check, ex: load1 (default usage, usage_total for cpu, cpu_user for process)")
+	mount := fs.String("mount", "/", "mountpoint to check when -metric is disk")
+	pid := fs.Int("pid", 0, "process to check when -metric is process")
+	match := fs.String("match", "", "regex of the command lines to check when -metric is process")
+	warn := fs.Float64("warn", 0, "value from which the check is WARNING, lower values are worse when -crit is below -warn")
+	crit := fs.Float64("crit", 0, "value from which the check is CRITICAL")
+	seconds := fs.Float64("seconds", 1, "duration to measure the metric over where applicable")
+	if err := fs.Parse(args); err != nil {
+		fs.SetOutput(os.Stderr)
+		fs.PrintDefaults()
+		exitCheck(check.Unknown("check", err))
+	}
+	if *metric == "" || !isFlagSet(fs, "warn") || !isFlagSet(fs, "crit") {
+		exitCheck(check.Unknown("check", errors.New("-metric, -warn and -crit are required")))
+	}
+	if *field == "" {
+		*field = check.DefaultFields[*metric]
+	}
+
+	collector := snapshot.NewCollector(host.Identity{}, []string{*metric}, nil, *seconds)
+	var tags map[string]string
+	switch *metric {
+	case "disk":
+		collector.Disks = []string{*mount}
+		tags = map[string]string{"mountpoint": *mount}
+	case "process":
+		if *pid == 0 && *match == "" {
+			exitCheck(check.Unknown(*metric, errors.New("-pid or -match is required")))
+		}
+		collector.Metrics = []string{"watch"}
+		collector.WatchTarget.Pid = int32(*pid)
+		if *match != "" {
+			re, err := regexp.Compile(*match)
+			if err != nil {
+				exitCheck(check.Unknown(*metric, fmt.Errorf("invalid -match: %v", err)))
+			}
+			collector.WatchTarget.Match = re
+		}
+	}
+	// A partial snapshot may still have the value checked, Evaluate reports
+	// UNKNOWN when it doesn't.
+	snap, err := collector.Collect()
+	if err != nil && !errors.Is(err, metrics.ErrPartial) {
+		exitCheck(check.Unknown(*metric, err))
+	}
+	exitCheck(check.Evaluate(snap.Metrics(), *metric, *field, tags, check.Threshold{Warn: *warn, Crit: *crit}))
+}
+
+// exitCheck prints the result and exits with its status.
+func exitCheck(result check.Result) {
+	fmt.Println(result)
+	os.Exit(int(result.Status))
+}
@@ -1,36 +1,123 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"regexp"
+	"slices"
 	"strings"
+	"syscall"
+	"time"
 
-	"github.com/travis-james/system-monitor/pkg/metrics/cpu"
+	"github.com/travis-james/system-monitor/pkg/metrics/host"
+	"github.com/travis-james/system-monitor/pkg/metrics/netstat"
+	"github.com/travis-james/system-monitor/pkg/metrics/process"
+	"github.com/travis-james/system-monitor/pkg/snapshot"
 )
 
+// RunCLI runs the subcommand named by the first argument, or collects the
+// metrics given by -metric when there is no subcommand.
 func RunCLI() {
-	metricsToCollect := flag.String("metric", "", "metrics to retrieve (cpu, disk)")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "forecast":
+			runForecast(os.Args[2:])
+			return
+		case "diff":
+			runDiff(os.Args[2:])
+			return
+		case "record":
+			runRecord(os.Args[2:])
+			return
+		case "replay":
+			runReplay(os.Args[2:])
+			return
+		case "check":
+			runCheck(os.Args[2:])
+			return
+		case "server":
+			runServer(os.Args[2:])
+			return
+		}
+	}
+
+	metricsToCollect := flag.String("metric", "", "metrics to retrieve (cpu, disk, memory, host, sched, sensors, netstat, vmstat, process, watch, systemd, agent)")
+	disks := flag.String("disk", "", "comma separated disk names to measure when -metric has disk")
 	seconds := flag.Float64("seconds", 5, "Duration to measure metric(s) where applicable")
+	netstatGroup := flag.String("netstat-group", "", "break down socket counts by port or process when -metric has netstat")
+	processGroup := flag.String("process-group", "", "roll up processes by tree, name, user or unit when -metric has process")
+	processTop := flag.Int("process-top", 10, "process groups to show when -metric has process, 0 for all")
+	systemdUnits := flag.String("systemd-unit", "", "comma separated units to measure when -metric has systemd (default every service)")
+	watchPid := flag.Int("pid", 0, "watch the process with this pid (adds watch to -metric)")
+	watchMatch := flag.String("match", "", "watch the processes whose command line matches this regex, following restarts (adds watch to -metric)")
+	interval := flag.Duration("interval", 0, "keep collecting, starting a snapshot this often (0 collects once)")
+	count := flag.Int("count", 0, "snapshots to collect with -interval, 0 for no limit")
+	pipelineFlags := addPipelineFlags(flag.CommandLine)
 	flag.Parse()
 
-	if *metricsToCollect == "" {
-		fmt.Println("no metric was chosen (ex: -metric=cpu,disk)")
-		os.Exit(1)
+	var metrics []string
+	if *metricsToCollect != "" {
+		metrics = strings.Split(*metricsToCollect, ",")
 	}
-
-	metricsType := strings.SplitSeq(*metricsToCollect, ",")
-	for metric := range metricsType {
-		switch metric {
-		case "cpu":
-			cpuMetrics, err := cpu.MeasureCpuMetrics(*seconds)
+	var watchTarget process.Target
+	if *watchPid != 0 || *watchMatch != "" {
+		watchTarget.Pid = int32(*watchPid)
+		if *watchMatch != "" {
+			match, err := regexp.Compile(*watchMatch)
 			if err != nil {
-				fmt.Println("Error measuring CPU:", err)
-			} else {
-				fmt.Printf("CPU Metrics: %s\n", cpuMetrics.String())
+				fmt.Println("invalid -match:", err)
+				os.Exit(1)
 			}
-		default:
-			fmt.Printf("Invalid metric type: %s\n", metric)
+			watchTarget.Match = match
 		}
+		if !slices.Contains(metrics, "watch") {
+			metrics = append(metrics, "watch")
+		}
+	}
+	if len(metrics) == 0 {
+		fmt.Println("no metric was chosen (ex: -metric=cpu,disk)")
+		os.Exit(1)
+	}
+
+	pipeline, err := pipelineFlags.open()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	identity, err := host.LookupIdentity()
+	if err != nil {
+		fmt.Println("Error looking up host identity:", err)
+	}
+	var diskNames []string
+	if *disks != "" {
+		diskNames = strings.Split(*disks, ",")
+	}
+	collector := snapshot.NewCollector(identity, metrics, diskNames, *seconds)
+	collector.NetstatGroupBy = netstat.GroupBy(*netstatGroup)
+	collector.ProcessGroupBy = process.GroupBy(*processGroup)
+	collector.ProcessTop = *processTop
+	collector.WatchTarget = watchTarget
+	if *systemdUnits != "" {
+		collector.SystemdUnits = strings.Split(*systemdUnits, ",")
+	}
+
+	if *interval <= 0 {
+		*count = 1
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	runPipeline(ctx, collector, pipeline, *interval, *count)
+}
+
+// sleep waits for d, returning false if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
 	}
 }
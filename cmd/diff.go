@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/travis-james/system-monitor/pkg/diff"
+	"github.com/travis-james/system-monitor/pkg/snapshot"
+)
+
+// runDiff compares two saved snapshot files, or two time windows of stored
+// history, and prints how every value changed.
+func runDiff(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: diff [flags] BEFORE.json AFTER.json")
+		fmt.Fprintln(fs.Output(), "       diff [flags] -history=PATTERN -before=FROM/TO -after=FROM/TO")
+		fs.PrintDefaults()
+	}
+	history := fs.String("history", "", "glob of NDJSON history files, ex: /var/log/sysmon.ndjson*")
+	beforeWindow := fs.String("before", "", "RFC 3339 FROM/TO window of -history to compare from")
+	afterWindow := fs.String("after", "", "RFC 3339 FROM/TO window of -history to compare to")
+	threshold := fs.Float64("threshold", diff.DefaultThreshold, "percent change from which a delta is significant")
+	significant := fs.Bool("significant", false, "only show significant deltas")
+	format := fs.String("format", "text", "output format (text, json)")
+	fs.Parse(args)
+
+	var before, after []snapshot.Snapshot
+	var err error
+	if *history != "" {
+		before, after, err = readWindows(*history, *beforeWindow, *afterWindow)
+	} else if fs.NArg() == 2 {
+		before, err = snapshot.ReadFiles(fs.Arg(0))
+		if err == nil {
+			after, err = snapshot.ReadFiles(fs.Arg(1))
+		}
+	} else {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	var deltas []diff.Delta
+	for _, d := range diff.Compare(before, after, *threshold) {
+		if d.Significant || !*significant {
+			deltas = append(deltas, d)
+		}
+	}
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(deltas); err != nil {
+			fmt.Println("Error encoding diff:", err)
+			os.Exit(1)
+		}
+	default:
+		if err := diff.WriteTable(os.Stdout, deltas); err != nil {
+			fmt.Println("Error writing diff:", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// readWindows reads the history files matching pattern and returns the
+// snapshots in each window.
+func readWindows(pattern, beforeWindow, afterWindow string) ([]snapshot.Snapshot, []snapshot.Snapshot, error) {
+	snaps, err := snapshot.ReadFiles(pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+	var windows [2][]snapshot.Snapshot
+	for i, window := range []string{beforeWindow, afterWindow} {
+		fromText, toText, ok := strings.Cut(window, "/")
+		from, fromErr := time.Parse(time.RFC3339, fromText)
+		to, toErr := time.Parse(time.RFC3339, toText)
+		if !ok || fromErr != nil || toErr != nil {
+			return nil, nil, fmt.Errorf("invalid window %q, expected FROM/TO in RFC 3339", window)
+		}
+		windows[i] = snapshot.Between(snaps, from, to)
+		if len(windows[i]) == 0 {
+			return nil, nil, fmt.Errorf("no snapshots in %s", window)
+		}
+	}
+	return windows[0], windows[1], nil
+}
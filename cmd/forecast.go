@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/travis-james/system-monitor/pkg/alert"
+	"github.com/travis-james/system-monitor/pkg/forecast"
+	"github.com/travis-james/system-monitor/pkg/metrics/disk"
+)
+
+// forecastOutput is what the forecast command prints with -format=json.
+type forecastOutput struct {
+	Forecasts []forecast.Forecast
+	Alerts    []alert.Alert
+}
+
+// runForecast samples disk usage of each mountpoint and predicts when it will
+// be full, alerting on volumes that will fill within -alert-within.
+func runForecast(args []string) {
+	fs := flag.NewFlagSet("forecast", flag.ExitOnError)
+	mounts := fs.String("mount", "", "comma separated mountpoints to forecast (default all)")
+	samples := fs.Int("samples", 10, "number of usage samples to fit the trend to (at least 3)")
+	seconds := fs.Float64("seconds", 60, "seconds between samples")
+	alertWithin := fs.Duration("alert-within", 24*time.Hour, "alert on volumes predicted to be full within this duration")
+	format := fs.String("format", "text", "output format (text, json)")
+	fs.Parse(args)
+
+	if *samples < 3 || *seconds <= 0 {
+		fmt.Println("-samples must be at least 3 and -seconds greater than zero")
+		os.Exit(1)
+	}
+
+	var mountpoints []string
+	if *mounts != "" {
+		mountpoints = strings.Split(*mounts, ",")
+	} else {
+		deviceMounts, err := disk.RetrieveDeviceMounts()
+		if err != nil {
+			fmt.Println("Error retrieving mountpoints:", err)
+			os.Exit(1)
+		}
+		for _, mountpoint := range deviceMounts {
+			if !slices.Contains(mountpoints, mountpoint) {
+				mountpoints = append(mountpoints, mountpoint)
+			}
+		}
+	}
+
+	forecaster := forecast.NewForecaster(*samples)
+	for i := range *samples {
+		if i > 0 {
+			time.Sleep(time.Duration(*seconds * float64(time.Second)))
+		}
+		now := time.Now()
+		for _, mountpoint := range mountpoints {
+			usage, err := disk.MeasureDiskUsage(mountpoint)
+			if err != nil {
+				fmt.Printf("Error measuring disk usage of %s: %v\n", mountpoint, err)
+				continue
+			}
+			forecaster.Observe(mountpoint, usage, now)
+		}
+	}
+
+	out := forecastOutput{
+		Forecasts: forecaster.Forecasts(),
+		Alerts: alert.Evaluate([]alert.Rule{
+			{Name: "disk-fill", Condition: forecast.FillCondition{Forecaster: forecaster, Within: *alertWithin}},
+		}, time.Now()),
+	}
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			fmt.Println("Error encoding forecast:", err)
+			os.Exit(1)
+		}
+	default:
+		for _, fc := range out.Forecasts {
+			fmt.Println(fc.String())
+		}
+		for _, a := range out.Alerts {
+			fmt.Println(a.String())
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/travis-james/system-monitor/pkg/alert"
+	"github.com/travis-james/system-monitor/pkg/anomaly"
+	"github.com/travis-james/system-monitor/pkg/sink"
+	"github.com/travis-james/system-monitor/pkg/snapshot"
+)
+
+// pipeline is what every snapshot goes through, live or replayed: anomaly
+// detection and alert rules, then the outputs.
+type pipeline struct {
+	dispatcher *sink.Dispatcher
+	detector   *anomaly.Detector // nil when anomaly detection is off.
+	rules      []alert.Rule
+}
+
+// pipelineFlags are the flags of every command that runs a pipeline.
+type pipelineFlags struct {
+	outputs         *outputFlags
+	anomalies       *bool
+	anomalyK        *float64
+	anomalyAlpha    *float64
+	anomalyWarmup   *int
+	anomalySeasonal *bool
+}
+
+// addPipelineFlags defines the pipeline flags on fs.
+func addPipelineFlags(fs *flag.FlagSet) *pipelineFlags {
+	return &pipelineFlags{
+		outputs:         addOutputFlags(fs),
+		anomalies:       fs.Bool("anomaly", false, "flag values that deviate from their learned baseline and alert on them"),
+		anomalyK:        fs.Float64("anomaly-k", 3, "standard deviations from the baseline from which a value is anomalous"),
+		anomalyAlpha:    fs.Float64("anomaly-alpha", 0.1, "weight of each new value in the baseline, between 0 and 1"),
+		anomalyWarmup:   fs.Int("anomaly-warmup", 10, "values to learn a baseline from before flagging anything"),
+		anomalySeasonal: fs.Bool("anomaly-seasonal", false, "learn a separate baseline for each hour of the day"),
+	}
+}
+
+// open builds the pipeline of the parsed flags.
+func (pf *pipelineFlags) open() (pipeline, error) {
+	dispatcher, err := pf.outputs.open()
+	if err != nil {
+		return pipeline{}, err
+	}
+	p := pipeline{dispatcher: dispatcher}
+	if *pf.anomalies {
+		p.detector = anomaly.NewDetector(anomaly.Config{
+			Alpha:    *pf.anomalyAlpha,
+			K:        *pf.anomalyK,
+			Warmup:   *pf.anomalyWarmup,
+			Seasonal: *pf.anomalySeasonal,
+		})
+		p.rules = append(p.rules, alert.Rule{Name: "anomaly", Condition: anomaly.Condition{Detector: p.detector}})
+	}
+	return p, nil
+}
+
+// write scores snap for anomalies, prints the alerts that fire and sends
+// snap to the outputs.
+func (p pipeline) write(snap snapshot.Snapshot) {
+	if p.detector != nil {
+		snap.Anomalies = p.detector.Observe(snap)
+	}
+	for _, a := range alert.Evaluate(p.rules, snap.TimeStamp) {
+		fmt.Fprintln(os.Stderr, a.String())
+	}
+	p.dispatcher.Write(snap)
+}
+
+// runPipeline writes snapshots from source through p, starting one every
+// interval, until count were written (0 for no limit), source runs out or
+// ctx is done. A snapshot that runs past the next start is followed right
+// away, one that overruns whole intervals skips their starts, counted in the
+// agent metric. It then closes the outputs, reporting
+// the ones that dropped snapshots or failed.
+func runPipeline(ctx context.Context, source snapshot.Source, p pipeline, interval time.Duration, count int) {
+	var (
+		next    = time.Now()
+		skipped uint64
+	)
+	for n := 1; count <= 0 || n <= count; n++ {
+		snap, err := source.Collect()
+		if errors.Is(err, io.EOF) || ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			fmt.Println(err)
+		}
+		if snap.Agent != nil {
+			snap.Agent.SkippedIntervals = skipped
+		}
+		p.write(snap)
+		if n == count || interval <= 0 {
+			continue
+		}
+		next = next.Add(interval)
+		if late := time.Since(next); late >= interval {
+			missed := late / interval
+			skipped += uint64(missed)
+			next = next.Add(missed * interval)
+		}
+		if !sleep(ctx, time.Until(next)) {
+			break
+		}
+	}
+	if err := p.dispatcher.Close(); err != nil {
+		fmt.Println(err)
+	}
+	for _, stats := range p.dispatcher.Stats() {
+		if stats.Dropped > 0 || stats.Errors > 0 {
+			fmt.Fprintf(os.Stderr, "output %s: %d written, %d dropped, %d errors, last error: %s\n", stats.Name, stats.Written, stats.Dropped, stats.Errors, stats.LastError)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/travis-james/system-monitor/pkg/metrics/host"
+	"github.com/travis-james/system-monitor/pkg/report"
+	"github.com/travis-james/system-monitor/pkg/snapshot"
+)
+
+// runRecord runs the command after -- while collecting snapshots every
+// -interval, then writes a report of them and exits with the command's exit
+// code.
+func runRecord(args []string) {
+	fs := flag.NewFlagSet("record", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: record [flags] -- command [args...]")
+		fs.PrintDefaults()
+	}
+	metricsToCollect := fs.String("metric", "cpu,memory", "metrics to record (cpu, disk, memory, sched, sensors, netstat, vmstat, process, systemd)")
+	disks := fs.String("disk", "", "comma separated disk names to measure when -metric has disk")
+	interval := fs.Duration("interval", time.Second, "time between snapshots")
+	format := fs.String("format", "text", "report format (text, json)")
+	reportPath := fs.String("report", "", "file to write the report to (default stderr)")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 || *interval <= 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	identity, err := host.LookupIdentity()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error looking up host identity:", err)
+	}
+	var diskNames []string
+	if *disks != "" {
+		diskNames = strings.Split(*disks, ",")
+	}
+	collector := snapshot.NewCollector(identity, strings.Split(*metricsToCollect, ","), diskNames, interval.Seconds())
+
+	child := exec.Command(fs.Arg(0), fs.Args()[1:]...)
+	child.Stdin, child.Stdout, child.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := child.Start(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error starting command:", err)
+		os.Exit(127)
+	}
+	// Pass signals on to the command so it decides when the recording ends.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for sig := range signals {
+			child.Process.Signal(sig)
+		}
+	}()
+	exited := make(chan error, 1)
+	go func() { exited <- child.Wait() }()
+
+	snaps, waitErr := record(collector, *interval, exited)
+	signal.Stop(signals)
+
+	if err := writeReport(report.Summarize(snaps), *format, *reportPath); err != nil {
+		fmt.Fprintln(os.Stderr, "Error writing report:", err)
+	}
+	os.Exit(exitCode(waitErr))
+}
+
+// record collects a snapshot every interval until exited receives the
+// command's exit error. Collectors like cpu take interval to measure, so
+// the next snapshot starts as soon as they are done.
+func record(collector *snapshot.Collector, interval time.Duration, exited <-chan error) ([]snapshot.Snapshot, error) {
+	var snaps []snapshot.Snapshot
+	for {
+		start := time.Now()
+		snap, err := collector.Collect()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		snaps = append(snaps, snap)
+		select {
+		case err := <-exited:
+			return snaps, err
+		case <-time.After(interval - time.Since(start)):
+		}
+	}
+}
+
+func writeReport(r report.Report, format, path string) error {
+	var w io.Writer = os.Stderr
+	if path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+	return report.WriteTable(w, r)
+}
+
+// exitCode is the exit code of a command that finished with err, using the
+// shell's 128+signal for commands killed by a signal.
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		if err != nil {
+			return 1
+		}
+		return 0
+	}
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return exitErr.ExitCode()
+}
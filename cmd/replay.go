@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/travis-james/system-monitor/pkg/sink"
+	"github.com/travis-james/system-monitor/pkg/snapshot"
+)
+
+// runReplay feeds recorded snapshots through the same pipeline as live
+// collection, ex: to try out alert rules, exporters and dashboards without
+// an incident.
+func runReplay(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: replay [flags] HISTORY...")
+		fmt.Fprintln(fs.Output(), "HISTORY is a JSON snapshot or NDJSON history file, or a glob of them, .gz files are gunzipped.")
+		fs.PrintDefaults()
+	}
+	speed := fs.Float64("speed", 1, "replay speed, 1 is real time, 10 ten times faster, 0 as fast as possible")
+	retime := fs.Bool("retime", false, "stamp snapshots with the time they are replayed, as if they were live")
+	pipelineFlags := addPipelineFlags(fs)
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	snaps, err := snapshot.ReadFiles(fs.Args()...)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	// As fast as possible overruns any queue, so wait on slow outputs rather
+	// than drop snapshots unless asked to.
+	if *speed <= 0 && !isFlagSet(fs, "queue-policy") {
+		*pipelineFlags.outputs.queuePolicy = string(sink.PolicyBlock)
+	}
+	pipeline, err := pipelineFlags.open()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	replayer := snapshot.NewReplayer(ctx, snaps)
+	replayer.Speed, replayer.Retime = *speed, *retime
+	runPipeline(ctx, replayer, pipeline, 0, 0)
+}
+
+// isFlagSet reports whether the flag called name was passed to fs.
+func isFlagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/travis-james/system-monitor/pkg/server"
+)
+
+// runServer accepts snapshots pushed by agents (ex: -output=http:URL/api/v1/snapshots)
+// and serves fleet queries over them.
+func runServer(args []string) {
+	fs := flag.NewFlagSet("server", flag.ExitOnError)
+	listen := fs.String("listen", ":8080", "address to listen on")
+	history := fs.Int("history", server.DefaultHistory, "snapshots to keep per host")
+	staleAfter := fs.Duration("stale", server.DefaultStaleAfter, "report hosts that haven't pushed for this long as stale")
+	forgetAfter := fs.Duration("forget", server.DefaultForgetAfter, "drop hosts that haven't pushed for this long")
+	fs.Parse(args)
+
+	srv := &http.Server{
+		Addr:              *listen,
+		Handler:           server.New(server.Config{History: *history, StaleAfter: *staleAfter, ForgetAfter: *forgetAfter}).Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+	fmt.Fprintln(os.Stderr, "listening on", *listen)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
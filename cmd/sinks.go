@@ -0,0 +1,193 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/travis-james/system-monitor/pkg/sink"
+)
+
+// outputFlags are the flags of every command that writes snapshots to
+// outputs.
+type outputFlags struct {
+	outputs        *string
+	format         *string
+	queueSize      *int
+	queuePolicy    *string
+	rotateFormat   *string
+	rotateSize     *int64
+	rotateAge      *time.Duration
+	rotateKeep     *int
+	rotateCompress *bool
+	pushBatch      *int
+	pushSpool      *string
+	pushSpoolSize  *int64
+	influxPrefix   *string
+	influxTags     *string
+	influxBatch    *int
+	graphitePrefix *string
+	graphiteTags   *string
+	graphiteBatch  *int
+}
+
+// addOutputFlags defines the output flags on fs.
+func addOutputFlags(fs *flag.FlagSet) *outputFlags {
+	return &outputFlags{
+		outputs:        fs.String("output", "stdout", "comma separated outputs: stdout, file:PATH, rotate:PATH, http:URL, push:URL, influx:URL, graphite:ADDR, otlp:URL, otlp-grpc:URL, statsd:ADDR, dogstatsd:ADDR"),
+		format:         fs.String("format", "text", "output format of stdout and file outputs (text, json)"),
+		queueSize:      fs.Int("queue-size", sink.DefaultQueueSize, "snapshots buffered for each output"),
+		queuePolicy:    fs.String("queue-policy", string(sink.PolicyDrop), "what to do when an output's queue is full (drop, block)"),
+		rotateFormat:   fs.String("rotate-format", sink.FormatJSON, "output format of rotate outputs (json, csv)"),
+		rotateSize:     fs.Int64("rotate-size", 100<<20, "rotate outputs once they reach this many bytes, 0 for no limit"),
+		rotateAge:      fs.Duration("rotate-age", 24*time.Hour, "rotate outputs once they are this old, 0 for no limit"),
+		rotateKeep:     fs.Int("rotate-keep", 7, "rotated files to keep, 0 keeps them all"),
+		rotateCompress: fs.Bool("rotate-compress", true, "gzip rotated files"),
+		pushBatch:      fs.Int("push-batch", sink.DefaultPushBatchSize, "snapshots per batch of push outputs"),
+		pushSpool:      fs.String("push-spool", "", "directory push outputs queue unsent batches in to backfill later, empty drops them"),
+		pushSpoolSize:  fs.Int64("push-spool-size", sink.DefaultMaxSpoolSize, "bytes of batches the push spool holds before dropping the oldest"),
+		influxPrefix:   fs.String("influx-prefix", "", "prepended to the measurements of influx outputs, ex: sysmon_"),
+		influxTags:     fs.String("influx-tags", "", "comma separated key=value tags added to every line of influx outputs"),
+		influxBatch:    fs.Int("influx-batch", 1, "snapshots per write of influx outputs"),
+		graphitePrefix: fs.String("graphite-prefix", "", "prepended to the metric paths of graphite outputs, ex: sysmon"),
+		graphiteTags:   fs.String("graphite-tags", "", "comma separated key=value tags added to every line of graphite outputs"),
+		graphiteBatch:  fs.Int("graphite-batch", 1, "snapshots per send of graphite outputs"),
+	}
+}
+
+// open builds the Dispatcher of the parsed flags and reopens its files on
+// SIGHUP.
+func (of *outputFlags) open() (*sink.Dispatcher, error) {
+	influxTags, err := parseTags(*of.influxTags)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -influx-tags: %w", err)
+	}
+	graphiteTags, err := parseTags(*of.graphiteTags)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -graphite-tags: %w", err)
+	}
+	dispatcher, reopeners, err := newDispatcher(*of.outputs, outputOptions{
+		format:   *of.format,
+		queue:    sink.QueueConfig{Size: *of.queueSize, Policy: sink.Policy(*of.queuePolicy)},
+		rotate:   sink.RotateConfig{Format: *of.rotateFormat, MaxSize: *of.rotateSize, MaxAge: *of.rotateAge, MaxFiles: *of.rotateKeep, Compress: *of.rotateCompress},
+		push:     sink.PushConfig{BatchSize: *of.pushBatch, SpoolDir: *of.pushSpool, MaxSpoolSize: *of.pushSpoolSize, Backoff: sink.DefaultBackoff},
+		influx:   sink.InfluxConfig{Prefix: *of.influxPrefix, Tags: influxTags, BatchSize: *of.influxBatch, Backoff: sink.DefaultBackoff},
+		graphite: sink.GraphiteConfig{Prefix: *of.graphitePrefix, Tags: graphiteTags, BatchSize: *of.graphiteBatch, Backoff: sink.DefaultBackoff},
+	})
+	if err != nil {
+		return nil, err
+	}
+	go reopenOnHangup(reopeners)
+	return dispatcher, nil
+}
+
+// outputOptions configures the outputs built by newDispatcher.
+type outputOptions struct {
+	format   string // Format of stdout and file outputs.
+	queue    sink.QueueConfig
+	rotate   sink.RotateConfig   // Path is set per rotate output.
+	push     sink.PushConfig     // URL is set per push output.
+	influx   sink.InfluxConfig   // URL and Token are set per influx output.
+	graphite sink.GraphiteConfig // Address is set per graphite output.
+}
+
+// parseTags parses comma separated key=value pairs, ex: env=prod,dc=eu.
+func parseTags(s string) (map[string]string, error) {
+	if s == "" {
+		return nil, nil
+	}
+	tags := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("expected key=value, got %q", pair)
+		}
+		tags[key] = value
+	}
+	return tags, nil
+}
+
+// newDispatcher builds a Dispatcher from a comma separated list of outputs,
+// each either stdout or kind:target, ex: stdout,rotate:/var/log/sysmon.ndjson.
+// It also returns the outputs that should be reopened on SIGHUP.
+func newDispatcher(outputs string, opts outputOptions) (*sink.Dispatcher, []sink.Reopener, error) {
+	dispatcher := sink.NewDispatcher()
+	var reopeners []sink.Reopener
+	for _, output := range strings.Split(outputs, ",") {
+		s, err := newSink(output, opts)
+		if err == nil {
+			err = dispatcher.Add(output, s, opts.queue)
+		}
+		if err != nil {
+			dispatcher.Close()
+			return nil, nil, fmt.Errorf("output %s: %w", output, err)
+		}
+		if r, ok := s.(sink.Reopener); ok {
+			reopeners = append(reopeners, r)
+		}
+	}
+	return dispatcher, reopeners, nil
+}
+
+// newSink returns the sink for one output of newDispatcher.
+func newSink(output string, opts outputOptions) (sink.Sink, error) {
+	if output == "stdout" {
+		return sink.NewWriterSink(os.Stdout, opts.format)
+	}
+	kind, target, ok := strings.Cut(output, ":")
+	if !ok || target == "" {
+		return nil, fmt.Errorf("expected stdout or kind:target")
+	}
+	switch kind {
+	case "file":
+		return sink.NewFileSink(target, opts.format)
+	case "rotate":
+		cfg := opts.rotate
+		cfg.Path = target
+		return sink.NewRotatingFileSink(cfg)
+	case "http":
+		return sink.NewHTTPSink(sink.HTTPConfig{URL: target, Backoff: sink.DefaultBackoff}), nil
+	case "push":
+		cfg := opts.push
+		cfg.URL = target
+		return sink.NewPushSink(cfg)
+	case "influx":
+		cfg := opts.influx
+		cfg.URL, cfg.Token = target, os.Getenv("INFLUX_TOKEN")
+		return sink.NewInfluxSink(cfg), nil
+	case "graphite":
+		cfg := opts.graphite
+		cfg.Address = target
+		return sink.NewGraphiteSink(cfg), nil
+	case "otlp":
+		return sink.NewOTLPSink(sink.OTLPConfig{Endpoint: target, Backoff: sink.DefaultBackoff})
+	case "otlp-grpc":
+		return sink.NewOTLPSink(sink.OTLPConfig{Endpoint: target, Protocol: sink.OTLPProtocolGRPC, Backoff: sink.DefaultBackoff})
+	case "statsd":
+		return sink.NewStatsDSink(sink.StatsDConfig{Address: target})
+	case "dogstatsd":
+		return sink.NewStatsDSink(sink.StatsDConfig{Address: target, DogStatsD: true})
+	}
+	return nil, fmt.Errorf("unknown output kind: %s", kind)
+}
+
+// reopenOnHangup reopens the output files every time the process gets a
+// SIGHUP, ex: from logrotate's postrotate.
+func reopenOnHangup(reopeners []sink.Reopener) {
+	if len(reopeners) == 0 {
+		return
+	}
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	for range hangup {
+		for _, r := range reopeners {
+			if err := r.Reopen(); err != nil {
+				fmt.Println("Error reopening output:", err)
+			}
+		}
+	}
+}
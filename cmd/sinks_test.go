@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/travis-james/system-monitor/pkg/metrics/memory"
+	"github.com/travis-james/system-monitor/pkg/snapshot"
+)
+
+func mockSnapshot() snapshot.Snapshot {
+	return snapshot.Snapshot{
+		Labels:    map[string]string{"host": "web-01"},
+		TimeStamp: time.Unix(1700000000, 0),
+		Memory:    &memory.MemoryMetric{UsedMemory: 1024},
+	}
+}
+
+// parseOutputFlags returns the output flags parsed from args.
+func parseOutputFlags(t *testing.T, args ...string) *outputFlags {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	of := addOutputFlags(fs)
+	require.Nil(t, fs.Parse(args))
+	return of
+}
+
+func TestParseTags(t *testing.T) {
+	t.Parallel()
+	got, err := parseTags("env=prod,dc=eu")
+	require.Nil(t, err)
+	assert.Equal(t, map[string]string{"env": "prod", "dc": "eu"}, got)
+
+	got, err = parseTags("")
+	require.Nil(t, err)
+	assert.Nil(t, got)
+
+	_, err = parseTags("env")
+	assert.NotNil(t, err)
+}
+
+func TestOutputFlags_Influx(t *testing.T) {
+	t.Parallel()
+	var (
+		mu     sync.Mutex
+		bodies []string
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	of := parseOutputFlags(t, "-output=influx:"+ts.URL, "-influx-prefix=sysmon_", "-influx-tags=env=prod", "-influx-batch=2")
+	dispatcher, err := of.open()
+	require.Nil(t, err)
+	dispatcher.Write(mockSnapshot())
+	dispatcher.Write(mockSnapshot())
+	require.Nil(t, dispatcher.Close())
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, bodies, 1, "both snapshots should be written in one batch")
+	assert.Contains(t, bodies[0], "sysmon_memory,env=prod,host=web-01 ")
+}
+
+func TestOutputFlags_Graphite(t *testing.T) {
+	t.Parallel()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer ln.Close()
+	lines := make(chan string, 100)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	of := parseOutputFlags(t, "-output=graphite:"+ln.Addr().String(), "-graphite-prefix=sysmon", "-graphite-tags=env=prod")
+	dispatcher, err := of.open()
+	require.Nil(t, err)
+	dispatcher.Write(mockSnapshot())
+	require.Nil(t, dispatcher.Close())
+
+	select {
+	case line := <-lines:
+		assert.True(t, strings.HasPrefix(line, "sysmon.memory."), line)
+		assert.Contains(t, line, ";env=prod")
+	case <-time.After(2 * time.Second):
+		t.Fatal("no line was sent")
+	}
+}
+
+func TestOutputFlags_InvalidTags(t *testing.T) {
+	t.Parallel()
+	of := parseOutputFlags(t, "-influx-tags=env")
+	_, err := of.open()
+	assert.ErrorContains(t, err, "-influx-tags")
+}
@@ -0,0 +1,42 @@
+package alert
+
+import (
+	"fmt"
+	"time"
+)
+
+// Condition is checked by a Rule to decide if it should fire. Firing returns
+// one message for everything currently in alert (ex: one per mountpoint), or
+// nothing when all is well.
+type Condition interface {
+	Firing() []string
+}
+
+// Rule names a Condition so the alerts it raises can be told apart.
+type Rule struct {
+	Name      string
+	Condition Condition
+}
+
+// Alert is a single firing of a Rule.
+type Alert struct {
+	Rule      string
+	Message   string
+	TimeStamp time.Time
+}
+
+// Evaluate checks every rule and returns the alerts that fired, in rule order.
+func Evaluate(rules []Rule, now time.Time) []Alert {
+	var alerts []Alert
+	for _, rule := range rules {
+		for _, msg := range rule.Condition.Firing() {
+			alerts = append(alerts, Alert{Rule: rule.Name, Message: msg, TimeStamp: now})
+		}
+	}
+	return alerts
+}
+
+// String returns a string representation of Alert.
+func (a Alert) String() string {
+	return fmt.Sprintf("ALERT %s: %s", a.Rule, a.Message)
+}
@@ -0,0 +1,33 @@
+package alert
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockCondition []string
+
+func (mc mockCondition) Firing() []string { return mc }
+
+func TestEvaluate(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	rules := []Rule{
+		{Name: "quiet", Condition: mockCondition(nil)},
+		{Name: "loud", Condition: mockCondition{"a", "b"}},
+	}
+	got := Evaluate(rules, now)
+	expected := []Alert{
+		{Rule: "loud", Message: "a", TimeStamp: now},
+		{Rule: "loud", Message: "b", TimeStamp: now},
+	}
+	assert.Equal(t, expected, got)
+}
+
+func TestString(t *testing.T) {
+	t.Parallel()
+	a := Alert{Rule: "disk-fill", Message: "/ is full"}
+	assert.Equal(t, "ALERT disk-fill: / is full", a.String())
+}
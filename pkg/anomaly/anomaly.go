@@ -0,0 +1,136 @@
+package anomaly
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+
+	"github.com/travis-james/system-monitor/pkg/snapshot"
+)
+
+// DefaultSeries are the series a Detector watches when Config.Series is
+// empty: CPU usage, load, memory and disk throughput.
+var DefaultSeries = []string{
+	"cpu.usage", "cpu.load1", "cpu.load5", "cpu.load15",
+	"memory.used", "memory.available",
+	"disk.read_bytes", "disk.write_bytes", "disk.iops",
+}
+
+// Config configures a Detector.
+type Config struct {
+	Series   []string // measurement.field of the series to watch, defaults to DefaultSeries.
+	Alpha    float64  // Weight of each new value in the EWMA baseline, defaults to 0.1.
+	K        float64  // Standard deviations from the mean from which a value is anomalous, defaults to 3.
+	Warmup   int      // Values a baseline learns from before it can flag anything, defaults to 10.
+	Seasonal bool     // Learn a separate baseline for each hour of the day.
+}
+
+// baseline is the exponentially weighted mean and variance of a series.
+type baseline struct {
+	mean     float64
+	variance float64
+	count    int
+}
+
+// stddev is floored at 1% of the mean so a series that has been flat
+// doesn't flag every tiny change as infinitely far from its baseline.
+func (b *baseline) stddev() float64 {
+	return max(math.Sqrt(b.variance), 0.01*math.Abs(b.mean), 1e-9)
+}
+
+// observe adds x to the baseline, see Finch, "Incremental calculation of
+// weighted mean and variance".
+func (b *baseline) observe(x, alpha float64) {
+	b.count++
+	if b.count == 1 {
+		b.mean = x
+		return
+	}
+	diff := x - b.mean
+	incr := alpha * diff
+	b.mean += incr
+	b.variance = (1 - alpha) * (b.variance + diff*incr)
+}
+
+// Detector learns a baseline for every watched series and scores each new
+// value by how many standard deviations it is from the baseline.
+type Detector struct {
+	cfg       Config
+	mu        sync.Mutex
+	baselines map[string]*baseline
+	latest    []snapshot.Anomaly
+}
+
+// NewDetector returns a Detector with no baselines learnt yet.
+func NewDetector(cfg Config) *Detector {
+	if len(cfg.Series) == 0 {
+		cfg.Series = DefaultSeries
+	}
+	if cfg.Alpha <= 0 || cfg.Alpha > 1 {
+		cfg.Alpha = 0.1
+	}
+	if cfg.K <= 0 {
+		cfg.K = 3
+	}
+	if cfg.Warmup <= 0 {
+		cfg.Warmup = 10
+	}
+	return &Detector{cfg: cfg, baselines: make(map[string]*baseline)}
+}
+
+// Observe scores every watched value of snap against its baseline, then
+// adds the values to their baselines. It returns the anomalous values,
+// those at least K standard deviations from the mean.
+func (d *Detector) Observe(snap snapshot.Snapshot) []snapshot.Anomaly {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var anomalies []snapshot.Anomaly
+	for _, sample := range snap.Metrics() {
+		if !slices.Contains(d.cfg.Series, sample.Measurement+"."+sample.Field) {
+			continue
+		}
+		key := sample.Name()
+		if d.cfg.Seasonal {
+			key += fmt.Sprintf("@%02d", sample.TimeStamp.Hour())
+		}
+		b, ok := d.baselines[key]
+		if !ok {
+			b = &baseline{}
+			d.baselines[key] = b
+		}
+		if b.count >= d.cfg.Warmup {
+			score := (sample.Value - b.mean) / b.stddev()
+			if math.Abs(score) >= d.cfg.K {
+				anomalies = append(anomalies, snapshot.Anomaly{
+					Measurement: sample.Measurement,
+					Field:       sample.Field,
+					Tags:        sample.Tags,
+					Value:       sample.Value,
+					Mean:        b.mean,
+					Stddev:      b.stddev(),
+					Score:       score,
+				})
+			}
+		}
+		b.observe(sample.Value, d.cfg.Alpha)
+	}
+	d.latest = anomalies
+	return anomalies
+}
+
+// Condition fires for every anomaly found by the last Observe of Detector.
+type Condition struct {
+	Detector *Detector
+}
+
+// Firing returns a message per anomalous value.
+func (c Condition) Firing() []string {
+	c.Detector.mu.Lock()
+	defer c.Detector.mu.Unlock()
+	var msgs []string
+	for _, a := range c.Detector.latest {
+		msgs = append(msgs, a.String())
+	}
+	return msgs
+}
@@ -0,0 +1,98 @@
+package anomaly
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/travis-james/system-monitor/pkg/alert"
+	"github.com/travis-james/system-monitor/pkg/metrics/cpu"
+	"github.com/travis-james/system-monitor/pkg/metrics/memory"
+	"github.com/travis-james/system-monitor/pkg/snapshot"
+)
+
+func mockSnapshot(at time.Time, usage float64) snapshot.Snapshot {
+	return snapshot.Snapshot{
+		Labels:    map[string]string{"host": "web-01"},
+		TimeStamp: at,
+		Cpu:       &cpu.CpuMetric{Usage: []float64{usage}, NumberOfCores: 1, LoadAvg1: 1},
+		Memory:    &memory.MemoryMetric{UsedMemory: 100, AvailableMemory: 900},
+	}
+}
+
+// learn feeds the detector a snapshot a minute from start for each usage.
+func learn(d *Detector, start time.Time, usage ...float64) []snapshot.Anomaly {
+	var anomalies []snapshot.Anomaly
+	for i, u := range usage {
+		anomalies = append(anomalies, d.Observe(mockSnapshot(start.Add(time.Duration(i)*time.Minute), u))...)
+	}
+	return anomalies
+}
+
+func TestDetector(t *testing.T) {
+	t.Parallel()
+	d := NewDetector(Config{})
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	normal := []float64{20, 22, 19, 21, 20, 23, 18, 20, 22, 21, 19, 20, 21, 22, 20}
+	assert.Empty(t, learn(d, start, normal...))
+
+	got := d.Observe(mockSnapshot(start.Add(time.Hour), 60))
+	require.Len(t, got, 1)
+	assert.Equal(t, "cpu", got[0].Measurement)
+	assert.Equal(t, "usage", got[0].Field)
+	assert.Equal(t, map[string]string{"core": "0"}, got[0].Tags)
+	assert.Equal(t, 60.0, got[0].Value)
+	assert.InDelta(t, 20.5, got[0].Mean, 1)
+	assert.Greater(t, got[0].Score, 3.0)
+
+	d = NewDetector(Config{})
+	learn(d, start, normal...)
+	got = d.Observe(mockSnapshot(start.Add(time.Hour), 0))
+	require.Len(t, got, 1)
+	assert.Less(t, got[0].Score, -3.0, "drops should score negative")
+}
+
+func TestDetector_Warmup(t *testing.T) {
+	t.Parallel()
+	d := NewDetector(Config{Warmup: 3})
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	assert.Empty(t, learn(d, start, 20, 90, 5), "nothing should be flagged while warming up")
+	assert.NotEmpty(t, learn(d, start, 500))
+}
+
+func TestDetector_Seasonal(t *testing.T) {
+	t.Parallel()
+	night := time.Date(2024, 1, 1, 2, 0, 0, 0, time.UTC)
+	day := time.Date(2024, 1, 1, 14, 0, 0, 0, time.UTC)
+	busyNights := []float64{80, 82, 79, 81, 80, 83, 78, 80, 82, 81}
+	quietDays := []float64{20, 22, 19, 21, 20, 23, 18, 20, 22, 21}
+
+	seasonal := NewDetector(Config{Seasonal: true})
+	assert.Empty(t, learn(seasonal, night, busyNights...))
+	assert.Empty(t, learn(seasonal, day, quietDays...))
+	assert.Empty(t, seasonal.Observe(mockSnapshot(night.Add(24*time.Hour), 81)), "a busy night is normal at night")
+	assert.NotEmpty(t, seasonal.Observe(mockSnapshot(day.Add(24*time.Hour), 81)), "but not during the day")
+
+	flat := NewDetector(Config{Seasonal: false})
+	learn(flat, night, busyNights...)
+	learn(flat, day, quietDays...)
+	assert.Empty(t, flat.Observe(mockSnapshot(day.Add(24*time.Hour), 81)), "without seasonality the baseline covers both")
+}
+
+func TestCondition(t *testing.T) {
+	t.Parallel()
+	d := NewDetector(Config{Series: []string{"cpu.usage"}, Warmup: 2, K: 2})
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	learn(d, start, 10, 10, 10)
+	rules := []alert.Rule{{Name: "anomaly", Condition: Condition{Detector: d}}}
+	assert.Empty(t, alert.Evaluate(rules, start))
+
+	d.Observe(mockSnapshot(start, 50))
+	alerts := alert.Evaluate(rules, start)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "cpu.usage{core=0} is 50.00, +400.0 sigma from its baseline of 10.00±0.10", alerts[0].Message)
+
+	d.Observe(mockSnapshot(start, 10))
+	assert.Empty(t, alert.Evaluate(rules, start), "alerts should clear once the value is back to normal")
+}
@@ -0,0 +1,205 @@
+package check
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/travis-james/system-monitor/pkg/snapshot"
+)
+
+// Status is the state of a check, numbered as the Nagios plugin exit codes.
+type Status int
+
+const (
+	StatusOK Status = iota
+	StatusWarning
+	StatusCritical
+	StatusUnknown
+)
+
+// String returns the plugin name of the status, ex: WARNING.
+func (s Status) String() string {
+	switch s {
+	case StatusOK:
+		return "OK"
+	case StatusWarning:
+		return "WARNING"
+	case StatusCritical:
+		return "CRITICAL"
+	}
+	return "UNKNOWN"
+}
+
+// DefaultFields is the field checked for a measurement when none is given.
+var DefaultFields = map[string]string{
+	"cpu":     "usage_total",
+	"disk":    "usage",
+	"memory":  "usage",
+	"process": "cpu_user",
+}
+
+// Threshold decides the status of a value. Values at or above Warn are
+// WARNING and at or above Crit are CRITICAL. When Crit is below Warn lower
+// values are worse instead, ex: Warn 20 and Crit 10 for memory.available.
+type Threshold struct {
+	Warn float64
+	Crit float64
+}
+
+// Status returns the status of v.
+func (t Threshold) Status(v float64) Status {
+	if t.Crit < t.Warn {
+		v, t = -v, Threshold{Warn: -t.Warn, Crit: -t.Crit}
+	}
+	switch {
+	case v >= t.Crit:
+		return StatusCritical
+	case v >= t.Warn:
+		return StatusWarning
+	}
+	return StatusOK
+}
+
+// worse reports whether a is further into the thresholds than b.
+func (t Threshold) worse(a, b float64) bool {
+	if t.Crit < t.Warn {
+		return a < b
+	}
+	return a > b
+}
+
+// Perfdata is one value of the performance data after the plugin output, ex:
+// 'disk.usage[mountpoint:/]'=85.2%;80;90
+type Perfdata struct {
+	Label string
+	Value float64
+	UOM   string // Unit of measurement, ex: %.
+	Warn  float64
+	Crit  float64
+}
+
+// String returns the perfdata in the plugin format.
+func (p Perfdata) String() string {
+	return fmt.Sprintf("'%s'=%s%s;%s;%s", p.Label, formatFloat(p.Value), p.UOM, formatFloat(p.Warn), formatFloat(p.Crit))
+}
+
+// Result is the outcome of a check.
+type Result struct {
+	Service  string // ex: DISK.
+	Status   Status
+	Message  string
+	Perfdata []Perfdata
+}
+
+// String returns the single line of plugin output, ex:
+//
+//	DISK WARNING - disk.usage{mountpoint=/} is 85.20 (warn 80, crit 90) | 'disk.usage[mountpoint:/]'=85.2%;80;90
+func (r Result) String() string {
+	line := fmt.Sprintf("%s %s - %s", r.Service, r.Status, r.Message)
+	if len(r.Perfdata) == 0 {
+		return line
+	}
+	perfdata := make([]string, len(r.Perfdata))
+	for i, p := range r.Perfdata {
+		perfdata[i] = p.String()
+	}
+	return line + " | " + strings.Join(perfdata, " ")
+}
+
+// Unknown returns the result of a check that couldn't be done, ex: because
+// the metric failed to be collected. Joined errors are kept on one line.
+func Unknown(measurement string, err error) Result {
+	msg := strings.ReplaceAll(err.Error(), "\n", "; ")
+	return Result{Service: strings.ToUpper(measurement), Status: StatusUnknown, Message: msg}
+}
+
+// Evaluate checks the samples of measurement.field with all of tags against
+// t. The status is the worst of the samples, so ex: any core over the
+// thresholds fails a check of cpu.usage. No matching samples is UNKNOWN.
+func Evaluate(samples []snapshot.Sample, measurement, field string, tags map[string]string, t Threshold) Result {
+	result := Result{Service: strings.ToUpper(measurement)}
+	var matched, failing []snapshot.Sample
+	for _, s := range samples {
+		if s.Measurement != measurement || s.Field != field || !hasTags(s, tags) {
+			continue
+		}
+		matched = append(matched, s)
+		status := t.Status(s.Value)
+		result.Status = max(result.Status, status)
+		if status != StatusOK {
+			failing = append(failing, s)
+		}
+		result.Perfdata = append(result.Perfdata, Perfdata{
+			Label: perfdataLabel(s),
+			Value: s.Value,
+			UOM:   unit(field),
+			Warn:  t.Warn,
+			Crit:  t.Crit,
+		})
+	}
+	if len(matched) == 0 {
+		name := snapshot.Sample{Measurement: measurement, Field: field, Tags: tags}.Name()
+		return Result{Service: result.Service, Status: StatusUnknown, Message: "no value for " + name}
+	}
+	thresholds := fmt.Sprintf("(warn %s, crit %s)", formatFloat(t.Warn), formatFloat(t.Crit))
+	if len(failing) > 0 {
+		var values []string
+		for _, s := range failing {
+			values = append(values, fmt.Sprintf("%s is %.2f", s.Name(), s.Value))
+		}
+		result.Message = strings.Join(values, ", ") + " " + thresholds
+		return result
+	}
+	worst := matched[0]
+	for _, s := range matched[1:] {
+		if t.worse(s.Value, worst.Value) {
+			worst = s
+		}
+	}
+	result.Message = fmt.Sprintf("%s is %.2f %s", worst.Name(), worst.Value, thresholds)
+	return result
+}
+
+// hasTags reports whether s has every one of tags.
+func hasTags(s snapshot.Sample, tags map[string]string) bool {
+	for k, v := range tags {
+		if s.Tags[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// perfdataLabel names s like Sample.Name, with brackets and colons since
+// labels can't have equals signs.
+func perfdataLabel(s snapshot.Sample) string {
+	label := s.Measurement + "." + s.Field
+	if len(s.Tags) == 0 {
+		return label
+	}
+	var tags []string
+	for _, k := range slices.Sorted(maps.Keys(s.Tags)) {
+		tags = append(tags, k+":"+strings.ReplaceAll(s.Tags[k], "'", ""))
+	}
+	return label + "[" + strings.Join(tags, ",") + "]"
+}
+
+// unit returns the unit of measurement of a field, % for percentages and
+// none for the rest.
+func unit(field string) string {
+	switch field {
+	case "usage", "usage_total", "inodes_usage", "cpu_user", "cpu_system":
+		return "%"
+	}
+	return ""
+}
+
+// formatFloat formats f to at most two decimals, ex: 80 rather than
+// 80.000000 and 17.75 rather than 17.751129.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(math.Round(f*100)/100, 'f', -1, 64)
+}
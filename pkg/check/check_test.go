@@ -0,0 +1,103 @@
+package check
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/travis-james/system-monitor/pkg/metrics/cpu"
+	"github.com/travis-james/system-monitor/pkg/metrics/disk"
+	"github.com/travis-james/system-monitor/pkg/metrics/memory"
+	"github.com/travis-james/system-monitor/pkg/snapshot"
+)
+
+func mockSamples() []snapshot.Sample {
+	return snapshot.Snapshot{
+		Labels: map[string]string{"host": "web-01"},
+		Cpu:    &cpu.CpuMetric{Usage: []float64{10, 95}, NumberOfCores: 2},
+		Disks: map[string]disk.DiskMetric{
+			"/":     {Device: "/dev/sda1", Mountpoint: "/", DiskUsage: disk.DiskUsage{Usage: 85.5}},
+			"/data": {Device: "/dev/sdb1", Mountpoint: "/data", DiskUsage: disk.DiskUsage{Usage: 20}},
+		},
+		Memory: &memory.MemoryMetric{AvailableMemory: 512, UsedPercent: 40},
+	}.Metrics()
+}
+
+func TestThresholdStatus(t *testing.T) {
+	t.Parallel()
+	higher := Threshold{Warn: 80, Crit: 90}
+	assert.Equal(t, StatusOK, higher.Status(79.9))
+	assert.Equal(t, StatusWarning, higher.Status(80))
+	assert.Equal(t, StatusCritical, higher.Status(95))
+
+	lower := Threshold{Warn: 20, Crit: 10}
+	assert.Equal(t, StatusOK, lower.Status(50))
+	assert.Equal(t, StatusWarning, lower.Status(15))
+	assert.Equal(t, StatusCritical, lower.Status(10))
+}
+
+func TestEvaluate(t *testing.T) {
+	t.Parallel()
+	got := Evaluate(mockSamples(), "disk", "usage", map[string]string{"mountpoint": "/"}, Threshold{Warn: 80, Crit: 90})
+	assert.Equal(t, StatusWarning, got.Status)
+	assert.Equal(t, "DISK WARNING - disk.usage{device=/dev/sda1,mountpoint=/} is 85.50 (warn 80, crit 90)"+
+		" | 'disk.usage[device:/dev/sda1,mountpoint:/]'=85.5%;80;90", got.String())
+
+	got = Evaluate(mockSamples(), "disk", "usage", map[string]string{"mountpoint": "/data"}, Threshold{Warn: 80, Crit: 90})
+	assert.Equal(t, StatusOK, got.Status)
+
+	got = Evaluate(mockSamples(), "memory", "usage", nil, Threshold{Warn: 80, Crit: 90})
+	assert.Equal(t, "MEMORY OK - memory.usage is 40.00 (warn 80, crit 90) | 'memory.usage'=40%;80;90", got.String())
+
+	got = Evaluate(mockSamples(), "memory", "available", nil, Threshold{Warn: 1024, Crit: 256})
+	assert.Equal(t, StatusWarning, got.Status, "lower values should be worse when crit is below warn")
+}
+
+func TestEvaluate_Worst(t *testing.T) {
+	t.Parallel()
+	got := Evaluate(mockSamples(), "cpu", "usage", nil, Threshold{Warn: 80, Crit: 90})
+	assert.Equal(t, StatusCritical, got.Status, "any core over the thresholds should fail the check")
+	assert.Equal(t, "cpu.usage{core=1} is 95.00 (warn 80, crit 90)", got.Message)
+	assert.Len(t, got.Perfdata, 2)
+
+	got = Evaluate(mockSamples(), "cpu", "usage", nil, Threshold{Warn: 98, Crit: 99})
+	assert.Equal(t, StatusOK, got.Status)
+	assert.Equal(t, "cpu.usage{core=1} is 95.00 (warn 98, crit 99)", got.Message, "the worst value should be shown")
+}
+
+func TestEvaluate_CpuDefault(t *testing.T) {
+	t.Parallel()
+	got := Evaluate(mockSamples(), "cpu", DefaultFields["cpu"], nil, Threshold{Warn: 80, Crit: 90})
+	assert.Equal(t, StatusOK, got.Status, "one busy core shouldn't fail the host")
+	assert.Equal(t, "CPU OK - cpu.usage_total is 52.50 (warn 80, crit 90) | 'cpu.usage_total'=52.5%;80;90", got.String())
+}
+
+func TestEvaluate_Partial(t *testing.T) {
+	t.Parallel()
+	samples := snapshot.Snapshot{
+		Cpu: &cpu.CpuMetric{Usage: []float64{10}, NumberOfCores: 1, NoLoadAvg: true},
+		Disks: map[string]disk.DiskMetric{
+			"/": {Device: "/dev/sda1", Mountpoint: "/", DiskUsage: disk.DiskUsage{Usage: 85.5}},
+		},
+	}.Metrics()
+	got := Evaluate(samples, "cpu", "load1", nil, Threshold{Warn: 4, Crit: 8})
+	assert.Equal(t, "CPU UNKNOWN - no value for cpu.load1", got.String())
+	got = Evaluate(samples, "disk", "iops", nil, Threshold{Warn: 100, Crit: 200})
+	assert.Equal(t, StatusUnknown, got.Status)
+	got = Evaluate(samples, "disk", "usage", nil, Threshold{Warn: 80, Crit: 90})
+	assert.Equal(t, StatusWarning, got.Status, "what was measured should still be checked")
+}
+
+func TestEvaluate_Unknown(t *testing.T) {
+	t.Parallel()
+	got := Evaluate(mockSamples(), "disk", "usage", map[string]string{"mountpoint": "/missing"}, Threshold{Warn: 80, Crit: 90})
+	assert.Equal(t, StatusUnknown, got.Status)
+	assert.Equal(t, "DISK UNKNOWN - no value for disk.usage{mountpoint=/missing}", got.String())
+
+	got = Unknown("cpu", errors.New("error measuring CPU: mock error"))
+	assert.Equal(t, "CPU UNKNOWN - error measuring CPU: mock error", got.String())
+	assert.Equal(t, 3, int(got.Status))
+
+	got = Unknown("disk", errors.Join(errors.New("first"), errors.New("second")))
+	assert.Equal(t, "first; second", got.Message)
+}
@@ -0,0 +1,115 @@
+package diff
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"text/tabwriter"
+
+	"github.com/travis-james/system-monitor/pkg/snapshot"
+)
+
+// DefaultThreshold is the percent change from which a Delta is significant.
+const DefaultThreshold = 10.0
+
+// Delta is how one value changed between two sets of snapshots. Before and
+// After are averages when a set has more than one snapshot.
+type Delta struct {
+	Measurement string            // ex: cpu, disk, memory.
+	Field       string            // ex: usage, load1.
+	Tags        map[string]string `json:",omitempty"` // ex: core, device, mountpoint, the snapshot labels are left out.
+	Before      float64
+	After       float64
+	Change      float64 // After - Before.
+	Percent     float64 // Change relative to Before, 0 when Before is 0.
+	Significant bool    // |Percent| is at least the threshold, or Before is 0 and After isn't.
+}
+
+// Compare returns a Delta for every value found in both before and after,
+// in the order the values first appear in before. A delta is significant
+// when it moved by at least threshold percent.
+func Compare(before, after []snapshot.Snapshot, threshold float64) []Delta {
+	beforeAvg, order := averages(before)
+	afterAvg, _ := averages(after)
+	var deltas []Delta
+	for _, key := range order {
+		a, ok := afterAvg[key]
+		if !ok {
+			continue
+		}
+		b := beforeAvg[key]
+		d := Delta{
+			Measurement: b.sample.Measurement,
+			Field:       b.sample.Field,
+			Tags:        b.sample.Tags,
+			Before:      b.mean(),
+			After:       a.mean(),
+		}
+		d.Change = d.After - d.Before
+		if d.Before != 0 {
+			d.Percent = d.Change / math.Abs(d.Before) * 100
+			d.Significant = math.Abs(d.Percent) >= threshold
+		} else {
+			d.Significant = d.After != 0
+		}
+		deltas = append(deltas, d)
+	}
+	return deltas
+}
+
+// average accumulates the values of one series.
+type average struct {
+	sample snapshot.Sample // The first sample of the series.
+	sum    float64
+	count  int
+}
+
+func (a average) mean() float64 {
+	return a.sum / float64(a.count)
+}
+
+// averages averages every series across snaps. The snapshot labels are
+// left out of the series so snapshots of the same host compare even if ex:
+// the kernel changed.
+func averages(snaps []snapshot.Snapshot) (map[string]average, []string) {
+	avgs := make(map[string]average)
+	var order []string
+	for _, snap := range snaps {
+		for _, sample := range snap.Metrics() {
+			key := sample.Name()
+			avg, ok := avgs[key]
+			if !ok {
+				avg.sample = sample
+				order = append(order, key)
+			}
+			avg.sum += sample.Value
+			avg.count++
+			avgs[key] = avg
+		}
+	}
+	return avgs, order
+}
+
+// Name is the measurement, field and tags of d, ex: cpu.usage{core=0}.
+func (d Delta) Name() string {
+	return snapshot.Sample{Measurement: d.Measurement, Field: d.Field, Tags: d.Tags}.Name()
+}
+
+// WriteTable writes deltas as an aligned table, marking the significant
+// ones with a *.
+func WriteTable(w io.Writer, deltas []Delta) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, " \tMETRIC\tBEFORE\tAFTER\tCHANGE\tPERCENT")
+	for _, d := range deltas {
+		mark := " "
+		if d.Significant {
+			mark = "*"
+		}
+		percent := "-"
+		if d.Before != 0 {
+			percent = fmt.Sprintf("%+.1f%%", d.Percent)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%.2f\t%.2f\t%+.2f\t%s\n", mark, d.Name(), d.Before, d.After, d.Change, percent)
+	}
+	return tw.Flush()
+}
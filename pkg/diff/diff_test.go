@@ -0,0 +1,91 @@
+package diff
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/travis-james/system-monitor/pkg/metrics/cpu"
+	"github.com/travis-james/system-monitor/pkg/metrics/disk"
+	"github.com/travis-james/system-monitor/pkg/metrics/memory"
+	"github.com/travis-james/system-monitor/pkg/snapshot"
+)
+
+func mockSnapshot(usage []float64, load1 float64, used uint64, diskUsage float64) snapshot.Snapshot {
+	return snapshot.Snapshot{
+		Labels:    map[string]string{"host": "web-01"},
+		TimeStamp: time.Unix(1700000000, 0),
+		Cpu:       &cpu.CpuMetric{Usage: usage, NumberOfCores: len(usage), LoadAvg1: load1},
+		Memory:    &memory.MemoryMetric{UsedMemory: used, AvailableMemory: 1000},
+		Disks: map[string]disk.DiskMetric{
+			"/": {Device: "/dev/sda1", Mountpoint: "/", DiskUsage: disk.DiskUsage{Usage: diskUsage}, DiskThroughput: disk.DiskThroughput{Interval: 1}},
+		},
+	}
+}
+
+func find(t *testing.T, deltas []Delta, name string) Delta {
+	t.Helper()
+	for _, d := range deltas {
+		if d.Name() == name {
+			return d
+		}
+	}
+	t.Fatalf("no delta named %s", name)
+	return Delta{}
+}
+
+func TestCompare(t *testing.T) {
+	t.Parallel()
+	before := []snapshot.Snapshot{
+		mockSnapshot([]float64{10, 50}, 1, 100, 40),
+		mockSnapshot([]float64{30, 50}, 3, 100, 40),
+	}
+	after := []snapshot.Snapshot{mockSnapshot([]float64{40, 52}, 0, 150, 40)}
+	after[0].Labels["kernel"] = "6.9.0"
+
+	deltas := Compare(before, after, DefaultThreshold)
+	assert.Equal(t, Delta{
+		Measurement: "cpu",
+		Field:       "usage",
+		Tags:        map[string]string{"core": "0"},
+		Before:      20,
+		After:       40,
+		Change:      20,
+		Percent:     100,
+		Significant: true,
+	}, deltas[0], "before should be averaged and labels left out")
+	assert.False(t, find(t, deltas, "cpu.usage{core=1}").Significant)
+	assert.Equal(t, -100.0, find(t, deltas, "cpu.load1").Percent)
+	assert.Equal(t, 50.0, find(t, deltas, "memory.used").Percent)
+
+	zero := find(t, deltas, "disk.read_bytes{device=/dev/sda1,mountpoint=/}")
+	assert.Equal(t, 0.0, zero.Percent)
+	assert.False(t, zero.Significant)
+}
+
+func TestCompare_MissingValues(t *testing.T) {
+	t.Parallel()
+	before := []snapshot.Snapshot{mockSnapshot([]float64{10, 20}, 1, 100, 40)}
+	after := []snapshot.Snapshot{mockSnapshot([]float64{10}, 1, 100, 40)}
+	for _, d := range Compare(before, after, DefaultThreshold) {
+		assert.NotEqual(t, "cpu.usage{core=1}", d.Name(), "values missing from after should be skipped")
+	}
+	assert.Empty(t, Compare(before, nil, DefaultThreshold))
+}
+
+func TestWriteTable(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	require.Nil(t, WriteTable(&buf, []Delta{
+		{Measurement: "cpu", Field: "load1", Before: 1, After: 2, Change: 1, Percent: 100, Significant: true},
+		{Measurement: "cpu", Field: "usage", Tags: map[string]string{"core": "0"}, Before: 0, After: 0},
+	}))
+	lines := strings.Split(strings.TrimRight(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, "   METRIC             BEFORE  AFTER  CHANGE  PERCENT", lines[0])
+	assert.Equal(t, "*  cpu.load1          1.00    2.00   +1.00   +100.0%", lines[1])
+	assert.Equal(t, "   cpu.usage{core=0}  0.00    0.00   +0.00   -", lines[2])
+}
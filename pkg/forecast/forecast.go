@@ -0,0 +1,204 @@
+package forecast
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/travis-james/system-monitor/pkg/metrics/disk"
+)
+
+const ERR_NOT_ENOUGH_SAMPLES = "at least 3 samples are needed to forecast"
+
+// confidenceZ is the number of standard errors either side of the fitted
+// rate used for the forecast range, 1.96 gives roughly 95% confidence.
+const confidenceZ = 1.96
+
+// sample is a single observation of how much of a volume is used.
+type sample struct {
+	at   time.Time
+	used float64
+}
+
+// series is every sample kept for one mountpoint.
+type series struct {
+	total    uint64
+	capacity uint64 // Used plus Free, leaving out the blocks reserved for root that users can't fill.
+	samples  []sample
+}
+
+// Forecaster tracks DiskUsage.Used per mountpoint over time and fits a linear
+// trend to it to predict when each volume will be full.
+type Forecaster struct {
+	mu         sync.Mutex
+	maxSamples int
+	series     map[string]*series
+}
+
+// Forecast is the prediction for a single mountpoint. Times are in seconds
+// from the last sample.
+type Forecast struct {
+	Mountpoint   string
+	Total        uint64
+	Used         uint64
+	Samples      int
+	Rate         float64 // Bytes per second the volume is growing by, negative when shrinking.
+	Filling      bool    // True when the volume is growing, so the times below are set.
+	TimeToFull   float64 // Most likely time until the volume is full, as in no Free space is left for users.
+	EarliestFull float64 // Lower end of the confidence range.
+	LatestFull   float64 // Upper end of the confidence range, 0 when it can't be bounded.
+}
+
+// NewForecaster returns a Forecaster that keeps the last maxSamples samples of
+// each mountpoint, older samples are dropped so the trend follows recent usage.
+func NewForecaster(maxSamples int) *Forecaster {
+	return &Forecaster{
+		maxSamples: maxSamples,
+		series:     make(map[string]*series),
+	}
+}
+
+// Observe records the usage of mountpoint at the given time.
+func (f *Forecaster) Observe(mountpoint string, usage disk.DiskUsage, at time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, exists := f.series[mountpoint]
+	if !exists {
+		s = &series{}
+		f.series[mountpoint] = s
+	}
+	s.total = usage.Total
+	s.capacity = usage.Used + usage.Free
+	s.samples = append(s.samples, sample{at: at, used: float64(usage.Used)})
+	if f.maxSamples > 0 && len(s.samples) > f.maxSamples {
+		s.samples = s.samples[len(s.samples)-f.maxSamples:]
+	}
+}
+
+// Forecast predicts when mountpoint will be full from the samples observed so far.
+func (f *Forecaster) Forecast(mountpoint string) (Forecast, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, exists := f.series[mountpoint]
+	if !exists {
+		return Forecast{}, fmt.Errorf("no samples for mountpoint %q", mountpoint)
+	}
+	return forecast(mountpoint, s)
+}
+
+// Forecasts returns a forecast for every mountpoint with enough samples, the
+// volumes that will fill soonest come first.
+func (f *Forecaster) Forecasts() []Forecast {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var forecasts []Forecast
+	for mountpoint, s := range f.series {
+		fc, err := forecast(mountpoint, s)
+		if err != nil {
+			continue
+		}
+		forecasts = append(forecasts, fc)
+	}
+	sort.Slice(forecasts, func(i, j int) bool {
+		a, b := forecasts[i], forecasts[j]
+		if a.Filling != b.Filling {
+			return a.Filling
+		}
+		if a.TimeToFull != b.TimeToFull {
+			return a.TimeToFull < b.TimeToFull
+		}
+		return a.Mountpoint < b.Mountpoint
+	})
+	return forecasts
+}
+
+// forecast fits a least squares line through the samples in s. The slope is
+// the fill rate, its standard error gives the confidence range.
+func forecast(mountpoint string, s *series) (Forecast, error) {
+	n := float64(len(s.samples))
+	if n < 3 {
+		return Forecast{}, errors.New(ERR_NOT_ENOUGH_SAMPLES)
+	}
+	start := s.samples[0].at
+	var sumX, sumY float64
+	for _, smp := range s.samples {
+		sumX += smp.at.Sub(start).Seconds()
+		sumY += smp.used
+	}
+	meanX, meanY := sumX/n, sumY/n
+	var sxx, sxy float64
+	for _, smp := range s.samples {
+		dx := smp.at.Sub(start).Seconds() - meanX
+		sxx += dx * dx
+		sxy += dx * (smp.used - meanY)
+	}
+	if sxx == 0 {
+		return Forecast{}, fmt.Errorf("samples for mountpoint %q were all taken at the same time", mountpoint)
+	}
+	rate := sxy / sxx
+	intercept := meanY - rate*meanX
+	var sse float64
+	for _, smp := range s.samples {
+		residual := smp.used - (intercept + rate*smp.at.Sub(start).Seconds())
+		sse += residual * residual
+	}
+	stdErr := math.Sqrt(sse/(n-2)) / math.Sqrt(sxx)
+
+	last := s.samples[len(s.samples)-1]
+	fc := Forecast{
+		Mountpoint: mountpoint,
+		Total:      s.total,
+		Used:       uint64(last.used),
+		Samples:    len(s.samples),
+		Rate:       rate,
+	}
+	if rate <= 0 {
+		return fc, nil
+	}
+	remaining := math.Max(float64(s.capacity)-last.used, 0)
+	fc.Filling = true
+	fc.TimeToFull = remaining / rate
+	fc.EarliestFull = remaining / (rate + confidenceZ*stdErr)
+	if slowest := rate - confidenceZ*stdErr; slowest > 0 {
+		fc.LatestFull = remaining / slowest
+	}
+	return fc, nil
+}
+
+// String returns a string representation of Forecast.
+func (fc Forecast) String() string {
+	if !fc.Filling {
+		return fmt.Sprintf("%s: not filling (rate %.2f B/s, %d samples)", fc.Mountpoint, fc.Rate, fc.Samples)
+	}
+	latest := "unbounded"
+	if fc.LatestFull > 0 {
+		latest = formatSeconds(fc.LatestFull)
+	}
+	return fmt.Sprintf("%s: full in %s (range %s - %s, rate %.2f B/s, %d samples)",
+		fc.Mountpoint, formatSeconds(fc.TimeToFull), formatSeconds(fc.EarliestFull), latest, fc.Rate, fc.Samples)
+}
+
+func formatSeconds(seconds float64) string {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Second).String()
+}
+
+// FillCondition is an alert.Condition that fires for every mountpoint the
+// Forecaster predicts will be full within the given duration.
+type FillCondition struct {
+	Forecaster *Forecaster
+	Within     time.Duration
+}
+
+// Firing implements alert.Condition.
+func (fc FillCondition) Firing() []string {
+	var msgs []string
+	for _, f := range fc.Forecaster.Forecasts() {
+		if f.Filling && f.TimeToFull <= fc.Within.Seconds() {
+			msgs = append(msgs, f.String())
+		}
+	}
+	return msgs
+}
@@ -0,0 +1,124 @@
+package forecast
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/travis-james/system-monitor/pkg/alert"
+	"github.com/travis-james/system-monitor/pkg/metrics/disk"
+)
+
+// usage returns the DiskUsage of a volume with no reserved blocks.
+func usage(total, used uint64) disk.DiskUsage {
+	return disk.DiskUsage{Total: total, Used: used, Free: total - used}
+}
+
+func TestForecast_Linear(t *testing.T) {
+	t.Parallel()
+	f := NewForecaster(10)
+	start := time.Now()
+	for i := range 5 {
+		// Grows by 10 bytes a second, 500 bytes left after the last sample.
+		f.Observe("/", usage(1000, uint64(460+i*10)), start.Add(time.Duration(i)*time.Second))
+	}
+	got, err := f.Forecast("/")
+	require.Nil(t, err)
+	assert.True(t, got.Filling)
+	assert.InDelta(t, 10.0, got.Rate, 0.0001)
+	assert.InDelta(t, 50.0, got.TimeToFull, 0.0001)
+	// A perfect fit has no error so the range collapses to the estimate.
+	assert.InDelta(t, 50.0, got.EarliestFull, 0.0001)
+	assert.InDelta(t, 50.0, got.LatestFull, 0.0001)
+	assert.Equal(t, uint64(500), got.Used)
+}
+
+func TestForecast_ReservedBlocks(t *testing.T) {
+	t.Parallel()
+	f := NewForecaster(10)
+	start := time.Now()
+	for i := range 3 {
+		// 5% of the volume is reserved for root, so only 450 of the 500
+		// bytes not used can be filled.
+		used := uint64(480 + i*10)
+		f.Observe("/", disk.DiskUsage{Total: 1000, Used: used, Free: 950 - used}, start.Add(time.Duration(i)*time.Second))
+	}
+	got, err := f.Forecast("/")
+	require.Nil(t, err)
+	assert.InDelta(t, 45.0, got.TimeToFull, 0.0001)
+	assert.Equal(t, uint64(1000), got.Total)
+}
+
+func TestForecast_NoisyRange(t *testing.T) {
+	t.Parallel()
+	f := NewForecaster(0)
+	start := time.Now()
+	used := []uint64{100, 130, 115, 150, 140, 180}
+	for i, u := range used {
+		f.Observe("/data", usage(1000, u), start.Add(time.Duration(i)*time.Minute))
+	}
+	got, err := f.Forecast("/data")
+	require.Nil(t, err)
+	require.True(t, got.Filling)
+	assert.Less(t, got.EarliestFull, got.TimeToFull)
+	assert.Greater(t, got.LatestFull, got.TimeToFull)
+}
+
+func TestForecast_NotFilling(t *testing.T) {
+	t.Parallel()
+	f := NewForecaster(10)
+	start := time.Now()
+	for i := range 3 {
+		f.Observe("/", usage(1000, uint64(500-i*10)), start.Add(time.Duration(i)*time.Second))
+	}
+	got, err := f.Forecast("/")
+	require.Nil(t, err)
+	assert.False(t, got.Filling)
+	assert.Zero(t, got.TimeToFull)
+}
+
+func TestForecast_NotEnoughSamples(t *testing.T) {
+	t.Parallel()
+	f := NewForecaster(10)
+	f.Observe("/", usage(1000, 1), time.Now())
+	_, err := f.Forecast("/")
+	assert.EqualError(t, err, ERR_NOT_ENOUGH_SAMPLES)
+	_, err = f.Forecast("/missing")
+	assert.NotNil(t, err)
+}
+
+func TestForecaster_DropsOldSamples(t *testing.T) {
+	t.Parallel()
+	f := NewForecaster(3)
+	start := time.Now()
+	// Shrinking at first, then growing, only the growth should be kept.
+	used := []uint64{900, 500, 100, 110, 120}
+	for i, u := range used {
+		f.Observe("/", usage(1000, u), start.Add(time.Duration(i)*time.Second))
+	}
+	got, err := f.Forecast("/")
+	require.Nil(t, err)
+	assert.Equal(t, 3, got.Samples)
+	assert.InDelta(t, 10.0, got.Rate, 0.0001)
+}
+
+func TestFillCondition(t *testing.T) {
+	t.Parallel()
+	f := NewForecaster(10)
+	start := time.Now()
+	for i := range 3 {
+		at := start.Add(time.Duration(i) * time.Hour)
+		f.Observe("/soon", usage(1000, uint64(700+i*100)), at)
+		f.Observe("/later", usage(1000, uint64(100+i)), at)
+	}
+	alerts := alert.Evaluate([]alert.Rule{
+		{Name: "disk-fill", Condition: FillCondition{Forecaster: f, Within: 24 * time.Hour}},
+	}, start)
+	require.Len(t, alerts, 1)
+	assert.Contains(t, alerts[0].Message, "/soon")
+
+	forecasts := f.Forecasts()
+	require.Len(t, forecasts, 2)
+	assert.Equal(t, "/soon", forecasts[0].Mountpoint)
+}
@@ -7,25 +7,32 @@ import (
 
 	gopsutilCPU "github.com/shirou/gopsutil/v4/cpu"
 	gopsutilLoad "github.com/shirou/gopsutil/v4/load"
+	"github.com/travis-james/system-monitor/pkg/metrics"
 )
 
+// ERR_INVALID_SECONDS is the message of metrics.ErrInvalidInterval.
+//
+// Deprecated: use errors.Is with metrics.ErrInvalidInterval.
 const ERR_INVALID_SECONDS = "seconds must be greater than zero"
 
 // CpuMetric contains data for usage (how busy each core is) and load average (how much demand there is for cpu resources)
 type CpuMetric struct {
-	Usage         []float64 // CPU usage as a percentage over a given time interval, each entry represents a core.
-	NumberOfCores int       // Number of cores the CPU has.
-	TimeInterval  float64   // The time interval for which usage percentage of the cpu is taken from.
-	LoadAvg1      float64   // Average system load (number of processes running/waiting) over the past 1 minute.
-	LoadAvg5      float64   // Average system load (number of processes running/waiting) over the past 5 minutes.
-	LoadAvg15     float64   // Average system load (number of processes running/waiting) over the past 15 minutes.
-	TimeStamp     time.Time // Time the measurement was taken.
+	Usage         []float64    // CPU usage as a percentage over a given time interval, each entry represents a core.
+	NumberOfCores int          // Number of logical cores the CPU has, see Inventory for physical cores.
+	Frequency     []float64    // Current frequency in MHz averaged over the time interval, each entry represents a core.
+	Inventory     CpuInventory // CPU hardware the metrics were taken on.
+	TimeInterval  float64      // The time interval for which usage percentage of the cpu is taken from.
+	LoadAvg1      float64      // Average system load (number of processes running/waiting) over the past 1 minute, the LoadAvg fields are 0 when it couldn't be read.
+	LoadAvg5      float64      // Average system load (number of processes running/waiting) over the past 5 minutes.
+	LoadAvg15     float64      // Average system load (number of processes running/waiting) over the past 15 minutes.
+	NoLoadAvg     bool         `json:",omitempty"` // True when the load average couldn't be read.
+	TimeStamp     time.Time    // Time the measurement was taken.
 }
 
 // MeasureCpuMetrics is the public wrapper for measureCpuMetrics.
 // Will get all related cpu metrics and return CpuMetric.
 func MeasureCpuMetrics(seconds float64) (CpuMetric, error) {
-	return measureCpuMetrics(gopsutilCPU.Percent, gopsutilLoad.Avg, seconds)
+	return measureCpuMetrics(gopsutilCPU.Percent, gopsutilLoad.Avg, currentFrequencies, RetrieveCpuInventory, seconds)
 }
 
 // percentFunc is dependency injection for measureCpuMetrics and
@@ -36,30 +43,58 @@ type percentFunc func(time.Duration, bool) ([]float64, error)
 // gopsutilLoad.Avg.
 type loadAvgFunc func() (*gopsutilLoad.AvgStat, error)
 
+// inventoryFunc is dependency injection for measureCpuMetrics and
+// RetrieveCpuInventory.
+type inventoryFunc func() (CpuInventory, error)
+
 // measureCpuMetrics gets all related cpu metrics to put them
-// in a CpuMetric struct.
-func measureCpuMetrics(getPercentageUsage percentFunc, getLoadAvg loadAvgFunc, seconds float64) (CpuMetric, error) {
+// in a CpuMetric struct. When only the inventory or the load average fail
+// the rest of the metric is returned with an error wrapping
+// metrics.ErrPartial.
+func measureCpuMetrics(getPercentageUsage percentFunc, getLoadAvg loadAvgFunc, getFrequency frequencyFunc, getInventory inventoryFunc, seconds float64) (CpuMetric, error) {
 	if seconds <= 0 {
-		return CpuMetric{}, errors.New(ERR_INVALID_SECONDS)
+		return CpuMetric{}, metrics.ErrInvalidInterval
 	}
-	percentages, err := getPercentageUsage(time.Duration(seconds)*time.Second, true)
+	var partial []error
+	inventory, err := getInventory()
 	if err != nil {
-		return CpuMetric{}, fmt.Errorf("error getting CPU usage: %v", err)
+		partial = append(partial, fmt.Errorf("error getting CPU inventory: %w", metrics.Classify(err)))
 	}
-
-	loadAvg, err := getLoadAvg()
+	// Frequency isn't available on every platform or VM, so it is left
+	// empty rather than failing the measurement.
+	startFrequency, startErr := getFrequency()
+	percentages, err := getPercentageUsage(time.Duration(seconds*float64(time.Second)), true)
 	if err != nil {
-		return CpuMetric{}, fmt.Errorf("error in getting load average: %v", err)
+		return CpuMetric{}, fmt.Errorf("error getting CPU usage: %w", metrics.Classify(err))
 	}
-	return CpuMetric{
+	endFrequency, endErr := getFrequency()
+	var frequency []float64
+	if startErr == nil && endErr == nil && len(startFrequency) == len(endFrequency) {
+		frequency = make([]float64, len(startFrequency))
+		for i := range startFrequency {
+			frequency[i] = (startFrequency[i] + endFrequency[i]) / 2
+		}
+	}
+
+	cm := CpuMetric{
 		Usage:         percentages,
 		NumberOfCores: len(percentages),
+		Frequency:     frequency,
+		Inventory:     inventory,
 		TimeInterval:  seconds,
-		LoadAvg1:      loadAvg.Load1,
-		LoadAvg5:      loadAvg.Load5,
-		LoadAvg15:     loadAvg.Load15,
 		TimeStamp:     time.Now(),
-	}, nil
+	}
+	loadAvg, err := getLoadAvg()
+	if err != nil {
+		partial = append(partial, fmt.Errorf("error getting load average: %w", metrics.Classify(err)))
+		cm.NoLoadAvg = true
+	} else {
+		cm.LoadAvg1, cm.LoadAvg5, cm.LoadAvg15 = loadAvg.Load1, loadAvg.Load5, loadAvg.Load15
+	}
+	if len(partial) > 0 {
+		return cm, fmt.Errorf("%w: %w", metrics.ErrPartial, errors.Join(partial...))
+	}
+	return cm, nil
 }
 
 // String returns a string representation of CpuMetric.
@@ -68,6 +103,11 @@ func (cm CpuMetric) String() string {
 	for _, percentage := range cm.Usage {
 		retval += fmt.Sprintf("%.2f ", percentage)
 	}
+	retval += "\nFrequency: "
+	for _, mhz := range cm.Frequency {
+		retval += fmt.Sprintf("%.0f ", mhz)
+	}
+	retval += fmt.Sprintf("\nModel: %s\nPhysicalCores: %d\nSockets: %d", cm.Inventory.ModelName, cm.Inventory.PhysicalCores, cm.Inventory.Sockets)
 	retval += fmt.Sprintf("\nNumberOfCores: %d\nTimeInterval: %.2f\nLoadAvg1: %.2f\nLoadAvg5: %.2f\nLoadAvg15: %.2f\nTimeStamp: %v", cm.NumberOfCores, cm.TimeInterval, cm.LoadAvg1, cm.LoadAvg5, cm.LoadAvg15, cm.TimeStamp)
 	return retval
 }
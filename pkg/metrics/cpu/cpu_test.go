@@ -9,6 +9,7 @@ import (
 	gopsutilLoad "github.com/shirou/gopsutil/v4/load"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/travis-james/system-monitor/pkg/metrics"
 )
 
 // Mock percentage usage function
@@ -24,9 +25,26 @@ func mockLoadAvg() (*gopsutilLoad.AvgStat, error) {
 	return &gopsutilLoad.AvgStat{Load1: 1.5, Load5: 2.0, Load15: 2.5}, nil
 }
 
+// Mock frequency function, each call reports 100MHz higher than the last.
+func mockFrequency() frequencyFunc {
+	mhz := 2000.0
+	return func() ([]float64, error) {
+		mhz += 100
+		return []float64{mhz, mhz, mhz}, nil
+	}
+}
+
+// Mock inventory function
+func mockInventory() (CpuInventory, error) {
+	return CpuInventory{ModelName: "Mock CPU", PhysicalCores: 2, LogicalCores: 3, Sockets: 1}, nil
+}
+
 func TestMeasureCpuMetrics_ValidInput(t *testing.T) {
-	got, err := measureCpuMetrics(mockPercentageUsage, mockLoadAvg, 5)
+	got, err := measureCpuMetrics(mockPercentageUsage, mockLoadAvg, mockFrequency(), mockInventory, 5)
 	require.Nil(t, err)
+	assert.Equal(t, []float64{2150, 2150, 2150}, got.Frequency)
+	assert.Equal(t, 2, got.Inventory.PhysicalCores)
+	assert.Equal(t, 3, got.NumberOfCores)
 
 	expected := CpuMetric{
 		Usage:    []float64{10.5, 15.2, 20.3},
@@ -37,17 +55,32 @@ func TestMeasureCpuMetrics_ValidInput(t *testing.T) {
 }
 
 func TestMeasureCpuMetrics_InvalidDuration(t *testing.T) {
-	_, err := measureCpuMetrics(mockPercentageUsage, mockLoadAvg, -1)
-	assert.NotNil(t, err)
+	_, err := measureCpuMetrics(mockPercentageUsage, mockLoadAvg, mockFrequency(), mockInventory, -1)
+	assert.ErrorIs(t, err, metrics.ErrInvalidInterval)
 }
 
 func TestMeasureCpuMetrics_ErrorInCPUUsage(t *testing.T) {
 	mockErrUsage := func(duration time.Duration, detailed bool) ([]float64, error) {
-		return nil, errors.New("mock CPU usage error")
+		return nil, errors.New("not implemented yet")
 	}
 
-	_, err := measureCpuMetrics(mockErrUsage, mockLoadAvg, 5)
-	assert.NotNil(t, err)
+	_, err := measureCpuMetrics(mockErrUsage, mockLoadAvg, mockFrequency(), mockInventory, 5)
+	assert.ErrorIs(t, err, metrics.ErrUnsupported)
+	assert.NotErrorIs(t, err, metrics.ErrPartial)
+}
+
+func TestMeasureCpuMetrics_SubSecond(t *testing.T) {
+	var got time.Duration
+	usage := func(duration time.Duration, detailed bool) ([]float64, error) {
+		got = duration
+		return mockPercentageUsage(duration, detailed)
+	}
+	_, err := measureCpuMetrics(usage, mockLoadAvg, mockFrequency(), mockInventory, 1.5)
+	require.Nil(t, err)
+	assert.Equal(t, 1500*time.Millisecond, got)
+	_, err = measureCpuMetrics(usage, mockLoadAvg, mockFrequency(), mockInventory, 0.5)
+	require.Nil(t, err)
+	assert.Equal(t, 500*time.Millisecond, got)
 }
 
 func TestMeasureCpuMetrics_ErrorInLoadAvg(t *testing.T) {
@@ -55,20 +88,56 @@ func TestMeasureCpuMetrics_ErrorInLoadAvg(t *testing.T) {
 		return &gopsutilLoad.AvgStat{}, errors.New("mock load avg error")
 	}
 
-	_, err := measureCpuMetrics(mockPercentageUsage, mockErrLoadAvg, 5)
-	assert.NotNil(t, err)
+	got, err := measureCpuMetrics(mockPercentageUsage, mockErrLoadAvg, mockFrequency(), mockInventory, 5)
+	assert.ErrorIs(t, err, metrics.ErrPartial)
+	assert.ErrorContains(t, err, "mock load avg error")
+	// Usage is still returned without the load average.
+	assert.Equal(t, []float64{10.5, 15.2, 20.3}, got.Usage)
+	assert.Equal(t, 3, got.NumberOfCores)
+	assert.Zero(t, got.LoadAvg1)
+	assert.True(t, got.NoLoadAvg)
+}
+
+func TestMeasureCpuMetrics_NoFrequency(t *testing.T) {
+	mockErrFrequency := func() ([]float64, error) {
+		return nil, errors.New("mock frequency error")
+	}
+
+	got, err := measureCpuMetrics(mockPercentageUsage, mockLoadAvg, mockErrFrequency, mockInventory, 5)
+	require.Nil(t, err)
+	assert.Nil(t, got.Frequency)
+}
+
+func TestMeasureCpuMetrics_ErrorInInventory(t *testing.T) {
+	mockErrInventory := func() (CpuInventory, error) {
+		return CpuInventory{}, errors.New("mock inventory error")
+	}
+
+	got, err := measureCpuMetrics(mockPercentageUsage, mockLoadAvg, mockFrequency(), mockErrInventory, 5)
+	assert.ErrorIs(t, err, metrics.ErrPartial)
+	assert.ErrorContains(t, err, "mock inventory error")
+	// Usage and load are still returned without the inventory.
+	assert.Equal(t, 3, got.NumberOfCores)
+	assert.Equal(t, 1.5, got.LoadAvg1)
+	assert.Empty(t, got.Inventory.ModelName)
 }
 
 func TestString(t *testing.T) {
 	t.Parallel()
 	input := CpuMetric{
 		Usage:        []float64{1, 2, 3},
+		Frequency:    []float64{2400, 2500, 2600},
+		Inventory:    CpuInventory{ModelName: "Mock", PhysicalCores: 2, Sockets: 1},
 		TimeInterval: 0.3,
 		LoadAvg1:     0.1,
 		LoadAvg5:     0.2,
 		LoadAvg15:    0.3,
 	}
 	expected := `Usage: 1.00 2.00 3.00 
+		Frequency: 2400 2500 2600
+		Model: Mock
+		PhysicalCores: 2
+		Sockets: 1
 		NumberOfCores: 0
         TimeInterval: 0.30
         LoadAvg1: 0.10
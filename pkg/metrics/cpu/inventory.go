@@ -0,0 +1,158 @@
+package cpu
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	gopsutilCPU "github.com/shirou/gopsutil/v4/cpu"
+	"github.com/travis-james/system-monitor/pkg/metrics"
+)
+
+// CpuInventory describes the CPU hardware. It doesn't change while the
+// process runs so it is only collected once, see RetrieveCpuInventory.
+type CpuInventory struct {
+	ModelName     string   // ex: Intel(R) Xeon(R) CPU E5-2686 v4 @ 2.30GHz.
+	VendorID      string   // ex: GenuineIntel, AuthenticAMD.
+	PhysicalCores int      // Number of physical cores across all sockets.
+	LogicalCores  int      // Number of logical cores (hardware threads) across all sockets.
+	Sockets       int      // Number of physical CPU packages.
+	CacheSize     int32    // Cache size in KB as reported by the CPU.
+	Flags         []string `json:"-"` // CPU feature flags, ex: sse4_2, avx2. Left out of JSON since there are hundreds of them in every snapshot.
+}
+
+var (
+	inventoryMu     sync.Mutex
+	inventory       CpuInventory
+	inventoryCached bool
+)
+
+// RetrieveCpuInventory is the public wrapper for retrieveCpuInventory. The
+// inventory is cached after the first successful call, failures are tried
+// again on the next call.
+func RetrieveCpuInventory() (CpuInventory, error) {
+	inventoryMu.Lock()
+	defer inventoryMu.Unlock()
+	if inventoryCached {
+		return inventory, nil
+	}
+	retrieved, err := retrieveCpuInventory(gopsutilCPU.Info, gopsutilCPU.Counts)
+	if err != nil {
+		return CpuInventory{}, err
+	}
+	inventory, inventoryCached = retrieved, true
+	return inventory, nil
+}
+
+// infoFunc is dependency injection for retrieveCpuInventory and
+// gopsutilCPU.Info.
+type infoFunc func() ([]gopsutilCPU.InfoStat, error)
+
+// countsFunc is dependency injection for retrieveCpuInventory and
+// gopsutilCPU.Counts.
+type countsFunc func(bool) (int, error)
+
+func retrieveCpuInventory(getInfo infoFunc, getCounts countsFunc) (CpuInventory, error) {
+	infos, err := getInfo()
+	if err != nil {
+		return CpuInventory{}, fmt.Errorf("error getting CPU info: %w", metrics.Classify(err))
+	}
+	if len(infos) == 0 {
+		return CpuInventory{}, fmt.Errorf("%w: no CPU info was found", metrics.ErrUnsupported)
+	}
+	physical, err := getCounts(false)
+	if err != nil {
+		return CpuInventory{}, fmt.Errorf("error getting physical core count: %w", metrics.Classify(err))
+	}
+	logical, err := getCounts(true)
+	if err != nil {
+		return CpuInventory{}, fmt.Errorf("error getting logical core count: %w", metrics.Classify(err))
+	}
+	sockets := make(map[string]bool)
+	for _, info := range infos {
+		sockets[info.PhysicalID] = true
+	}
+	return CpuInventory{
+		ModelName:     infos[0].ModelName,
+		VendorID:      infos[0].VendorID,
+		PhysicalCores: physical,
+		LogicalCores:  logical,
+		Sockets:       len(sockets),
+		CacheSize:     infos[0].CacheSize,
+		Flags:         infos[0].Flags,
+	}, nil
+}
+
+// frequencyFunc is dependency injection for measureCpuMetrics, it returns the
+// current frequency of each core in MHz.
+type frequencyFunc func() ([]float64, error)
+
+// currentFrequencies reads the current frequency of each core from the live
+// /sys and /proc.
+func currentFrequencies() ([]float64, error) {
+	return readFrequencies("/sys", "/proc")
+}
+
+// readFrequencies reads cpufreq's scaling_cur_freq for each core under
+// sysRoot. VMs usually don't have cpufreq, so it falls back to the "cpu MHz"
+// lines of cpuinfo under procRoot.
+func readFrequencies(sysRoot, procRoot string) ([]float64, error) {
+	paths, _ := filepath.Glob(filepath.Join(sysRoot, "devices/system/cpu/cpu[0-9]*/cpufreq/scaling_cur_freq"))
+	if len(paths) > 0 {
+		sort.Slice(paths, func(i, j int) bool { return cpuIndex(paths[i]) < cpuIndex(paths[j]) })
+		freqs := make([]float64, 0, len(paths))
+		for _, path := range paths {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("error reading %s: %w", path, err)
+			}
+			khz, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing %s: %w", path, err)
+			}
+			freqs = append(freqs, khz/1000)
+		}
+		return freqs, nil
+	}
+
+	f, err := os.Open(filepath.Join(procRoot, "cpuinfo"))
+	if err != nil {
+		return nil, fmt.Errorf("error opening cpuinfo: %w", err)
+	}
+	defer f.Close()
+	var freqs []float64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), ":")
+		if !found || strings.TrimSpace(key) != "cpu MHz" {
+			continue
+		}
+		mhz, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing cpu MHz: %w", err)
+		}
+		freqs = append(freqs, mhz)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading cpuinfo: %w", err)
+	}
+	if len(freqs) == 0 {
+		return nil, fmt.Errorf("%w: no CPU frequencies were found", metrics.ErrUnsupported)
+	}
+	return freqs, nil
+}
+
+// cpuIndex returns N from a path containing .../cpuN/..., so cpu10 sorts after cpu9.
+func cpuIndex(path string) int {
+	for _, part := range strings.Split(filepath.ToSlash(path), "/") {
+		if n, err := strconv.Atoi(strings.TrimPrefix(part, "cpu")); err == nil && strings.HasPrefix(part, "cpu") {
+			return n
+		}
+	}
+	return -1
+}
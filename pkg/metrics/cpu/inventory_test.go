@@ -0,0 +1,95 @@
+package cpu
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	gopsutilCPU "github.com/shirou/gopsutil/v4/cpu"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetrieveCpuInventory(t *testing.T) {
+	t.Parallel()
+	mockInfo := func() ([]gopsutilCPU.InfoStat, error) {
+		return []gopsutilCPU.InfoStat{
+			{CPU: 0, PhysicalID: "0", ModelName: "Mock CPU", VendorID: "GenuineIntel", CacheSize: 512, Flags: []string{"sse4_2"}},
+			{CPU: 1, PhysicalID: "0", ModelName: "Mock CPU", VendorID: "GenuineIntel", CacheSize: 512, Flags: []string{"sse4_2"}},
+			{CPU: 2, PhysicalID: "1", ModelName: "Mock CPU", VendorID: "GenuineIntel", CacheSize: 512, Flags: []string{"sse4_2"}},
+		}, nil
+	}
+	mockCounts := func(logical bool) (int, error) {
+		if logical {
+			return 8, nil
+		}
+		return 4, nil
+	}
+	got, err := retrieveCpuInventory(mockInfo, mockCounts)
+	require.Nil(t, err)
+	expected := CpuInventory{
+		ModelName:     "Mock CPU",
+		VendorID:      "GenuineIntel",
+		PhysicalCores: 4,
+		LogicalCores:  8,
+		Sockets:       2,
+		CacheSize:     512,
+		Flags:         []string{"sse4_2"},
+	}
+	assert.Equal(t, expected, got)
+}
+
+func TestRetrieveCpuInventory_Errors(t *testing.T) {
+	t.Parallel()
+	mockCounts := func(bool) (int, error) { return 1, nil }
+	errInfo := func() ([]gopsutilCPU.InfoStat, error) { return nil, errors.New("mock info error") }
+	noInfo := func() ([]gopsutilCPU.InfoStat, error) { return nil, nil }
+
+	_, err := retrieveCpuInventory(errInfo, mockCounts)
+	assert.NotNil(t, err)
+	_, err = retrieveCpuInventory(noInfo, mockCounts)
+	assert.NotNil(t, err)
+}
+
+func TestCpuInventory_JSONLeavesOutFlags(t *testing.T) {
+	t.Parallel()
+	data, err := json.Marshal(CpuInventory{ModelName: "Mock CPU", Flags: []string{"sse4_2", "avx2"}})
+	require.Nil(t, err)
+	assert.Contains(t, string(data), "Mock CPU")
+	assert.NotContains(t, string(data), "avx2")
+}
+
+func writeFile(t *testing.T, path, data string) {
+	t.Helper()
+	require.Nil(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.Nil(t, os.WriteFile(path, []byte(data), 0o644))
+}
+
+func TestReadFrequencies_Cpufreq(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	for cpu, khz := range map[string]string{"cpu0": "2400000\n", "cpu1": "1200000\n", "cpu10": "3000000\n"} {
+		writeFile(t, filepath.Join(root, "devices/system/cpu", cpu, "cpufreq/scaling_cur_freq"), khz)
+	}
+	got, err := readFrequencies(root, root)
+	require.Nil(t, err)
+	assert.Equal(t, []float64{2400, 1200, 3000}, got)
+}
+
+func TestReadFrequencies_Cpuinfo(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "cpuinfo"), "processor\t: 0\ncpu MHz\t\t: 2294.608\n\nprocessor\t: 1\ncpu MHz\t\t: 2100.000\n")
+	got, err := readFrequencies(root, root)
+	require.Nil(t, err)
+	assert.Equal(t, []float64{2294.608, 2100}, got)
+}
+
+func TestReadFrequencies_NotFound(t *testing.T) {
+	t.Parallel()
+	root := t.TempDir()
+	_, err := readFrequencies(root, root)
+	assert.NotNil(t, err)
+}
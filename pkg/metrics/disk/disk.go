@@ -1,25 +1,41 @@
 package disk
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"time"
 
 	gopsutilDisk "github.com/shirou/gopsutil/v4/disk"
+	"github.com/travis-james/system-monitor/pkg/metrics"
 )
 
 type DiskMetric struct {
+	Device     string // Device the metrics are for, ex: /dev/sda1.
+	Mountpoint string // Where Device is mounted, ex: /.
 	DiskUsage
 	DiskThroughput
 	TimeStamp time.Time // Time the measurement was taken.
 }
 
 // DiskUsage has all values in bytes, except the field Usage which is a
-// percentage.
+// percentage. The Inodes fields are counts, with InodesUsage as a percentage.
 type DiskUsage struct {
-	Total uint64
-	Used  uint64
-	Free  uint64
-	Usage float64
+	Total        uint64
+	Used         uint64
+	Free         uint64
+	Usage        float64
+	InodesTotal  uint64
+	InodesUsed   uint64
+	InodesFree   uint64
+	InodesUsage  float64
+	Fstype       string   // Filesystem type, ex: ext4, xfs.
+	MountOptions []string // Options the filesystem was mounted with, ex: rw, noatime.
+	ReadOnly     bool     // True if the filesystem is mounted read-only.
 }
 
 type DiskThroughput struct {
@@ -28,24 +44,45 @@ type DiskThroughput struct {
 	ReadOps         float64
 	WriteOps        float64
 	TotalIOPS       float64
-	Interval        float64
+	Interval        float64 // 0 when the throughput couldn't be measured.
 }
 
 // MeasureDiskMetrics is a wrapper for measureDiskUsage and measureDiskThroughput.
+// diskName can be a device (ex: /dev/sda1 or sda1) or a mountpoint (ex: /),
+// see resolveDisk. When only the throughput fails, ex: for a tmpfs that has
+// no block device, the usage is returned with an error wrapping
+// metrics.ErrPartial.
 func MeasureDiskMetrics(diskName string, interval float64) (DiskMetric, error) {
-	diskUsage, err := measureDiskUsage(gopsutilDisk.Usage, diskName)
+	if interval <= 0 {
+		return DiskMetric{}, metrics.ErrInvalidInterval
+	}
+	device, mountpoint, err := resolveDisk(gopsutilDisk.Partitions, diskName)
 	if err != nil {
 		return DiskMetric{}, err
 	}
-	diskThroughput, err := measureDiskThroughput(gopsutilDisk.IOCounters, diskName, interval)
+	diskUsage, err := measureDiskUsage(gopsutilDisk.Usage, gopsutilDisk.Partitions, mountpoint)
 	if err != nil {
 		return DiskMetric{}, err
 	}
-	return DiskMetric{
-		DiskUsage:      diskUsage,
-		DiskThroughput: diskThroughput,
-		TimeStamp:      time.Now(),
-	}, nil
+	dm := DiskMetric{
+		Device:     device,
+		Mountpoint: mountpoint,
+		DiskUsage:  diskUsage,
+		TimeStamp:  time.Now(),
+	}
+	diskThroughput, err := measureDiskThroughput(gopsutilDisk.IOCounters, blockDevice("/sys", device), interval)
+	if err != nil {
+		return dm, fmt.Errorf("%w: %w", metrics.ErrPartial, err)
+	}
+	dm.DiskThroughput = diskThroughput
+	dm.TimeStamp = time.Now()
+	return dm, nil
+}
+
+// MeasureDiskUsage is the public wrapper for measureDiskUsage, for when only
+// the space used on a mountpoint is needed and not its throughput.
+func MeasureDiskUsage(mountpoint string) (DiskUsage, error) {
+	return measureDiskUsage(gopsutilDisk.Usage, gopsutilDisk.Partitions, mountpoint)
 }
 
 // RetrieveDeviceMounts returns a mapping of storage devices and their corresponding
@@ -64,7 +101,7 @@ type partitionsFunc func(bool) ([]gopsutilDisk.PartitionStat, error)
 func retrieveDeviceMounts(partitionFunc partitionsFunc) (map[string]string, error) {
 	partitions, err := partitionFunc(false) // False returns all physical devices.
 	if err != nil {
-		return map[string]string{}, fmt.Errorf("error when getting paritions: %v", err)
+		return map[string]string{}, fmt.Errorf("error when getting paritions: %w", metrics.Classify(err))
 	}
 	// Map devices to their mount points
 	deviceMap := make(map[string]string)
@@ -74,19 +111,80 @@ func retrieveDeviceMounts(partitionFunc partitionsFunc) (map[string]string, erro
 	return deviceMap, nil
 }
 
+// resolveDisk finds the device and mountpoint of diskName, which can be
+// either of them. Devices match with or without their /dev/ prefix. When
+// diskName isn't in the partition table it is used as both.
+func resolveDisk(partitionFunc partitionsFunc, diskName string) (string, string, error) {
+	partitions, err := partitionFunc(true)
+	if err != nil {
+		return "", "", fmt.Errorf("error when getting paritions: %w", metrics.Classify(err))
+	}
+	for _, p := range partitions {
+		if p.Mountpoint == diskName || p.Device == diskName || filepath.Base(p.Device) == diskName {
+			return p.Device, p.Mountpoint, nil
+		}
+	}
+	return diskName, diskName, nil
+}
+
+// blockDevice returns the kernel name of device, which is what IOCounters
+// uses. LVM and LUKS devices (ex: /dev/mapper/vg-root) are named dm-N by the
+// kernel, so device's symlink is followed, or failing that it is looked up
+// in the dm/name files under sysRoot.
+func blockDevice(sysRoot, device string) string {
+	if resolved, err := filepath.EvalSymlinks(device); err == nil {
+		device = resolved
+	}
+	name := filepath.Base(device)
+	if !strings.HasPrefix(device, "/dev/mapper/") {
+		return name
+	}
+	dms, _ := filepath.Glob(filepath.Join(sysRoot, "block/dm-*/dm/name"))
+	for _, dm := range dms {
+		data, err := os.ReadFile(dm)
+		if err == nil && strings.TrimSpace(string(data)) == name {
+			return filepath.Base(filepath.Dir(filepath.Dir(dm)))
+		}
+	}
+	return name
+}
+
 // diskUsageFunc is for dependency injection for measureDiskUsage.
 type diskUsageFunc func(string) (*gopsutilDisk.UsageStat, error)
 
-func measureDiskUsage(duf diskUsageFunc, diskName string) (DiskUsage, error) {
+// measureDiskUsage gets space and inode usage for the filesystem at diskName,
+// along with the options it is mounted with from the partition table. The
+// options are left empty when the partition table can't be read.
+func measureDiskUsage(duf diskUsageFunc, partitionFunc partitionsFunc, diskName string) (DiskUsage, error) {
 	usage, err := duf(diskName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return DiskUsage{}, fmt.Errorf("%w: %s: %w", metrics.ErrDeviceNotFound, diskName, err)
+	}
 	if err != nil {
-		return DiskUsage{}, err
+		return DiskUsage{}, fmt.Errorf("error when getting usage of %s: %w", diskName, metrics.Classify(err))
+	}
+	// Virtual filesystems are matched too. When mounts are stacked the last
+	// one is in effect.
+	partitions, _ := partitionFunc(true)
+	var opts []string
+	for _, p := range slices.Backward(partitions) {
+		if p.Mountpoint == usage.Path {
+			opts = p.Opts
+			break
+		}
 	}
 	return DiskUsage{
-		Total: usage.Total,
-		Used:  usage.Used,
-		Free:  usage.Free,
-		Usage: usage.UsedPercent,
+		Total:        usage.Total,
+		Used:         usage.Used,
+		Free:         usage.Free,
+		Usage:        usage.UsedPercent,
+		InodesTotal:  usage.InodesTotal,
+		InodesUsed:   usage.InodesUsed,
+		InodesFree:   usage.InodesFree,
+		InodesUsage:  usage.InodesUsedPercent,
+		Fstype:       usage.Fstype,
+		MountOptions: opts,
+		ReadOnly:     slices.Contains(opts, "ro"),
 	}, nil
 }
 
@@ -95,25 +193,28 @@ func measureDiskUsage(duf diskUsageFunc, diskName string) (DiskUsage, error) {
 type ioCountersFunc func(...string) (map[string]gopsutilDisk.IOCountersStat, error)
 
 func measureDiskThroughput(iocf ioCountersFunc, blockDeviceName string, interval float64) (DiskThroughput, error) {
+	if interval <= 0 {
+		return DiskThroughput{}, metrics.ErrInvalidInterval
+	}
 	ioStatsStart, err := iocf(blockDeviceName)
 	if err != nil {
-		return DiskThroughput{}, fmt.Errorf("error when getting start stats: %v", err)
+		return DiskThroughput{}, fmt.Errorf("error when getting start stats: %w", metrics.Classify(err))
 	}
 
 	startStat, exists := ioStatsStart[blockDeviceName]
 	if !exists {
-		return DiskThroughput{}, fmt.Errorf("disk name %q not found in start stat", blockDeviceName)
+		return DiskThroughput{}, fmt.Errorf("%w: disk name %q not found in start stat", metrics.ErrDeviceNotFound, blockDeviceName)
 	}
 
-	time.Sleep(time.Duration(interval) * time.Second)
+	time.Sleep(time.Duration(interval * float64(time.Second)))
 
 	ioStatsEnd, err := iocf(blockDeviceName)
 	if err != nil {
-		return DiskThroughput{}, fmt.Errorf("error when getting end stats: %v", err)
+		return DiskThroughput{}, fmt.Errorf("error when getting end stats: %w", metrics.Classify(err))
 	}
 	endStat, exists := ioStatsEnd[blockDeviceName]
 	if !exists {
-		return DiskThroughput{}, fmt.Errorf("disk name %q not found in end stat", blockDeviceName)
+		return DiskThroughput{}, fmt.Errorf("%w: disk name %q not found in end stat", metrics.ErrDeviceNotFound, blockDeviceName)
 	}
 
 	readOps := float64(endStat.ReadCount-startStat.ReadCount) / interval
@@ -131,11 +232,17 @@ func measureDiskThroughput(iocf ioCountersFunc, blockDeviceName string, interval
 
 func (dm DiskMetric) String() string { // Maybe I should just make a json function...
 	return fmt.Sprintf(
-		"DiskUsage: {\nTotal: %d\nUsed: %.d\nFree: %d\nUsage: %.2f\n}\n"+
+		"Device: %s\nMountpoint: %s\n"+
+			"DiskUsage: {\nTotal: %d\nUsed: %.d\nFree: %d\nUsage: %.2f\n"+
+			"InodesTotal: %d\nInodesUsed: %d\nInodesFree: %d\nInodesUsage: %.2f\n"+
+			"Fstype: %s\nMountOptions: %s\nReadOnly: %t\n}\n"+
 			"DiskThroughput: {\nReadThroughput: %.2f\nWriteThroughput: %.2f\n"+
 			"ReadOps: %.2f\nWriteOps: %.2f\nTotalIOPS: %.2f\nInterval: %.2f\n}\n"+
 			"%v",
+		dm.Device, dm.Mountpoint,
 		dm.DiskUsage.Total, dm.DiskUsage.Used, dm.DiskUsage.Free, dm.DiskUsage.Usage,
+		dm.DiskUsage.InodesTotal, dm.DiskUsage.InodesUsed, dm.DiskUsage.InodesFree, dm.DiskUsage.InodesUsage,
+		dm.DiskUsage.Fstype, strings.Join(dm.DiskUsage.MountOptions, ","), dm.DiskUsage.ReadOnly,
 		dm.DiskThroughput.ReadThroughput, dm.DiskThroughput.WriteThroughput,
 		dm.DiskThroughput.ReadOps, dm.DiskThroughput.WriteOps, dm.DiskThroughput.TotalIOPS,
 		dm.DiskThroughput.Interval, dm.TimeStamp,
@@ -2,12 +2,16 @@ package disk
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
 	"testing"
 	"time"
 
 	gopsutilDisk "github.com/shirou/gopsutil/v4/disk"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/travis-james/system-monitor/pkg/metrics"
 )
 
 func TestRetrieveDeviceMounts(t *testing.T) {
@@ -27,6 +31,40 @@ func TestRetrieveDeviceMounts(t *testing.T) {
 	assert.Equal(t, fmt.Sprintf("%v", got), fmt.Sprintf("%v", expected))
 }
 
+func TestResolveDisk(t *testing.T) {
+	t.Parallel()
+	mockPartitions := func(_ bool) ([]gopsutilDisk.PartitionStat, error) {
+		return []gopsutilDisk.PartitionStat{
+			{Device: "/dev/nvme0n1p1", Mountpoint: "/"},
+			{Device: "/dev/sdb1", Mountpoint: "/data"},
+		}, nil
+	}
+	for _, name := range []string{"/data", "/dev/sdb1", "sdb1"} {
+		device, mountpoint, err := resolveDisk(mockPartitions, name)
+		require.Nil(t, err)
+		assert.Equal(t, "/dev/sdb1", device, name)
+		assert.Equal(t, "/data", mountpoint, name)
+	}
+	device, mountpoint, err := resolveDisk(mockPartitions, "unknown")
+	require.Nil(t, err)
+	assert.Equal(t, "unknown", device)
+	assert.Equal(t, "unknown", mountpoint)
+}
+
+func TestBlockDevice(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "sda1", blockDevice("testdata/sys", "/dev/sda1"))
+	// Device mapper nodes that aren't symlinks are found by their dm name.
+	assert.Equal(t, "dm-1", blockDevice("testdata/sys", "/dev/mapper/luks-home"))
+	assert.Equal(t, "unknown", blockDevice("testdata/sys", "/dev/mapper/unknown"))
+
+	// udev links /dev/mapper names to the dm-N node.
+	dir := t.TempDir()
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "dm-3"), nil, 0o644))
+	require.Nil(t, os.Symlink(filepath.Join(dir, "dm-3"), filepath.Join(dir, "vg-data")))
+	assert.Equal(t, "dm-3", blockDevice("testdata/sys", filepath.Join(dir, "vg-data")))
+}
+
 func TestMeasureDiskUsage(t *testing.T) {
 	t.Parallel()
 	var (
@@ -34,21 +72,98 @@ func TestMeasureDiskUsage(t *testing.T) {
 		used        uint64  = 44
 		free        uint64  = 34
 		usedPercent float64 = 2.4
+		inodesTotal uint64  = 1000
+		inodesUsed  uint64  = 900
+		inodesFree  uint64  = 100
+		inodesPct   float64 = 90
 	)
-	mockUsage := func(_ string) (*gopsutilDisk.UsageStat, error) {
+	mockUsage := func(path string) (*gopsutilDisk.UsageStat, error) {
 		return &gopsutilDisk.UsageStat{
-			Total:       total,
-			Used:        used,
-			Free:        free,
-			UsedPercent: usedPercent,
+			Path:              path,
+			Fstype:            "ext4",
+			Total:             total,
+			Used:              used,
+			Free:              free,
+			UsedPercent:       usedPercent,
+			InodesTotal:       inodesTotal,
+			InodesUsed:        inodesUsed,
+			InodesFree:        inodesFree,
+			InodesUsedPercent: inodesPct,
 		}, nil
 	}
-	got, err := measureDiskUsage(mockUsage, "/")
+	mockPartitions := func(_ bool) ([]gopsutilDisk.PartitionStat, error) {
+		return []gopsutilDisk.PartitionStat{
+			{Device: "/dev/nvme01", Mountpoint: "/", Opts: []string{"rw", "relatime"}},
+			{Device: "/dev/nvme02", Mountpoint: "/mnt", Opts: []string{"ro", "noatime"}},
+		}, nil
+	}
+	got, err := measureDiskUsage(mockUsage, mockPartitions, "/")
 	require.Nil(t, err)
 	assert.Equal(t, got.Total, total)
 	assert.Equal(t, got.Free, free)
 	assert.Equal(t, got.Used, used)
 	assert.Equal(t, got.Usage, usedPercent)
+	assert.Equal(t, got.InodesTotal, inodesTotal)
+	assert.Equal(t, got.InodesUsed, inodesUsed)
+	assert.Equal(t, got.InodesFree, inodesFree)
+	assert.Equal(t, got.InodesUsage, inodesPct)
+	assert.Equal(t, "ext4", got.Fstype)
+	assert.Equal(t, []string{"rw", "relatime"}, got.MountOptions)
+	assert.False(t, got.ReadOnly)
+
+	got, err = measureDiskUsage(mockUsage, mockPartitions, "/mnt")
+	require.Nil(t, err)
+	assert.True(t, got.ReadOnly)
+}
+
+func TestMeasureDiskUsage_NoPartitions(t *testing.T) {
+	t.Parallel()
+	mockUsage := func(path string) (*gopsutilDisk.UsageStat, error) {
+		return &gopsutilDisk.UsageStat{Path: path}, nil
+	}
+	mockPartitions := func(_ bool) ([]gopsutilDisk.PartitionStat, error) {
+		return nil, fmt.Errorf("mock partitions error")
+	}
+	// The usage is still measured, only the mount options are missing.
+	got, err := measureDiskUsage(mockUsage, mockPartitions, "/")
+	require.Nil(t, err)
+	assert.Nil(t, got.MountOptions)
+}
+
+func TestMeasureDiskUsage_StackedMounts(t *testing.T) {
+	t.Parallel()
+	mockUsage := func(path string) (*gopsutilDisk.UsageStat, error) {
+		return &gopsutilDisk.UsageStat{Path: path}, nil
+	}
+	mockPartitions := func(_ bool) ([]gopsutilDisk.PartitionStat, error) {
+		return []gopsutilDisk.PartitionStat{
+			{Device: "/dev/sda1", Mountpoint: "/data", Opts: []string{"rw"}},
+			{Device: "/dev/sdb1", Mountpoint: "/data", Opts: []string{"ro"}},
+		}, nil
+	}
+	got, err := measureDiskUsage(mockUsage, mockPartitions, "/data")
+	require.Nil(t, err)
+	assert.True(t, got.ReadOnly)
+}
+
+func TestMeasureDiskUsage_ErrorKinds(t *testing.T) {
+	t.Parallel()
+	mockPartitions := func(_ bool) ([]gopsutilDisk.PartitionStat, error) {
+		return nil, nil
+	}
+	mockUsage := func(err error) diskUsageFunc {
+		return func(string) (*gopsutilDisk.UsageStat, error) {
+			return nil, err
+		}
+	}
+	_, err := measureDiskUsage(mockUsage(syscall.ENOENT), mockPartitions, "nope")
+	assert.ErrorIs(t, err, metrics.ErrDeviceNotFound)
+	assert.ErrorIs(t, err, syscall.ENOENT)
+	assert.EqualError(t, err, "device not found: nope: no such file or directory")
+
+	_, err = measureDiskUsage(mockUsage(syscall.EACCES), mockPartitions, "/secret")
+	assert.ErrorIs(t, err, metrics.ErrPermission)
+	assert.NotErrorIs(t, err, metrics.ErrDeviceNotFound)
 }
 
 func TestGetDiskThroughput(t *testing.T) {
@@ -79,13 +194,43 @@ func TestGetDiskThroughput(t *testing.T) {
 	assert.Equal(t, got.Interval, time)
 }
 
+func TestGetDiskThroughput_SubSecond(t *testing.T) {
+	t.Parallel()
+	counters := func(...string) (map[string]gopsutilDisk.IOCountersStat, error) {
+		return map[string]gopsutilDisk.IOCountersStat{"sda": {}}, nil
+	}
+	start := time.Now()
+	_, err := measureDiskThroughput(counters, "sda", 0.2)
+	require.Nil(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond, "the rates are per the whole interval so all of it should be slept")
+}
+
+func TestGetDiskThroughput_Errors(t *testing.T) {
+	t.Parallel()
+	noDisks := func(...string) (map[string]gopsutilDisk.IOCountersStat, error) {
+		return map[string]gopsutilDisk.IOCountersStat{}, nil
+	}
+	_, err := measureDiskThroughput(noDisks, "tmpfs", 1)
+	assert.ErrorIs(t, err, metrics.ErrDeviceNotFound)
+
+	_, err = measureDiskThroughput(noDisks, "sda", 0)
+	assert.ErrorIs(t, err, metrics.ErrInvalidInterval)
+}
+
 func TestString(t *testing.T) {
 	dm := DiskMetric{
 		DiskUsage: DiskUsage{
-			Total: 5,
-			Used:  4,
-			Free:  3,
-			Usage: 0.9,
+			Total:        5,
+			Used:         4,
+			Free:         3,
+			Usage:        0.9,
+			InodesTotal:  10,
+			InodesUsed:   4,
+			InodesFree:   6,
+			InodesUsage:  40,
+			Fstype:       "xfs",
+			MountOptions: []string{"ro"},
+			ReadOnly:     true,
 		},
 		DiskThroughput: DiskThroughput{
 			ReadThroughput:  99,
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// Errors shared by the metric packages, wrapped into the errors they return
+// so callers can tell why a measurement failed with errors.Is.
+var (
+	ErrInvalidInterval = errors.New("seconds must be greater than zero")
+	// ErrDeviceNotFound is for a disk that doesn't exist or isn't mounted.
+	ErrDeviceNotFound = errors.New("device not found")
+	ErrUnsupported    = errors.New("unsupported on this platform")
+	// ErrPermission is for what the agent isn't allowed to read, ex:
+	// another user's /proc files.
+	ErrPermission = errors.New("permission denied")
+	// ErrPartial is for a metric that was only partly measured. The part
+	// that was measured is returned along with the error.
+	ErrPartial = errors.New("partial measurement")
+)
+
+// notImplemented is the message gopsutil returns for what it doesn't support
+// on the platform. Its error is internal so it can only be matched by text.
+const notImplemented = "not implemented yet"
+
+// kindError is err classified as kind, keeping the message of err.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e kindError) Unwrap() []error {
+	return []error{e.kind, e.err}
+}
+
+// Classify wraps err with ErrPermission or ErrUnsupported when it is one of
+// them, ex: EACCES or gopsutil's "not implemented yet". Other errors are
+// returned as they are.
+func Classify(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrPermission), errors.Is(err, ErrUnsupported):
+		return err
+	case errors.Is(err, fs.ErrPermission):
+		return kindError{kind: ErrPermission, err: err}
+	case errors.Is(err, errors.ErrUnsupported) || err.Error() == notImplemented:
+		return kindError{kind: ErrUnsupported, err: err}
+	}
+	return err
+}
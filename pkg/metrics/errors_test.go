@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassify(t *testing.T) {
+	t.Parallel()
+	assert.Nil(t, Classify(nil))
+
+	eacces := &os.PathError{Op: "open", Path: "/proc/1/io", Err: syscall.EACCES}
+	got := Classify(fmt.Errorf("error when reading: %w", eacces))
+	assert.ErrorIs(t, got, ErrPermission)
+	assert.ErrorIs(t, got, syscall.EACCES)
+	assert.EqualError(t, got, "error when reading: open /proc/1/io: permission denied")
+
+	got = Classify(errors.New("not implemented yet"))
+	assert.ErrorIs(t, got, ErrUnsupported)
+	assert.EqualError(t, got, "not implemented yet")
+	assert.ErrorIs(t, Classify(syscall.ENOSYS), ErrUnsupported)
+
+	other := errors.New("mock error")
+	assert.Equal(t, other, Classify(other))
+	assert.NotErrorIs(t, Classify(other), ErrPermission)
+
+	// Classifying twice doesn't wrap twice.
+	once := Classify(eacces)
+	assert.Equal(t, once, Classify(once))
+}
@@ -0,0 +1,128 @@
+package host
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"sync"
+	"time"
+
+	gopsutilHost "github.com/shirou/gopsutil/v4/host"
+	"github.com/travis-james/system-monitor/pkg/metrics"
+)
+
+// HostMetric describes the machine the other metrics were measured on.
+type HostMetric struct {
+	Identity
+	Platform             string    // ex: ubuntu, rhel.
+	PlatformVersion      string    // Version of the complete OS.
+	KernelArch           string    // ex: x86_64.
+	BootTime             time.Time // Time the host was booted.
+	Uptime               float64   // Seconds since the host was booted.
+	VirtualizationSystem string    // ex: kvm, docker, empty on bare metal.
+	VirtualizationRole   string    // guest or host.
+	Users                int       // Number of logged in user sessions.
+	TimeStamp            time.Time // Time the measurement was taken.
+}
+
+// Identity is the part of HostMetric that tells hosts apart. It is attached
+// to every snapshot as labels.
+type Identity struct {
+	Hostname      string
+	MachineID     string
+	OS            string // ex: linux, darwin.
+	KernelVersion string
+}
+
+// MeasureHostMetrics is the public wrapper for measureHostMetrics.
+func MeasureHostMetrics() (HostMetric, error) {
+	return measureHostMetrics(gopsutilHost.Info, gopsutilHost.Users)
+}
+
+// infoFunc is dependency injection for measureHostMetrics and gopsutilHost.Info.
+type infoFunc func() (*gopsutilHost.InfoStat, error)
+
+// usersFunc is dependency injection for measureHostMetrics and gopsutilHost.Users.
+type usersFunc func() ([]gopsutilHost.UserStat, error)
+
+func measureHostMetrics(getInfo infoFunc, getUsers usersFunc) (HostMetric, error) {
+	info, err := getInfo()
+	if err != nil {
+		return HostMetric{}, fmt.Errorf("error getting host info: %w", metrics.Classify(err))
+	}
+	users, err := getUsers()
+	// Containers often have no utmp, which just means no one is logged in.
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return HostMetric{}, fmt.Errorf("error getting logged in users: %w", metrics.Classify(err))
+	}
+	return HostMetric{
+		Identity:             identityFromInfo(info),
+		Platform:             info.Platform,
+		PlatformVersion:      info.PlatformVersion,
+		KernelArch:           info.KernelArch,
+		BootTime:             time.Unix(int64(info.BootTime), 0),
+		Uptime:               float64(info.Uptime),
+		VirtualizationSystem: info.VirtualizationSystem,
+		VirtualizationRole:   info.VirtualizationRole,
+		Users:                len(users),
+		TimeStamp:            time.Now(),
+	}, nil
+}
+
+var (
+	identityOnce sync.Once
+	identity     Identity
+	identityErr  error
+)
+
+// LookupIdentity returns the Identity of the host this process runs on. It
+// doesn't change while the process runs so it is only looked up once.
+func LookupIdentity() (Identity, error) {
+	identityOnce.Do(func() {
+		identity, identityErr = lookupIdentity(gopsutilHost.Info)
+	})
+	return identity, identityErr
+}
+
+func lookupIdentity(getInfo infoFunc) (Identity, error) {
+	info, err := getInfo()
+	if err != nil {
+		return Identity{}, fmt.Errorf("error getting host info: %w", metrics.Classify(err))
+	}
+	return identityFromInfo(info), nil
+}
+
+func identityFromInfo(info *gopsutilHost.InfoStat) Identity {
+	return Identity{
+		Hostname:      info.Hostname,
+		MachineID:     info.HostID,
+		OS:            info.OS,
+		KernelVersion: info.KernelVersion,
+	}
+}
+
+// Labels returns the identity as key value pairs, empty values are left out.
+func (id Identity) Labels() map[string]string {
+	labels := make(map[string]string)
+	for k, v := range map[string]string{
+		"host":       id.Hostname,
+		"machine_id": id.MachineID,
+		"os":         id.OS,
+		"kernel":     id.KernelVersion,
+	} {
+		if v != "" {
+			labels[k] = v
+		}
+	}
+	return labels
+}
+
+// String returns a string representation of HostMetric.
+func (hm HostMetric) String() string {
+	return fmt.Sprintf(
+		"Hostname: %s\nMachineID: %s\nOS: %s\nPlatform: %s %s\nKernelVersion: %s\nKernelArch: %s\n"+
+			"BootTime: %v\nUptime: %.0f\nVirtualization: %s %s\nUsers: %d\nTimeStamp: %v",
+		hm.Hostname, hm.MachineID, hm.OS, hm.Platform, hm.PlatformVersion, hm.KernelVersion, hm.KernelArch,
+		hm.BootTime, hm.Uptime, hm.VirtualizationSystem, hm.VirtualizationRole, hm.Users, hm.TimeStamp,
+	)
+}
@@ -0,0 +1,79 @@
+package host
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"time"
+
+	gopsutilHost "github.com/shirou/gopsutil/v4/host"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/travis-james/system-monitor/pkg/metrics"
+)
+
+func mockInfo() (*gopsutilHost.InfoStat, error) {
+	return &gopsutilHost.InfoStat{
+		Hostname:             "web-01",
+		Uptime:               3600,
+		BootTime:             1700000000,
+		OS:                   "linux",
+		Platform:             "ubuntu",
+		PlatformVersion:      "24.04",
+		KernelVersion:        "6.8.0",
+		KernelArch:           "x86_64",
+		VirtualizationSystem: "kvm",
+		VirtualizationRole:   "guest",
+		HostID:               "abc-123",
+	}, nil
+}
+
+func mockUsers() ([]gopsutilHost.UserStat, error) {
+	return []gopsutilHost.UserStat{{User: "root"}, {User: "travis"}}, nil
+}
+
+func TestMeasureHostMetrics(t *testing.T) {
+	t.Parallel()
+	got, err := measureHostMetrics(mockInfo, mockUsers)
+	require.Nil(t, err)
+	assert.Equal(t, Identity{Hostname: "web-01", MachineID: "abc-123", OS: "linux", KernelVersion: "6.8.0"}, got.Identity)
+	assert.Equal(t, time.Unix(1700000000, 0), got.BootTime)
+	assert.Equal(t, 3600.0, got.Uptime)
+	assert.Equal(t, "guest", got.VirtualizationRole)
+	assert.Equal(t, 2, got.Users)
+	assert.NotZero(t, got.TimeStamp)
+}
+
+func TestMeasureHostMetrics_Errors(t *testing.T) {
+	t.Parallel()
+	errInfo := func() (*gopsutilHost.InfoStat, error) { return nil, errors.New("mock info error") }
+	errUsers := func() ([]gopsutilHost.UserStat, error) { return nil, fs.ErrPermission }
+
+	_, err := measureHostMetrics(errInfo, mockUsers)
+	assert.NotNil(t, err)
+	_, err = measureHostMetrics(mockInfo, errUsers)
+	assert.ErrorIs(t, err, metrics.ErrPermission)
+}
+
+func TestMeasureHostMetrics_NoUtmp(t *testing.T) {
+	t.Parallel()
+	noUtmp := func() ([]gopsutilHost.UserStat, error) {
+		return nil, &fs.PathError{Op: "open", Path: "/var/run/utmp", Err: fs.ErrNotExist}
+	}
+	got, err := measureHostMetrics(mockInfo, noUtmp)
+	require.Nil(t, err)
+	assert.Zero(t, got.Users)
+}
+
+func TestLookupIdentity(t *testing.T) {
+	t.Parallel()
+	got, err := lookupIdentity(mockInfo)
+	require.Nil(t, err)
+	assert.Equal(t, "web-01", got.Hostname)
+}
+
+func TestLabels(t *testing.T) {
+	t.Parallel()
+	id := Identity{Hostname: "web-01", OS: "linux"}
+	assert.Equal(t, map[string]string{"host": "web-01", "os": "linux"}, id.Labels())
+}
@@ -1,14 +1,20 @@
 package memory
 
 import (
+	"fmt"
 	"time"
 
 	gopsutilMem "github.com/shirou/gopsutil/v4/mem"
+	"github.com/travis-james/system-monitor/pkg/metrics"
 )
 
+// MemoryMetric has all values in bytes, except UsedPercent which is a
+// percentage of TotalMemory.
 type MemoryMetric struct {
+	TotalMemory     uint64
 	UsedMemory      uint64
 	AvailableMemory uint64
+	UsedPercent     float64
 	TimeStamp       time.Time
 }
 
@@ -21,11 +27,19 @@ type virtualMemoryFunc func() (*gopsutilMem.VirtualMemoryStat, error)
 func measureMemoryMetrics(getVirtualMemory virtualMemoryFunc) (MemoryMetric, error) {
 	memStats, err := getVirtualMemory()
 	if err != nil {
-		return MemoryMetric{}, err
+		return MemoryMetric{}, fmt.Errorf("error when getting virtual memory: %w", metrics.Classify(err))
 	}
 	return MemoryMetric{
+		TotalMemory:     memStats.Total,
 		UsedMemory:      memStats.Used,
 		AvailableMemory: memStats.Available,
+		UsedPercent:     memStats.UsedPercent,
 		TimeStamp:       time.Now(),
 	}, nil
 }
+
+// String returns a string representation of MemoryMetric.
+func (mm MemoryMetric) String() string {
+	return fmt.Sprintf("TotalMemory: %d\nUsedMemory: %d\nAvailableMemory: %d\nUsedPercent: %.2f\nTimeStamp: %v",
+		mm.TotalMemory, mm.UsedMemory, mm.AvailableMemory, mm.UsedPercent, mm.TimeStamp)
+}
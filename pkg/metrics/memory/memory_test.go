@@ -2,11 +2,13 @@ package memory
 
 import (
 	"errors"
+	"os"
 	"testing"
 
 	gopsutilMem "github.com/shirou/gopsutil/v4/mem"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/travis-james/system-monitor/pkg/metrics"
 )
 
 // Mock function for testing
@@ -21,18 +23,26 @@ func TestMeasureMemoryMetrics_ValidStats(t *testing.T) {
 		used      uint64 = 2048
 		available uint64 = 4096
 		mockStats        = &gopsutilMem.VirtualMemoryStat{
-			Used:      used,
-			Available: available,
+			Total:       8192,
+			Used:        used,
+			Available:   available,
+			UsedPercent: 25,
 		}
 	)
 	got, err := measureMemoryMetrics(mockVirtualMemory(mockStats, nil))
 	require.Nil(t, err)
 	assert.Equal(t, used, got.UsedMemory)
 	assert.Equal(t, available, got.AvailableMemory)
+	assert.Equal(t, uint64(8192), got.TotalMemory)
+	assert.Equal(t, 25.0, got.UsedPercent)
 	assert.NotZero(t, got.TimeStamp)
 }
 
 func TestMeasureMemoryMetrics_ErrorCase(t *testing.T) {
 	_, err := measureMemoryMetrics(mockVirtualMemory(nil, errors.New("failed to get memory stats")))
 	assert.NotNil(t, err)
+
+	_, err = measureMemoryMetrics(mockVirtualMemory(nil, &os.PathError{Op: "open", Path: "/proc/meminfo", Err: os.ErrPermission}))
+	assert.ErrorIs(t, err, metrics.ErrPermission)
+	assert.ErrorIs(t, err, os.ErrPermission)
 }
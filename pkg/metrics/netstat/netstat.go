@@ -0,0 +1,326 @@
+package netstat
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/travis-james/system-monitor/pkg/metrics"
+)
+
+// GroupBy chooses how socket counts are broken down in NetstatMetric.Groups.
+type GroupBy string
+
+const (
+	GroupNone      GroupBy = ""
+	GroupByPort    GroupBy = "port"    // Group by local port.
+	GroupByProcess GroupBy = "process" // Group by owning process, needs permission to read other processes' fds.
+)
+
+// tcpStates maps the hex state in /proc/net/tcp to the names ss and netstat use.
+var tcpStates = map[string]string{
+	"01": "ESTABLISHED",
+	"02": "SYN_SENT",
+	"03": "SYN_RECV",
+	"04": "FIN_WAIT1",
+	"05": "FIN_WAIT2",
+	"06": "TIME_WAIT",
+	"07": "CLOSE",
+	"08": "CLOSE_WAIT",
+	"09": "LAST_ACK",
+	"0A": "LISTEN",
+	"0B": "CLOSING",
+	"0C": "NEW_SYN_RECV",
+}
+
+// NetstatMetric contains socket counts from /proc/net/{tcp,tcp6,udp,udp6},
+// like `ss -s`, and protocol error rates from /proc/net/snmp and
+// /proc/net/netstat, like `netstat -s`. Rates are per second over TimeInterval.
+type NetstatMetric struct {
+	TcpStates       map[string]int // TCP sockets by state, ex: ESTABLISHED, TIME_WAIT.
+	TcpTotal        int            // Total TCP sockets, including listening ones.
+	Listening       int            // TCP sockets in the LISTEN state.
+	UdpTotal        int            // Total UDP sockets.
+	Groups          []SocketGroup  // Socket counts broken down by GroupBy, largest first.
+	Retransmits     float64        // TCP segments retransmitted per second.
+	ResetsSent      float64        // TCP resets sent per second.
+	EstabResets     float64        // Established TCP connections reset per second.
+	ListenOverflows float64        // Times per second a listen queue was full.
+	ListenDrops     float64        // Connection requests dropped per second at listening sockets.
+	UdpInErrors     float64        // UDP datagrams per second that couldn't be delivered, other than for no port.
+	UdpNoPorts      float64        // UDP datagrams per second received for a port with no listener.
+	UdpRcvbufErrors float64        // UDP datagrams dropped per second because the receive buffer was full.
+	UdpSndbufErrors float64        // UDP datagrams dropped per second because the send buffer was full.
+	TimeInterval    float64        // The time interval rates are taken over.
+	TimeStamp       time.Time      // Time the measurement was taken.
+}
+
+// SocketGroup counts the sockets with the same local port or owning process.
+type SocketGroup struct {
+	Key       string         // Local port, or "name(pid)" for processes. "-" when unknown.
+	TcpStates map[string]int // TCP sockets by state.
+	Tcp       int
+	Udp       int
+}
+
+// socket is a single line of /proc/net/{tcp,udp}*.
+type socket struct {
+	proto string // tcp or udp.
+	port  int
+	state string
+	inode string
+}
+
+// MeasureNetstatMetrics is the public wrapper for measureNetstatMetrics,
+// reading the live /proc.
+func MeasureNetstatMetrics(seconds float64, groupBy GroupBy) (NetstatMetric, error) {
+	return measureNetstatMetrics(procCountersReader("/proc"), "/proc", groupBy, seconds)
+}
+
+// countersFunc is dependency injection for measureNetstatMetrics to read
+// /proc/net/snmp and /proc/net/netstat. The counters are keyed by section
+// then name, ex: counters["Tcp"]["RetransSegs"].
+type countersFunc func() (map[string]map[string]uint64, error)
+
+// procCountersReader returns a countersFunc that parses net/snmp and
+// net/netstat under procRoot.
+func procCountersReader(procRoot string) countersFunc {
+	return func() (map[string]map[string]uint64, error) {
+		counters := make(map[string]map[string]uint64)
+		for _, name := range []string{"snmp", "netstat"} {
+			data, err := os.ReadFile(filepath.Join(procRoot, "net", name))
+			if err != nil {
+				return nil, err
+			}
+			if err := parseCounters(string(data), counters); err != nil {
+				return nil, fmt.Errorf("error parsing %s: %w", name, err)
+			}
+		}
+		return counters, nil
+	}
+}
+
+func measureNetstatMetrics(readCounters countersFunc, procRoot string, groupBy GroupBy, seconds float64) (NetstatMetric, error) {
+	if seconds <= 0 {
+		return NetstatMetric{}, metrics.ErrInvalidInterval
+	}
+	switch groupBy {
+	case GroupNone, GroupByPort, GroupByProcess:
+	default:
+		return NetstatMetric{}, fmt.Errorf("invalid group by: %q", groupBy)
+	}
+	start, err := readCounters()
+	if err != nil {
+		return NetstatMetric{}, fmt.Errorf("error when getting start counters: %w", metrics.Classify(err))
+	}
+
+	time.Sleep(time.Duration(seconds * float64(time.Second)))
+
+	end, err := readCounters()
+	if err != nil {
+		return NetstatMetric{}, fmt.Errorf("error when getting end counters: %w", metrics.Classify(err))
+	}
+	sockets, err := readSockets(procRoot)
+	if err != nil {
+		return NetstatMetric{}, fmt.Errorf("error when getting sockets: %w", metrics.Classify(err))
+	}
+
+	rate := func(section, name string) float64 {
+		s, e := start[section][name], end[section][name]
+		if e < s {
+			return 0
+		}
+		return float64(e-s) / seconds
+	}
+	nm := NetstatMetric{
+		TcpStates:       make(map[string]int),
+		Retransmits:     rate("Tcp", "RetransSegs"),
+		ResetsSent:      rate("Tcp", "OutRsts"),
+		EstabResets:     rate("Tcp", "EstabResets"),
+		ListenOverflows: rate("TcpExt", "ListenOverflows"),
+		ListenDrops:     rate("TcpExt", "ListenDrops"),
+		UdpInErrors:     rate("Udp", "InErrors"),
+		UdpNoPorts:      rate("Udp", "NoPorts"),
+		UdpRcvbufErrors: rate("Udp", "RcvbufErrors"),
+		UdpSndbufErrors: rate("Udp", "SndbufErrors"),
+		TimeInterval:    seconds,
+		TimeStamp:       time.Now(),
+	}
+	for _, s := range sockets {
+		if s.proto == "udp" {
+			nm.UdpTotal++
+			continue
+		}
+		nm.TcpTotal++
+		nm.TcpStates[s.state]++
+		if s.state == "LISTEN" {
+			nm.Listening++
+		}
+	}
+	if groupBy != GroupNone {
+		nm.Groups = groupSockets(sockets, procRoot, groupBy)
+	}
+	return nm, nil
+}
+
+// readSockets reads every TCP and UDP socket, IPv4 and IPv6, under procRoot.
+// A missing file means that protocol isn't enabled and is skipped.
+func readSockets(procRoot string) ([]socket, error) {
+	var sockets []socket
+	for _, name := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		f, err := os.Open(filepath.Join(procRoot, "net", name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		proto := strings.TrimSuffix(name, "6")
+		scanner := bufio.NewScanner(f)
+		scanner.Scan() // Skip the header.
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 10 {
+				continue
+			}
+			_, portHex, found := strings.Cut(fields[1], ":")
+			if !found {
+				continue
+			}
+			port, err := strconv.ParseInt(portHex, 16, 32)
+			if err != nil {
+				f.Close()
+				return nil, fmt.Errorf("error parsing port in %s: %w", name, err)
+			}
+			sockets = append(sockets, socket{proto: proto, port: int(port), state: tcpStates[fields[3]], inode: fields[9]})
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sockets, nil
+}
+
+// groupSockets counts sockets by local port or owning process, largest group first.
+func groupSockets(sockets []socket, procRoot string, groupBy GroupBy) []SocketGroup {
+	var owners map[string]string
+	if groupBy == GroupByProcess {
+		owners = socketOwners(procRoot)
+	}
+	groups := make(map[string]*SocketGroup)
+	for _, s := range sockets {
+		key := strconv.Itoa(s.port)
+		if groupBy == GroupByProcess {
+			key = owners[s.inode]
+			if key == "" {
+				key = "-"
+			}
+		}
+		g, exists := groups[key]
+		if !exists {
+			g = &SocketGroup{Key: key, TcpStates: make(map[string]int)}
+			groups[key] = g
+		}
+		if s.proto == "udp" {
+			g.Udp++
+			continue
+		}
+		g.Tcp++
+		g.TcpStates[s.state]++
+	}
+	result := make([]SocketGroup, 0, len(groups))
+	for _, g := range groups {
+		result = append(result, *g)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Tcp+a.Udp != b.Tcp+b.Udp {
+			return a.Tcp+a.Udp > b.Tcp+b.Udp
+		}
+		return a.Key < b.Key
+	})
+	return result
+}
+
+// socketOwners maps socket inodes to "name(pid)" of the process holding them,
+// by reading every /proc/<pid>/fd link. Processes that can't be read (ex: not
+// permitted, or exited) are skipped so their sockets are left unknown.
+func socketOwners(procRoot string) map[string]string {
+	owners := make(map[string]string)
+	fdDirs, _ := filepath.Glob(filepath.Join(procRoot, "[0-9]*", "fd"))
+	for _, fdDir := range fdDirs {
+		pidDir := filepath.Dir(fdDir)
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		comm, _ := os.ReadFile(filepath.Join(pidDir, "comm"))
+		owner := fmt.Sprintf("%s(%s)", strings.TrimSpace(string(comm)), filepath.Base(pidDir))
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			owners[strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")] = owner
+		}
+	}
+	return owners
+}
+
+// parseCounters parses the header and value line pairs of /proc/net/snmp and
+// /proc/net/netstat into counters. Negative values (ex: MaxConn) are skipped.
+func parseCounters(data string, counters map[string]map[string]uint64) error {
+	lines := strings.Split(strings.TrimSpace(data), "\n")
+	for i := 0; i+1 < len(lines); i += 2 {
+		names, values := strings.Fields(lines[i]), strings.Fields(lines[i+1])
+		if len(names) == 0 || len(names) != len(values) || names[0] != values[0] {
+			return fmt.Errorf("mismatched header and values on line %d", i+1)
+		}
+		section := strings.TrimSuffix(names[0], ":")
+		if counters[section] == nil {
+			counters[section] = make(map[string]uint64)
+		}
+		for j := 1; j < len(names); j++ {
+			v, err := strconv.ParseUint(values[j], 10, 64)
+			if err != nil {
+				continue
+			}
+			counters[section][names[j]] = v
+		}
+	}
+	return nil
+}
+
+// String returns a string representation of NetstatMetric, laid out like
+// `ss -s` followed by the rates `netstat -s` counts.
+func (nm NetstatMetric) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Total: %d\n", nm.TcpTotal+nm.UdpTotal)
+	fmt.Fprintf(&sb, "TCP: %d (estab %d, listen %d, timewait %d, closewait %d)\n",
+		nm.TcpTotal, nm.TcpStates["ESTABLISHED"], nm.Listening, nm.TcpStates["TIME_WAIT"], nm.TcpStates["CLOSE_WAIT"])
+	fmt.Fprintf(&sb, "UDP: %d\n", nm.UdpTotal)
+	for _, state := range slices.Sorted(maps.Keys(nm.TcpStates)) {
+		fmt.Fprintf(&sb, "%s: %d\n", state, nm.TcpStates[state])
+	}
+	fmt.Fprintf(&sb,
+		"Retransmits: %.2f/s\nResetsSent: %.2f/s\nEstabResets: %.2f/s\nListenOverflows: %.2f/s\nListenDrops: %.2f/s\n"+
+			"UdpInErrors: %.2f/s\nUdpNoPorts: %.2f/s\nUdpRcvbufErrors: %.2f/s\nUdpSndbufErrors: %.2f/s\n",
+		nm.Retransmits, nm.ResetsSent, nm.EstabResets, nm.ListenOverflows, nm.ListenDrops,
+		nm.UdpInErrors, nm.UdpNoPorts, nm.UdpRcvbufErrors, nm.UdpSndbufErrors)
+	for _, g := range nm.Groups {
+		fmt.Fprintf(&sb, "Group %s: tcp %d (estab %d, listen %d) udp %d\n",
+			g.Key, g.Tcp, g.TcpStates["ESTABLISHED"], g.TcpStates["LISTEN"], g.Udp)
+	}
+	fmt.Fprintf(&sb, "TimeInterval: %.2f\nTimeStamp: %v", nm.TimeInterval, nm.TimeStamp)
+	return sb.String()
+}
@@ -0,0 +1,111 @@
+package netstat
+
+import (
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/travis-james/system-monitor/pkg/metrics"
+)
+
+// fixtureCounters returns a countersFunc that reads testdata/start on the
+// first call and testdata/end after, as if time had passed between them.
+func fixtureCounters() countersFunc {
+	calls := 0
+	return func() (map[string]map[string]uint64, error) {
+		calls++
+		if calls == 1 {
+			return procCountersReader("testdata/start")()
+		}
+		return procCountersReader("testdata/end")()
+	}
+}
+
+func TestMeasureNetstatMetrics(t *testing.T) {
+	t.Parallel()
+	got, err := measureNetstatMetrics(fixtureCounters(), "testdata/end", GroupNone, 0.5)
+	require.Nil(t, err)
+	assert.Equal(t, map[string]int{"LISTEN": 2, "ESTABLISHED": 2, "TIME_WAIT": 1, "CLOSE_WAIT": 1}, got.TcpStates)
+	assert.Equal(t, 6, got.TcpTotal)
+	assert.Equal(t, 2, got.Listening)
+	assert.Equal(t, 1, got.UdpTotal)
+	assert.Equal(t, 40.0, got.Retransmits)
+	assert.Equal(t, 80.0, got.ResetsSent)
+	assert.Equal(t, 8.0, got.EstabResets)
+	assert.Equal(t, 4.0, got.ListenOverflows)
+	assert.Equal(t, 8.0, got.ListenDrops)
+	assert.Equal(t, 8.0, got.UdpInErrors)
+	assert.Equal(t, 16.0, got.UdpNoPorts)
+	assert.Equal(t, 4.0, got.UdpRcvbufErrors)
+	assert.Equal(t, 0.0, got.UdpSndbufErrors)
+	assert.Nil(t, got.Groups)
+	assert.NotZero(t, got.TimeStamp)
+}
+
+func TestMeasureNetstatMetrics_GroupByPort(t *testing.T) {
+	t.Parallel()
+	got, err := measureNetstatMetrics(fixtureCounters(), "testdata/end", GroupByPort, 0.01)
+	require.Nil(t, err)
+	expected := []SocketGroup{
+		{Key: "80", TcpStates: map[string]int{"LISTEN": 1, "ESTABLISHED": 1, "TIME_WAIT": 1}, Tcp: 3},
+		{Key: "443", TcpStates: map[string]int{"LISTEN": 1, "ESTABLISHED": 1}, Tcp: 2},
+		{Key: "53", TcpStates: map[string]int{}, Udp: 1},
+		{Key: "8080", TcpStates: map[string]int{"CLOSE_WAIT": 1}, Tcp: 1},
+	}
+	assert.Equal(t, expected, got.Groups)
+}
+
+func TestMeasureNetstatMetrics_GroupByProcess(t *testing.T) {
+	t.Parallel()
+	got, err := measureNetstatMetrics(fixtureCounters(), "testdata/end", GroupByProcess, 0.01)
+	require.Nil(t, err)
+	expected := []SocketGroup{
+		{Key: "nginx(1234)", TcpStates: map[string]int{"LISTEN": 2, "ESTABLISHED": 2}, Tcp: 4},
+		{Key: "redis(5678)", TcpStates: map[string]int{"CLOSE_WAIT": 1}, Tcp: 1, Udp: 1},
+		{Key: "-", TcpStates: map[string]int{"TIME_WAIT": 1}, Tcp: 1},
+	}
+	assert.Equal(t, expected, got.Groups)
+}
+
+func TestMeasureNetstatMetrics_Errors(t *testing.T) {
+	t.Parallel()
+	_, err := measureNetstatMetrics(fixtureCounters(), "testdata/end", GroupNone, 0)
+	assert.ErrorIs(t, err, metrics.ErrInvalidInterval)
+
+	errCounters := func() (map[string]map[string]uint64, error) { return nil, fs.ErrPermission }
+	_, err = measureNetstatMetrics(errCounters, "testdata/end", GroupNone, 0.01)
+	assert.ErrorIs(t, err, metrics.ErrPermission)
+
+	start := time.Now()
+	_, err = measureNetstatMetrics(fixtureCounters(), "testdata/end", GroupBy("bogus"), 10)
+	assert.ErrorContains(t, err, "invalid group by")
+	assert.Less(t, time.Since(start), time.Second, "an invalid group by should fail before the interval is slept")
+}
+
+func TestParseCounters(t *testing.T) {
+	t.Parallel()
+	counters := make(map[string]map[string]uint64)
+	err := parseCounters("Tcp: MaxConn RetransSegs\nTcp: -1 10\n", counters)
+	require.Nil(t, err)
+	assert.Equal(t, map[string]map[string]uint64{"Tcp": {"RetransSegs": 10}}, counters)
+
+	err = parseCounters("Tcp: MaxConn RetransSegs\nUdp: 1 2\n", counters)
+	assert.NotNil(t, err)
+}
+
+func TestString(t *testing.T) {
+	t.Parallel()
+	nm := NetstatMetric{
+		TcpStates: map[string]int{"ESTABLISHED": 5, "LISTEN": 2, "TIME_WAIT": 3},
+		TcpTotal:  10,
+		Listening: 2,
+		UdpTotal:  1,
+		Groups:    []SocketGroup{{Key: "80", TcpStates: map[string]int{"ESTABLISHED": 5}, Tcp: 5}},
+	}
+	s := nm.String()
+	assert.Contains(t, s, "Total: 11\n")
+	assert.Contains(t, s, "TCP: 10 (estab 5, listen 2, timewait 3, closewait 0)\n")
+	assert.Contains(t, s, "Group 80: tcp 5 (estab 5, listen 0) udp 0\n")
+}
@@ -0,0 +1,265 @@
+package process
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/process"
+	"github.com/travis-james/system-monitor/pkg/metrics"
+)
+
+// GroupBy chooses how processes are rolled up in ProcessMetric.Groups.
+type GroupBy string
+
+const (
+	GroupNone   GroupBy = ""     // One group per process.
+	GroupByTree GroupBy = "tree" // A process and all its descendants, rooted below init.
+	GroupByName GroupBy = "name" // Executable name, ex: every nginx worker together.
+	GroupByUser GroupBy = "user" // Owning user.
+	GroupByUnit GroupBy = "unit" // Systemd unit or scope from the process's cgroup.
+)
+
+// ProcessMetric is the CPU, memory and IO use of every process over
+// TimeInterval, rolled up by GroupBy and ranked by CPU use.
+type ProcessMetric struct {
+	GroupBy      GroupBy
+	Groups       []ProcessGroup // Busiest first, at most the top asked for.
+	Processes    int            // Processes running at the end of the interval.
+	TimeInterval float64        // The time interval CPU and IO are taken over.
+	TimeStamp    time.Time      // Time the measurement was taken.
+}
+
+// ProcessGroup is the combined use of the processes with the same key.
+type ProcessGroup struct {
+	Key        string  // ex: nginx, nginx.service, www-data, or name(pid) for GroupNone and GroupByTree.
+	Processes  int     // Processes in the group.
+	CPU        float64 // Percent of a single core, ex: 150 is one and a half cores.
+	RSS        uint64  // Resident memory in bytes.
+	ReadBytes  float64 // Bytes read from storage per second.
+	WriteBytes float64 // Bytes written to storage per second.
+}
+
+// procSample is one process at a point in time. Counters the process doesn't
+// let us read (ex: IO of another user's process) are 0.
+type procSample struct {
+	pid        int32
+	ppid       int32
+	name       string
+	user       string
+	unit       string
+	cpuTime    float64 // User and system CPU seconds since the process started.
+	rss        uint64
+	readBytes  uint64
+	writeBytes uint64
+}
+
+// MeasureProcessMetrics is the public wrapper for measureProcessMetrics,
+// reading the live /proc. top limits the groups returned, 0 for all.
+func MeasureProcessMetrics(seconds float64, groupBy GroupBy, top int) (ProcessMetric, error) {
+	return measureProcessMetrics(listProcesses("/proc"), seconds, groupBy, top)
+}
+
+// listFunc is dependency injection for measureProcessMetrics to sample every
+// running process, keyed by pid.
+type listFunc func() (map[int32]procSample, error)
+
+// listProcesses returns a listFunc reading processes with gopsutil and their
+// cgroups under procRoot. Processes that exit while being read are skipped.
+func listProcesses(procRoot string) listFunc {
+	return func() (map[int32]procSample, error) {
+		procs, err := process.Processes()
+		if err != nil {
+			return nil, err
+		}
+		samples := make(map[int32]procSample, len(procs))
+		for _, p := range procs {
+			name, err := p.Name()
+			if err != nil {
+				continue
+			}
+			s := procSample{pid: p.Pid, name: name, unit: readUnit(procRoot, p.Pid)}
+			s.ppid, _ = p.Ppid()
+			s.user, err = p.Username()
+			if err != nil {
+				// Users without a passwd entry, ex: in containers.
+				if uids, err := p.Uids(); err == nil && len(uids) > 0 {
+					s.user = strconv.Itoa(int(uids[0]))
+				}
+			}
+			if times, err := p.Times(); err == nil {
+				s.cpuTime = times.User + times.System
+			}
+			if mem, err := p.MemoryInfo(); err == nil {
+				s.rss = mem.RSS
+			}
+			if io, err := p.IOCounters(); err == nil {
+				s.readBytes, s.writeBytes = io.ReadBytes, io.WriteBytes
+			}
+			samples[p.Pid] = s
+		}
+		return samples, nil
+	}
+}
+
+// readUnit returns the systemd unit or scope of pid, or "-" when it isn't in
+// one or its cgroup can't be read.
+func readUnit(procRoot string, pid int32) string {
+	f, err := os.Open(filepath.Join(procRoot, strconv.Itoa(int(pid)), "cgroup"))
+	if err != nil {
+		return "-"
+	}
+	defer f.Close()
+	return parseUnit(bufio.NewScanner(f))
+}
+
+// parseUnit finds the unit in /proc/<pid>/cgroup, preferring the cgroup v2
+// line (0::/system.slice/nginx.service) over the v1 systemd line
+// (1:name=systemd:/system.slice/nginx.service). The unit is the innermost
+// .service or .scope in the path, ex: user@1000.service/app.slice/foo.scope
+// gives foo.scope.
+func parseUnit(scanner *bufio.Scanner) string {
+	var path string
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			path = parts[2]
+			break
+		}
+		if parts[1] == "name=systemd" {
+			path = parts[2]
+		}
+	}
+	elems := strings.Split(path, "/")
+	for i := len(elems) - 1; i >= 0; i-- {
+		if strings.HasSuffix(elems[i], ".service") || strings.HasSuffix(elems[i], ".scope") {
+			return elems[i]
+		}
+	}
+	return "-"
+}
+
+func measureProcessMetrics(list listFunc, seconds float64, groupBy GroupBy, top int) (ProcessMetric, error) {
+	if seconds <= 0 {
+		return ProcessMetric{}, metrics.ErrInvalidInterval
+	}
+	switch groupBy {
+	case GroupNone, GroupByTree, GroupByName, GroupByUser, GroupByUnit:
+	default:
+		return ProcessMetric{}, fmt.Errorf("invalid group by: %q", groupBy)
+	}
+	start, err := list()
+	if err != nil {
+		return ProcessMetric{}, fmt.Errorf("error when listing start processes: %w", metrics.Classify(err))
+	}
+
+	time.Sleep(time.Duration(seconds * float64(time.Second)))
+
+	end, err := list()
+	if err != nil {
+		return ProcessMetric{}, fmt.Errorf("error when listing end processes: %w", metrics.Classify(err))
+	}
+	groups := make(map[string]*ProcessGroup)
+	for pid, s := range end {
+		key := groupKey(end, s, groupBy)
+		g, exists := groups[key]
+		if !exists {
+			g = &ProcessGroup{Key: key}
+			groups[key] = g
+		}
+		// A process that started during the interval, or a pid that was
+		// reused, used all of its counters during the interval.
+		before, existed := start[pid]
+		if !existed || before.cpuTime > s.cpuTime {
+			before = procSample{}
+		}
+		g.Processes++
+		g.CPU += (s.cpuTime - before.cpuTime) / seconds * 100
+		g.RSS += s.rss
+		g.ReadBytes += rate(before.readBytes, s.readBytes, seconds)
+		g.WriteBytes += rate(before.writeBytes, s.writeBytes, seconds)
+	}
+	result := make([]ProcessGroup, 0, len(groups))
+	for _, g := range groups {
+		result = append(result, *g)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.CPU != b.CPU {
+			return a.CPU > b.CPU
+		}
+		if a.RSS != b.RSS {
+			return a.RSS > b.RSS
+		}
+		return a.Key < b.Key
+	})
+	if top > 0 && len(result) > top {
+		result = result[:top]
+	}
+	return ProcessMetric{
+		GroupBy:      groupBy,
+		Groups:       result,
+		Processes:    len(end),
+		TimeInterval: seconds,
+		TimeStamp:    time.Now(),
+	}, nil
+}
+
+// groupKey returns the key s is rolled up under.
+func groupKey(procs map[int32]procSample, s procSample, groupBy GroupBy) string {
+	switch groupBy {
+	case GroupByTree:
+		root := treeRoot(procs, s)
+		return fmt.Sprintf("%s(%d)", root.name, root.pid)
+	case GroupByName:
+		return s.name
+	case GroupByUser:
+		return s.user
+	case GroupByUnit:
+		return s.unit
+	}
+	return fmt.Sprintf("%s(%d)", s.name, s.pid)
+}
+
+// treeRoot returns the ancestor of s whose parent is init or kthreadd (or
+// isn't known), so each service started by init is rolled up with all its
+// descendants.
+func treeRoot(procs map[int32]procSample, s procSample) procSample {
+	for range len(procs) { // Bounded in case the parents loop.
+		parent, exists := procs[s.ppid]
+		if !exists || parent.ppid == 0 {
+			return s
+		}
+		s = parent
+	}
+	return s
+}
+
+// rate returns the per second increase of a counter, a counter that went
+// backwards counts as no increase.
+func rate(start, end uint64, seconds float64) float64 {
+	if end < start {
+		return 0
+	}
+	return float64(end-start) / seconds
+}
+
+// String returns a string representation of ProcessMetric.
+func (pm ProcessMetric) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Processes: %d\n", pm.Processes)
+	for _, g := range pm.Groups {
+		fmt.Fprintf(&sb, "Group %s: procs %d cpu %.2f%% rss %d read %.2f/s write %.2f/s\n",
+			g.Key, g.Processes, g.CPU, g.RSS, g.ReadBytes, g.WriteBytes)
+	}
+	fmt.Fprintf(&sb, "TimeInterval: %.2f\nTimeStamp: %v", pm.TimeInterval, pm.TimeStamp)
+	return sb.String()
+}
@@ -0,0 +1,151 @@
+package process
+
+import (
+	"bufio"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/travis-james/system-monitor/pkg/metrics"
+)
+
+// mockList returns a listFunc that returns start on the first call and end
+// after, as if time had passed between them.
+func mockList(start, end []procSample) listFunc {
+	calls := 0
+	return func() (map[int32]procSample, error) {
+		calls++
+		samples := start
+		if calls > 1 {
+			samples = end
+		}
+		procs := make(map[int32]procSample)
+		for _, s := range samples {
+			procs[s.pid] = s
+		}
+		return procs, nil
+	}
+}
+
+// A systemd, an nginx master with two workers and a shell running a job
+// that started during the interval.
+var (
+	startProcs = []procSample{
+		{pid: 1, ppid: 0, name: "systemd", user: "root", unit: "init.scope", cpuTime: 10, rss: 10},
+		{pid: 100, ppid: 1, name: "nginx", user: "root", unit: "nginx.service", cpuTime: 1, rss: 100},
+		{pid: 101, ppid: 100, name: "nginx", user: "www-data", unit: "nginx.service", cpuTime: 5, rss: 200, readBytes: 1000},
+		{pid: 102, ppid: 100, name: "nginx", user: "www-data", unit: "nginx.service", cpuTime: 5, rss: 200},
+		{pid: 200, ppid: 1, name: "bash", user: "alice", unit: "session-1.scope", cpuTime: 2, rss: 50},
+	}
+	endProcs = []procSample{
+		{pid: 1, ppid: 0, name: "systemd", user: "root", unit: "init.scope", cpuTime: 10, rss: 10},
+		{pid: 100, ppid: 1, name: "nginx", user: "root", unit: "nginx.service", cpuTime: 1, rss: 100},
+		{pid: 101, ppid: 100, name: "nginx", user: "www-data", unit: "nginx.service", cpuTime: 5.5, rss: 200, readBytes: 3000},
+		{pid: 102, ppid: 100, name: "nginx", user: "www-data", unit: "nginx.service", cpuTime: 5.25, rss: 200},
+		{pid: 200, ppid: 1, name: "bash", user: "alice", unit: "session-1.scope", cpuTime: 2, rss: 50},
+		{pid: 201, ppid: 200, name: "make", user: "alice", unit: "session-1.scope", cpuTime: 1, rss: 400, writeBytes: 4000},
+	}
+)
+
+func TestMeasureProcessMetrics(t *testing.T) {
+	t.Parallel()
+	got, err := measureProcessMetrics(mockList(startProcs, endProcs), 0.5, GroupNone, 0)
+	require.Nil(t, err)
+	assert.Equal(t, 6, got.Processes)
+	require.Len(t, got.Groups, 6)
+	assert.Equal(t, ProcessGroup{Key: "make(201)", Processes: 1, CPU: 200, RSS: 400, WriteBytes: 8000}, got.Groups[0],
+		"a process started during the interval should count all its usage")
+	assert.Equal(t, ProcessGroup{Key: "nginx(101)", Processes: 1, CPU: 100, RSS: 200, ReadBytes: 4000}, got.Groups[1])
+	assert.Equal(t, 0.5, got.TimeInterval)
+	assert.NotZero(t, got.TimeStamp)
+}
+
+func TestMeasureProcessMetrics_GroupBy(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		groupBy  GroupBy
+		expected []ProcessGroup
+	}{
+		{GroupByTree, []ProcessGroup{
+			{Key: "bash(200)", Processes: 2, CPU: 200, RSS: 450, WriteBytes: 8000},
+			{Key: "nginx(100)", Processes: 3, CPU: 150, RSS: 500, ReadBytes: 4000},
+			{Key: "systemd(1)", Processes: 1, RSS: 10},
+		}},
+		{GroupByName, []ProcessGroup{
+			{Key: "make", Processes: 1, CPU: 200, RSS: 400, WriteBytes: 8000},
+			{Key: "nginx", Processes: 3, CPU: 150, RSS: 500, ReadBytes: 4000},
+			{Key: "bash", Processes: 1, RSS: 50},
+			{Key: "systemd", Processes: 1, RSS: 10},
+		}},
+		{GroupByUser, []ProcessGroup{
+			{Key: "alice", Processes: 2, CPU: 200, RSS: 450, WriteBytes: 8000},
+			{Key: "www-data", Processes: 2, CPU: 150, RSS: 400, ReadBytes: 4000},
+			{Key: "root", Processes: 2, RSS: 110},
+		}},
+		{GroupByUnit, []ProcessGroup{
+			{Key: "session-1.scope", Processes: 2, CPU: 200, RSS: 450, WriteBytes: 8000},
+			{Key: "nginx.service", Processes: 3, CPU: 150, RSS: 500, ReadBytes: 4000},
+			{Key: "init.scope", Processes: 1, RSS: 10},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.groupBy), func(t *testing.T) {
+			t.Parallel()
+			got, err := measureProcessMetrics(mockList(startProcs, endProcs), 0.5, tt.groupBy, 0)
+			require.Nil(t, err)
+			assert.Equal(t, tt.expected, got.Groups)
+		})
+	}
+}
+
+func TestMeasureProcessMetrics_Top(t *testing.T) {
+	t.Parallel()
+	got, err := measureProcessMetrics(mockList(startProcs, endProcs), 0.5, GroupByName, 2)
+	require.Nil(t, err)
+	require.Len(t, got.Groups, 2)
+	assert.Equal(t, "nginx", got.Groups[1].Key)
+	assert.Equal(t, 6, got.Processes)
+}
+
+func TestMeasureProcessMetrics_Errors(t *testing.T) {
+	t.Parallel()
+	_, err := measureProcessMetrics(mockList(startProcs, endProcs), 0, GroupNone, 0)
+	assert.ErrorIs(t, err, metrics.ErrInvalidInterval)
+
+	_, err = measureProcessMetrics(mockList(startProcs, endProcs), 1, "color", 0)
+	assert.NotNil(t, err)
+
+	errList := func() (map[int32]procSample, error) { return nil, fs.ErrPermission }
+	_, err = measureProcessMetrics(errList, 0.01, GroupNone, 0)
+	assert.ErrorIs(t, err, metrics.ErrPermission)
+}
+
+func TestParseUnit(t *testing.T) {
+	t.Parallel()
+	tests := map[string]string{
+		"0::/system.slice/nginx.service\n":                                         "nginx.service",
+		"0::/user.slice/user-1000.slice/user@1000.service/app.slice/vim-1.scope\n": "vim-1.scope",
+		"12:cpu,cpuacct:/\n1:name=systemd:/system.slice/cron.service\n":            "cron.service",
+		"0::/\n":                        "-",
+		"0::/docker/0123456789abcdef\n": "-",
+		"not a cgroup file":             "-",
+	}
+	for cgroup, expected := range tests {
+		assert.Equal(t, expected, parseUnit(bufio.NewScanner(strings.NewReader(cgroup))), cgroup)
+	}
+}
+
+func TestReadUnit(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "nginx.service", readUnit("testdata", 100))
+	assert.Equal(t, "-", readUnit("testdata", 999))
+}
+
+func TestString(t *testing.T) {
+	t.Parallel()
+	s := ProcessMetric{Processes: 3, Groups: []ProcessGroup{{Key: "nginx", Processes: 3, CPU: 12.5, RSS: 1024}}}.String()
+	assert.Contains(t, s, "Processes: 3\n")
+	assert.Contains(t, s, "Group nginx: procs 3 cpu 12.50% rss 1024 read 0.00/s write 0.00/s\n")
+}
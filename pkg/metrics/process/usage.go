@@ -0,0 +1,139 @@
+package process
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/travis-james/system-monitor/pkg/metrics"
+)
+
+// userHZ is the unit of the times in /proc/<pid>/stat. The kernel always
+// reports them in USER_HZ, which is 100 on every architecture Linux exports.
+const userHZ = 100
+
+// Usage is the CPU time and memory a process has used so far.
+type Usage struct {
+	CPUTime float64 // User and system CPU seconds since the process started.
+	RSS     uint64  // Resident memory in bytes.
+	Started time.Time
+}
+
+// MeasureUsage is the public wrapper for measureUsage, reading the live
+// /proc. It returns the usage of pid so far, ex: for the agent to report on
+// itself.
+func MeasureUsage(pid int32) (Usage, error) {
+	return measureUsage(procPidStatReader("/proc"), pid)
+}
+
+// pidStat is what /proc says of a process, times in USER_HZ ticks.
+type pidStat struct {
+	utime     uint64
+	stime     uint64
+	starttime uint64 // Ticks after boot the process started.
+	rssKiB    uint64
+	btime     int64 // Boot time in seconds since the epoch.
+}
+
+// pidStatFunc is dependency injection for measureUsage to read a process.
+type pidStatFunc func(pid int32) (pidStat, error)
+
+// procPidStatReader returns a pidStatFunc that parses <pid>/stat,
+// <pid>/status and stat under procRoot.
+func procPidStatReader(procRoot string) pidStatFunc {
+	return func(pid int32) (pidStat, error) {
+		dir := filepath.Join(procRoot, strconv.Itoa(int(pid)))
+		data, err := os.ReadFile(filepath.Join(dir, "stat"))
+		if err != nil {
+			return pidStat{}, err
+		}
+		// The command name may have spaces and parentheses, the fields after
+		// it start at the last ')' with the state, field 3.
+		i := strings.LastIndexByte(string(data), ')')
+		if i < 0 {
+			return pidStat{}, fmt.Errorf("error parsing %s/stat: no command name", dir)
+		}
+		fields := strings.Fields(string(data[i+1:]))
+		if len(fields) < 20 {
+			return pidStat{}, fmt.Errorf("error parsing %s/stat: %d fields", dir, len(fields)+2)
+		}
+		var ps pidStat
+		for _, f := range []struct {
+			index int // Field number in proc(5), from 1.
+			value *uint64
+		}{{14, &ps.utime}, {15, &ps.stime}, {22, &ps.starttime}} {
+			if *f.value, err = strconv.ParseUint(fields[f.index-3], 10, 64); err != nil {
+				return pidStat{}, fmt.Errorf("error parsing %s/stat: %w", dir, err)
+			}
+		}
+		if ps.rssKiB, err = readStatusKiB(filepath.Join(dir, "status"), "VmRSS:"); err != nil {
+			return pidStat{}, err
+		}
+		if ps.btime, err = readBootTime(filepath.Join(procRoot, "stat")); err != nil {
+			return pidStat{}, err
+		}
+		return ps, nil
+	}
+}
+
+// readStatusKiB returns the value of key in a /proc/<pid>/status file, 0 when
+// it is missing, ex: VmRSS for kernel threads.
+func readStatusKiB(path, key string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == key {
+			kib, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("error parsing %s: %w", path, err)
+			}
+			return kib, nil
+		}
+	}
+	return 0, scanner.Err()
+}
+
+// readBootTime returns the btime of /proc/stat.
+func readBootTime(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if v, found := strings.CutPrefix(scanner.Text(), "btime "); found {
+			btime, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("error parsing %s: %w", path, err)
+			}
+			return btime, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("btime is missing from %s", path)
+}
+
+func measureUsage(readStat pidStatFunc, pid int32) (Usage, error) {
+	ps, err := readStat(pid)
+	if err != nil {
+		return Usage{}, fmt.Errorf("error when getting process %d: %w", pid, metrics.Classify(err))
+	}
+	started := time.Unix(ps.btime, 0).Add(time.Duration(ps.starttime) * time.Second / userHZ)
+	return Usage{
+		CPUTime: float64(ps.utime+ps.stime) / userHZ,
+		RSS:     ps.rssKiB * 1024,
+		Started: started,
+	}, nil
+}
@@ -0,0 +1,39 @@
+package process
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/travis-james/system-monitor/pkg/metrics"
+)
+
+func TestMeasureUsage(t *testing.T) {
+	t.Parallel()
+	got, err := measureUsage(procPidStatReader("testdata"), 100)
+	require.Nil(t, err)
+	expected := Usage{
+		CPUTime: 3.7,
+		RSS:     2800 * 1024,
+		Started: time.Unix(1700000000+500, 0),
+	}
+	assert.Equal(t, expected.CPUTime, got.CPUTime)
+	assert.Equal(t, expected.RSS, got.RSS)
+	assert.True(t, expected.Started.Equal(got.Started), "got %s", got.Started)
+}
+
+func TestMeasureUsage_Errors(t *testing.T) {
+	t.Parallel()
+	_, err := measureUsage(procPidStatReader("testdata"), 999)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	denied := func(int32) (pidStat, error) { return pidStat{}, fs.ErrPermission }
+	_, err = measureUsage(denied, 100)
+	assert.ErrorIs(t, err, metrics.ErrPermission)
+
+	_, err = measureUsage(func(int32) (pidStat, error) { return pidStat{}, errors.New("mock stat error") }, 100)
+	assert.ErrorContains(t, err, "process 100")
+}
@@ -0,0 +1,244 @@
+package process
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/process"
+	"github.com/travis-james/system-monitor/pkg/metrics"
+)
+
+// Target chooses the processes to watch, either a pid or every process
+// whose command line matches a regex.
+type Target struct {
+	Pid   int32          // ex: 1234.
+	Match *regexp.Regexp // ex: nginx, following restarts since it is matched on every measurement.
+}
+
+// String returns the pid or regex of the target.
+func (t Target) String() string {
+	if t.Match != nil {
+		return t.Match.String()
+	}
+	return strconv.Itoa(int(t.Pid))
+}
+
+// WatchMetric is the combined resource use of the watched processes over
+// TimeInterval.
+type WatchMetric struct {
+	Pid                 int32   `json:",omitempty"` // The pid watched, 0 when watching Match.
+	Match               string  `json:",omitempty"` // The regex watched.
+	Pids                []int32 // Processes running at the end of the interval.
+	Started             int     // Processes that started during the interval, ex: a restart.
+	Exited              int     // Processes that exited during the interval.
+	CPUUser             float64 // Percent of a single core spent in user mode.
+	CPUSystem           float64 // Percent of a single core spent in the kernel.
+	RSS                 uint64  // Resident memory in bytes.
+	PSS                 uint64  // Resident memory in bytes with shared pages split between the processes sharing them.
+	Swap                uint64  // Swapped out memory in bytes.
+	Threads             int
+	FDs                 int     // Open file descriptors.
+	ReadBytes           float64 // Bytes read from storage per second.
+	WriteBytes          float64 // Bytes written to storage per second.
+	VoluntarySwitches   float64 // Context switches waiting on IO or locks per second.
+	InvoluntarySwitches float64 // Context switches from being preempted per second.
+	TimeInterval        float64 // The time interval rates are taken over.
+	TimeStamp           time.Time
+}
+
+// watchSample is one watched process at a point in time. Counters the
+// process doesn't let us read are 0.
+type watchSample struct {
+	cpuUser     float64 // CPU seconds since the process started.
+	cpuSystem   float64
+	rss         uint64
+	pss         uint64
+	swap        uint64
+	threads     int
+	fds         int
+	readBytes   uint64
+	writeBytes  uint64
+	voluntary   uint64
+	involuntary uint64
+}
+
+// MeasureWatchMetrics is the public wrapper for measureWatchMetrics, reading
+// the live /proc.
+func MeasureWatchMetrics(seconds float64, target Target) (WatchMetric, error) {
+	return measureWatchMetrics(findProcesses("/proc"), seconds, target)
+}
+
+// findFunc is dependency injection for measureWatchMetrics to sample the
+// processes of a target, keyed by pid.
+type findFunc func(Target) (map[int32]watchSample, error)
+
+// findProcesses returns a findFunc reading processes with gopsutil and their
+// PSS under procRoot. Matching skips this process, whose own command line
+// holds the regex.
+func findProcesses(procRoot string) findFunc {
+	return func(target Target) (map[int32]watchSample, error) {
+		samples := make(map[int32]watchSample)
+		if target.Match == nil {
+			p, err := process.NewProcess(target.Pid)
+			if err != nil {
+				return nil, err
+			}
+			samples[p.Pid] = sampleProcess(procRoot, p)
+			return samples, nil
+		}
+		procs, err := process.Processes()
+		if err != nil {
+			return nil, err
+		}
+		self := int32(os.Getpid())
+		for _, p := range procs {
+			if p.Pid == self {
+				continue
+			}
+			cmdline, _ := p.Cmdline()
+			if cmdline == "" {
+				// Kernel threads and zombies have no command line.
+				cmdline, _ = p.Name()
+			}
+			if target.Match.MatchString(cmdline) {
+				samples[p.Pid] = sampleProcess(procRoot, p)
+			}
+		}
+		return samples, nil
+	}
+}
+
+// sampleProcess reads what it can of p.
+func sampleProcess(procRoot string, p *process.Process) watchSample {
+	var s watchSample
+	// gopsutil only reads statm on Linux, which has no swap.
+	s.pss, s.swap = readSmapsRollup(procRoot, p.Pid)
+	if times, err := p.Times(); err == nil {
+		s.cpuUser, s.cpuSystem = times.User, times.System
+	}
+	if mem, err := p.MemoryInfo(); err == nil {
+		s.rss = mem.RSS
+	}
+	if threads, err := p.NumThreads(); err == nil {
+		s.threads = int(threads)
+	}
+	if fds, err := p.NumFDs(); err == nil {
+		s.fds = int(fds)
+	}
+	if io, err := p.IOCounters(); err == nil {
+		s.readBytes, s.writeBytes = io.ReadBytes, io.WriteBytes
+	}
+	if switches, err := p.NumCtxSwitches(); err == nil {
+		s.voluntary, s.involuntary = uint64(switches.Voluntary), uint64(switches.Involuntary)
+	}
+	return s
+}
+
+// readSmapsRollup returns the PSS and swap in bytes from
+// /proc/<pid>/smaps_rollup, or 0 when it can't be read (ex: another user's
+// process, or before Linux 4.14).
+func readSmapsRollup(procRoot string, pid int32) (pss, swap uint64) {
+	f, err := os.Open(filepath.Join(procRoot, strconv.Itoa(int(pid)), "smaps_rollup"))
+	if err != nil {
+		return 0, 0
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		kib, _ := strconv.ParseUint(fields[1], 10, 64)
+		switch fields[0] {
+		case "Pss:":
+			pss = kib * 1024
+		case "Swap:":
+			swap = kib * 1024
+		}
+	}
+	return pss, swap
+}
+
+func measureWatchMetrics(find findFunc, seconds float64, target Target) (WatchMetric, error) {
+	if seconds <= 0 {
+		return WatchMetric{}, metrics.ErrInvalidInterval
+	}
+	if target.Pid <= 0 && target.Match == nil {
+		return WatchMetric{}, errors.New("no process was chosen to watch")
+	}
+	start, err := find(target)
+	if err != nil {
+		return WatchMetric{}, fmt.Errorf("error when finding start process %s: %w", target, metrics.Classify(err))
+	}
+
+	time.Sleep(time.Duration(seconds * float64(time.Second)))
+
+	// A matched process that restarted, or exited for good, leaves the
+	// metric empty rather than failing so the watch carries on.
+	end, err := find(target)
+	if err != nil {
+		return WatchMetric{}, fmt.Errorf("error when finding end process %s: %w", target, metrics.Classify(err))
+	}
+	wm := WatchMetric{
+		Pid:          target.Pid,
+		TimeInterval: seconds,
+		TimeStamp:    time.Now(),
+	}
+	if target.Match != nil {
+		wm.Pid, wm.Match = 0, target.Match.String()
+	}
+	for pid := range start {
+		if _, exists := end[pid]; !exists {
+			wm.Exited++
+		}
+	}
+	for pid, s := range end {
+		wm.Pids = append(wm.Pids, pid)
+		// A process that started during the interval, or a pid that was
+		// reused, used all of its counters during the interval.
+		before, existed := start[pid]
+		if !existed || before.cpuUser+before.cpuSystem > s.cpuUser+s.cpuSystem {
+			wm.Started++
+			before = watchSample{}
+		}
+		wm.CPUUser += (s.cpuUser - before.cpuUser) / seconds * 100
+		wm.CPUSystem += (s.cpuSystem - before.cpuSystem) / seconds * 100
+		wm.RSS += s.rss
+		wm.PSS += s.pss
+		wm.Swap += s.swap
+		wm.Threads += s.threads
+		wm.FDs += s.fds
+		wm.ReadBytes += rate(before.readBytes, s.readBytes, seconds)
+		wm.WriteBytes += rate(before.writeBytes, s.writeBytes, seconds)
+		wm.VoluntarySwitches += rate(before.voluntary, s.voluntary, seconds)
+		wm.InvoluntarySwitches += rate(before.involuntary, s.involuntary, seconds)
+	}
+	slices.Sort(wm.Pids)
+	return wm, nil
+}
+
+// String returns a string representation of WatchMetric.
+func (wm WatchMetric) String() string {
+	var sb strings.Builder
+	if wm.Match != "" {
+		fmt.Fprintf(&sb, "Match: %s\n", wm.Match)
+	}
+	fmt.Fprintf(&sb,
+		"Pids: %v\nStarted: %d\nExited: %d\nCPUUser: %.2f%%\nCPUSystem: %.2f%%\nRSS: %d\nPSS: %d\nSwap: %d\n"+
+			"Threads: %d\nFDs: %d\nReadBytes: %.2f\nWriteBytes: %.2f\nVoluntarySwitches: %.2f\nInvoluntarySwitches: %.2f\n"+
+			"TimeInterval: %.2f\nTimeStamp: %v",
+		wm.Pids, wm.Started, wm.Exited, wm.CPUUser, wm.CPUSystem, wm.RSS, wm.PSS, wm.Swap,
+		wm.Threads, wm.FDs, wm.ReadBytes, wm.WriteBytes, wm.VoluntarySwitches, wm.InvoluntarySwitches,
+		wm.TimeInterval, wm.TimeStamp,
+	)
+	return sb.String()
+}
@@ -0,0 +1,119 @@
+package process
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/travis-james/system-monitor/pkg/metrics"
+)
+
+// mockFind returns a findFunc that returns start on the first call and end
+// after, as if time had passed between them.
+func mockFind(start, end map[int32]watchSample) findFunc {
+	calls := 0
+	return func(Target) (map[int32]watchSample, error) {
+		calls++
+		if calls > 1 {
+			return end, nil
+		}
+		return start, nil
+	}
+}
+
+func TestMeasureWatchMetrics(t *testing.T) {
+	t.Parallel()
+	start := map[int32]watchSample{
+		100: {cpuUser: 1, cpuSystem: 1, rss: 100, readBytes: 1000, voluntary: 10},
+	}
+	end := map[int32]watchSample{
+		100: {cpuUser: 1.25, cpuSystem: 1.1, rss: 200, pss: 150, swap: 10, threads: 4, fds: 12,
+			readBytes: 3000, writeBytes: 500, voluntary: 60, involuntary: 5},
+	}
+	got, err := measureWatchMetrics(mockFind(start, end), 0.5, Target{Pid: 100})
+	require.Nil(t, err)
+	assert.Equal(t, int32(100), got.Pid)
+	assert.Equal(t, []int32{100}, got.Pids)
+	assert.InDelta(t, 50, got.CPUUser, 1e-9)
+	assert.InDelta(t, 20, got.CPUSystem, 1e-9)
+	assert.Equal(t, uint64(200), got.RSS)
+	assert.Equal(t, uint64(150), got.PSS)
+	assert.Equal(t, uint64(10), got.Swap)
+	assert.Equal(t, 4, got.Threads)
+	assert.Equal(t, 12, got.FDs)
+	assert.Equal(t, 4000.0, got.ReadBytes)
+	assert.Equal(t, 1000.0, got.WriteBytes)
+	assert.Equal(t, 100.0, got.VoluntarySwitches)
+	assert.Equal(t, 10.0, got.InvoluntarySwitches)
+	assert.Zero(t, got.Started)
+	assert.Zero(t, got.Exited)
+	assert.Equal(t, 0.5, got.TimeInterval)
+	assert.NotZero(t, got.TimeStamp)
+}
+
+func TestMeasureWatchMetrics_Restart(t *testing.T) {
+	t.Parallel()
+	target := Target{Match: regexp.MustCompile("nginx")}
+	start := map[int32]watchSample{
+		100: {cpuUser: 5, rss: 100},
+		101: {cpuUser: 5, rss: 100},
+	}
+	end := map[int32]watchSample{
+		100: {cpuUser: 5, rss: 100},
+		102: {cpuUser: 0.5, rss: 300},
+	}
+	got, err := measureWatchMetrics(mockFind(start, end), 0.5, target)
+	require.Nil(t, err)
+	assert.Equal(t, "nginx", got.Match)
+	assert.Zero(t, got.Pid)
+	assert.Equal(t, []int32{100, 102}, got.Pids)
+	assert.Equal(t, 1, got.Started)
+	assert.Equal(t, 1, got.Exited)
+	assert.Equal(t, 100.0, got.CPUUser, "a restarted process should count all its usage")
+	assert.Equal(t, uint64(400), got.RSS)
+
+	got, err = measureWatchMetrics(mockFind(start, map[int32]watchSample{}), 0.01, target)
+	require.Nil(t, err, "a match that is down should be reported as empty")
+	assert.Empty(t, got.Pids)
+	assert.Equal(t, 2, got.Exited)
+}
+
+func TestMeasureWatchMetrics_Errors(t *testing.T) {
+	t.Parallel()
+	find := mockFind(map[int32]watchSample{}, map[int32]watchSample{})
+	_, err := measureWatchMetrics(find, 0, Target{Pid: 100})
+	assert.ErrorIs(t, err, metrics.ErrInvalidInterval)
+
+	_, err = measureWatchMetrics(find, 0.01, Target{})
+	assert.NotNil(t, err)
+
+	gone := func(Target) (map[int32]watchSample, error) { return nil, errors.New("process not found") }
+	_, err = measureWatchMetrics(gone, 0.01, Target{Pid: 100})
+	assert.ErrorContains(t, err, "process 100")
+}
+
+func TestReadSmapsRollup(t *testing.T) {
+	t.Parallel()
+	pss, swap := readSmapsRollup("testdata", 100)
+	assert.Equal(t, uint64(397*1024), pss)
+	assert.Equal(t, uint64(64*1024), swap)
+	pss, swap = readSmapsRollup("testdata", 999)
+	assert.Zero(t, pss)
+	assert.Zero(t, swap)
+}
+
+func TestTargetString(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "1234", Target{Pid: 1234}.String())
+	assert.Equal(t, "^nginx", Target{Match: regexp.MustCompile("^nginx")}.String())
+}
+
+func TestWatchString(t *testing.T) {
+	t.Parallel()
+	s := WatchMetric{Match: "nginx", Pids: []int32{1, 2}, CPUUser: 12.5}.String()
+	assert.Contains(t, s, "Match: nginx\n")
+	assert.Contains(t, s, "Pids: [1 2]\n")
+	assert.Contains(t, s, "CPUUser: 12.50%\n")
+}
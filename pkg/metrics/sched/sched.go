@@ -0,0 +1,180 @@
+package sched
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/travis-james/system-monitor/pkg/metrics"
+)
+
+// SchedMetric contains kernel scheduler counters from /proc/stat and
+// /proc/loadavg. Rates are per second over TimeInterval, the rest are the
+// values at the end of the interval.
+type SchedMetric struct {
+	ContextSwitches float64   // Context switches per second.
+	Interrupts      float64   // Interrupts serviced per second.
+	SoftIrqs        float64   // Softirqs serviced per second.
+	Forks           float64   // Processes and threads created per second.
+	ProcsRunning    uint64    // Number of processes in the run queue.
+	ProcsBlocked    uint64    // Number of processes blocked waiting on IO.
+	Threads         uint64    // Total number of threads (scheduling entities) on the system.
+	TimeInterval    float64   // The time interval rates are taken over.
+	TimeStamp       time.Time // Time the measurement was taken.
+}
+
+// procStat is the subset of /proc/stat that SchedMetric is built from.
+type procStat struct {
+	ctxt         uint64
+	intr         uint64
+	softirq      uint64
+	processes    uint64
+	procsRunning uint64
+	procsBlocked uint64
+}
+
+// MeasureSchedMetrics is the public wrapper for measureSchedMetrics, reading
+// the live /proc.
+func MeasureSchedMetrics(seconds float64) (SchedMetric, error) {
+	return measureSchedMetrics(procStatReader("/proc"), procLoadavgReader("/proc"), seconds)
+}
+
+// statFunc is dependency injection for measureSchedMetrics to read /proc/stat.
+type statFunc func() (procStat, error)
+
+// threadsFunc is dependency injection for measureSchedMetrics to read the
+// total thread count from /proc/loadavg.
+type threadsFunc func() (uint64, error)
+
+// procStatReader returns a statFunc that parses stat under procRoot.
+func procStatReader(procRoot string) statFunc {
+	return func() (procStat, error) {
+		f, err := os.Open(filepath.Join(procRoot, "stat"))
+		if err != nil {
+			return procStat{}, err
+		}
+		defer f.Close()
+		return parseStat(f)
+	}
+}
+
+// procLoadavgReader returns a threadsFunc that parses loadavg under procRoot.
+func procLoadavgReader(procRoot string) threadsFunc {
+	return func() (uint64, error) {
+		data, err := os.ReadFile(filepath.Join(procRoot, "loadavg"))
+		if err != nil {
+			return 0, err
+		}
+		return parseLoadavgThreads(string(data))
+	}
+}
+
+func measureSchedMetrics(readStat statFunc, readThreads threadsFunc, seconds float64) (SchedMetric, error) {
+	if seconds <= 0 {
+		return SchedMetric{}, metrics.ErrInvalidInterval
+	}
+	start, err := readStat()
+	if err != nil {
+		return SchedMetric{}, fmt.Errorf("error when getting start stats: %w", metrics.Classify(err))
+	}
+
+	time.Sleep(time.Duration(seconds * float64(time.Second)))
+
+	end, err := readStat()
+	if err != nil {
+		return SchedMetric{}, fmt.Errorf("error when getting end stats: %w", metrics.Classify(err))
+	}
+	threads, err := readThreads()
+	if err != nil {
+		return SchedMetric{}, fmt.Errorf("error when getting thread count: %w", metrics.Classify(err))
+	}
+	return SchedMetric{
+		ContextSwitches: rate(start.ctxt, end.ctxt, seconds),
+		Interrupts:      rate(start.intr, end.intr, seconds),
+		SoftIrqs:        rate(start.softirq, end.softirq, seconds),
+		Forks:           rate(start.processes, end.processes, seconds),
+		ProcsRunning:    end.procsRunning,
+		ProcsBlocked:    end.procsBlocked,
+		Threads:         threads,
+		TimeInterval:    seconds,
+		TimeStamp:       time.Now(),
+	}, nil
+}
+
+// rate returns the per second increase of a counter, a counter that went
+// backwards (ex: wrapped) counts as no increase.
+func rate(start, end uint64, seconds float64) float64 {
+	if end < start {
+		return 0
+	}
+	return float64(end-start) / seconds
+}
+
+// parseStat reads the scheduler counters out of /proc/stat. For intr and
+// softirq only the first number, the total, is used.
+func parseStat(r io.Reader) (procStat, error) {
+	var stat procStat
+	fields := map[string]*uint64{
+		"ctxt":          &stat.ctxt,
+		"intr":          &stat.intr,
+		"softirq":       &stat.softirq,
+		"processes":     &stat.processes,
+		"procs_running": &stat.procsRunning,
+		"procs_blocked": &stat.procsBlocked,
+	}
+	found := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024) // intr lines can be very long.
+	for scanner.Scan() {
+		line := strings.Fields(scanner.Text())
+		if len(line) < 2 {
+			continue
+		}
+		dst, exists := fields[line[0]]
+		if !exists {
+			continue
+		}
+		v, err := strconv.ParseUint(line[1], 10, 64)
+		if err != nil {
+			return procStat{}, fmt.Errorf("error parsing %s: %w", line[0], err)
+		}
+		*dst = v
+		found++
+	}
+	if err := scanner.Err(); err != nil {
+		return procStat{}, err
+	}
+	if found != len(fields) {
+		return procStat{}, fmt.Errorf("found %d of %d expected fields in stat", found, len(fields))
+	}
+	return stat, nil
+}
+
+// parseLoadavgThreads returns the total thread count from /proc/loadavg, the
+// number after the slash in the fourth field (ex: 1/73).
+func parseLoadavgThreads(loadavg string) (uint64, error) {
+	fields := strings.Fields(loadavg)
+	if len(fields) < 4 {
+		return 0, fmt.Errorf("unexpected loadavg format: %q", loadavg)
+	}
+	_, total, found := strings.Cut(fields[3], "/")
+	if !found {
+		return 0, fmt.Errorf("unexpected loadavg format: %q", loadavg)
+	}
+	return strconv.ParseUint(total, 10, 64)
+}
+
+// String returns a string representation of SchedMetric.
+func (sm SchedMetric) String() string {
+	return fmt.Sprintf(
+		"ContextSwitches: %.2f\nInterrupts: %.2f\nSoftIrqs: %.2f\nForks: %.2f\n"+
+			"ProcsRunning: %d\nProcsBlocked: %d\nThreads: %d\nTimeInterval: %.2f\nTimeStamp: %v",
+		sm.ContextSwitches, sm.Interrupts, sm.SoftIrqs, sm.Forks,
+		sm.ProcsRunning, sm.ProcsBlocked, sm.Threads, sm.TimeInterval, sm.TimeStamp,
+	)
+}
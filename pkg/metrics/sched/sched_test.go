@@ -0,0 +1,93 @@
+package sched
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/travis-james/system-monitor/pkg/metrics"
+)
+
+// fixtureStat returns a statFunc that reads testdata/start/stat on the first
+// call and testdata/end/stat after, as if time had passed between them.
+func fixtureStat() statFunc {
+	calls := 0
+	return func() (procStat, error) {
+		calls++
+		if calls == 1 {
+			return procStatReader("testdata/start")()
+		}
+		return procStatReader("testdata/end")()
+	}
+}
+
+func TestMeasureSchedMetrics(t *testing.T) {
+	t.Parallel()
+	got, err := measureSchedMetrics(fixtureStat(), procLoadavgReader("testdata/end"), 0.5)
+	require.Nil(t, err)
+	assert.Equal(t, 20000.0, got.ContextSwitches)
+	assert.Equal(t, 4000.0, got.Interrupts)
+	assert.Equal(t, 2000.0, got.SoftIrqs)
+	assert.Equal(t, 40.0, got.Forks)
+	assert.Equal(t, uint64(5), got.ProcsRunning)
+	assert.Equal(t, uint64(1), got.ProcsBlocked)
+	assert.Equal(t, uint64(81), got.Threads)
+	assert.Equal(t, 0.5, got.TimeInterval)
+	assert.NotZero(t, got.TimeStamp)
+}
+
+func TestMeasureSchedMetrics_InvalidDuration(t *testing.T) {
+	t.Parallel()
+	_, err := measureSchedMetrics(fixtureStat(), procLoadavgReader("testdata/end"), 0)
+	assert.ErrorIs(t, err, metrics.ErrInvalidInterval)
+}
+
+func TestMeasureSchedMetrics_Errors(t *testing.T) {
+	t.Parallel()
+	errStat := func() (procStat, error) { return procStat{}, errors.New("mock stat error") }
+	_, err := measureSchedMetrics(errStat, procLoadavgReader("testdata/end"), 0.01)
+	assert.NotNil(t, err)
+
+	_, err = measureSchedMetrics(fixtureStat(), procLoadavgReader("testdata/missing"), 0.01)
+	assert.ErrorIs(t, err, fs.ErrNotExist, "the cause should be kept")
+}
+
+func TestParseStat(t *testing.T) {
+	t.Parallel()
+	got, err := procStatReader("testdata/start")()
+	require.Nil(t, err)
+	expected := procStat{
+		ctxt:         413872,
+		intr:         170893,
+		softirq:      31302,
+		processes:    5578,
+		procsRunning: 2,
+		procsBlocked: 0,
+	}
+	assert.Equal(t, expected, got)
+}
+
+func TestParseStat_MissingFields(t *testing.T) {
+	t.Parallel()
+	_, err := parseStat(strings.NewReader("ctxt 1\nprocesses 2\n"))
+	assert.NotNil(t, err)
+}
+
+func TestParseLoadavgThreads(t *testing.T) {
+	t.Parallel()
+	got, err := parseLoadavgThreads("0.27 0.20 0.10 1/73 5579\n")
+	require.Nil(t, err)
+	assert.Equal(t, uint64(73), got)
+
+	_, err = parseLoadavgThreads("0.27 0.20")
+	assert.NotNil(t, err)
+}
+
+func TestRate_CounterReset(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, 0.0, rate(100, 10, 1))
+	assert.Equal(t, 45.0, rate(10, 100, 2))
+}
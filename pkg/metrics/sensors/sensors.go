@@ -0,0 +1,234 @@
+package sensors
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SensorsMetric contains hardware sensor readings from sysfs. VMs and
+// containers usually have no sensors, in which case every slice is empty
+// and NoSensors returns true.
+type SensorsMetric struct {
+	Temperatures []Temperature
+	Fans         []Fan
+	Throttles    []Throttle
+	TimeStamp    time.Time // Time the measurement was taken.
+}
+
+// Temperature is a single temperature sensor, all values are in degrees
+// Celsius. High and Critical are 0 when the sensor has no such threshold.
+type Temperature struct {
+	Chip     string // hwmon chip name (ex: coretemp) or thermal zone type (ex: x86_pkg_temp).
+	Label    string // Sensor label (ex: Core 0), the sysfs file prefix when there is no label.
+	Current  float64
+	High     float64
+	Critical float64
+}
+
+// Fan is a single fan speed sensor.
+type Fan struct {
+	Chip  string
+	Label string
+	RPM   float64
+}
+
+// Throttle counts how many times a CPU has been thermally throttled since boot.
+type Throttle struct {
+	CPU     int
+	Core    uint64 // Times the core was throttled.
+	Package uint64 // Times the package (socket) the core is in was throttled.
+}
+
+// MeasureSensorsMetrics is the public wrapper for measureSensorsMetrics,
+// reading the live /sys.
+func MeasureSensorsMetrics() (SensorsMetric, error) {
+	return measureSensorsMetrics("/sys")
+}
+
+// measureSensorsMetrics reads hwmon, thermal zones and CPU thermal throttle
+// counts under sysRoot. Missing directories aren't an error, they mean the
+// system has no such sensors.
+func measureSensorsMetrics(sysRoot string) (SensorsMetric, error) {
+	temps, fans := readHwmon(sysRoot)
+	return SensorsMetric{
+		Temperatures: append(temps, readThermalZones(sysRoot)...),
+		Fans:         fans,
+		Throttles:    readThrottles(sysRoot),
+		TimeStamp:    time.Now(),
+	}, nil
+}
+
+// readHwmon reads every temp*_input and fan*_input of every hwmon chip. Some
+// drivers put their files in the chip's device directory instead.
+func readHwmon(sysRoot string) ([]Temperature, []Fan) {
+	chips, _ := filepath.Glob(filepath.Join(sysRoot, "class/hwmon/hwmon*"))
+	sort.Strings(chips)
+	var (
+		temps []Temperature
+		fans  []Fan
+	)
+	for _, chip := range chips {
+		dir := chip
+		if _, err := os.Stat(filepath.Join(dir, "name")); err != nil {
+			dir = filepath.Join(chip, "device")
+		}
+		name := readString(filepath.Join(dir, "name"))
+		if name == "" {
+			name = filepath.Base(chip)
+		}
+
+		inputs, _ := filepath.Glob(filepath.Join(dir, "temp*_input"))
+		sort.Strings(inputs)
+		for _, input := range inputs {
+			prefix := strings.TrimSuffix(filepath.Base(input), "_input")
+			current, err := readMilli(input)
+			if err != nil {
+				// Sensors that aren't connected fail to read (ex: EIO,
+				// ENODATA), skip them.
+				continue
+			}
+			temp := Temperature{Chip: name, Label: label(dir, prefix), Current: current}
+			temp.High, _ = readMilli(filepath.Join(dir, prefix+"_max"))
+			temp.Critical, _ = readMilli(filepath.Join(dir, prefix+"_crit"))
+			temps = append(temps, temp)
+		}
+
+		inputs, _ = filepath.Glob(filepath.Join(dir, "fan*_input"))
+		sort.Strings(inputs)
+		for _, input := range inputs {
+			prefix := strings.TrimSuffix(filepath.Base(input), "_input")
+			rpm, err := readFloat(input)
+			if err != nil {
+				continue
+			}
+			fans = append(fans, Fan{Chip: name, Label: label(dir, prefix), RPM: rpm})
+		}
+	}
+	return temps, fans
+}
+
+// readThermalZones reads every thermal zone, using its hot (or passive) and
+// critical trip points as the High and Critical thresholds.
+func readThermalZones(sysRoot string) []Temperature {
+	zones, _ := filepath.Glob(filepath.Join(sysRoot, "class/thermal/thermal_zone*"))
+	sort.Strings(zones)
+	var temps []Temperature
+	for _, zone := range zones {
+		current, err := readMilli(filepath.Join(zone, "temp"))
+		if err != nil {
+			// Zones that are disabled fail to read, skip them.
+			continue
+		}
+		temp := Temperature{
+			Chip:    readString(filepath.Join(zone, "type")),
+			Label:   filepath.Base(zone),
+			Current: current,
+		}
+		tripTypes, _ := filepath.Glob(filepath.Join(zone, "trip_point_*_type"))
+		for _, tripType := range tripTypes {
+			tripTemp, err := readMilli(strings.TrimSuffix(tripType, "_type") + "_temp")
+			if err != nil {
+				continue
+			}
+			switch readString(tripType) {
+			case "critical":
+				temp.Critical = tripTemp
+			case "hot":
+				temp.High = tripTemp
+			case "passive":
+				if temp.High == 0 {
+					temp.High = tripTemp
+				}
+			}
+		}
+		temps = append(temps, temp)
+	}
+	return temps
+}
+
+// readThrottles reads the thermal throttle counts of every CPU, skipping the
+// ones that can't be read.
+func readThrottles(sysRoot string) []Throttle {
+	dirs, _ := filepath.Glob(filepath.Join(sysRoot, "devices/system/cpu/cpu[0-9]*/thermal_throttle"))
+	var throttles []Throttle
+	for _, dir := range dirs {
+		cpu, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(filepath.Dir(dir)), "cpu"))
+		if err != nil {
+			continue
+		}
+		core, err := readFloat(filepath.Join(dir, "core_throttle_count"))
+		if err != nil {
+			continue
+		}
+		pkg, err := readFloat(filepath.Join(dir, "package_throttle_count"))
+		if err != nil {
+			continue
+		}
+		throttles = append(throttles, Throttle{CPU: cpu, Core: uint64(core), Package: uint64(pkg)})
+	}
+	sort.Slice(throttles, func(i, j int) bool { return throttles[i].CPU < throttles[j].CPU })
+	return throttles
+}
+
+// label returns the contents of prefix_label in dir, or prefix when there is none.
+func label(dir, prefix string) string {
+	if l := readString(filepath.Join(dir, prefix+"_label")); l != "" {
+		return l
+	}
+	return prefix
+}
+
+func readString(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func readFloat(path string) (float64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseFloat(strings.TrimSpace(string(data)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	return v, nil
+}
+
+// readMilli reads a sysfs value given in thousandths, ex: millidegrees Celsius.
+func readMilli(path string) (float64, error) {
+	v, err := readFloat(path)
+	return v / 1000, err
+}
+
+// NoSensors returns true when no sensor of any kind was found.
+func (sm SensorsMetric) NoSensors() bool {
+	return len(sm.Temperatures) == 0 && len(sm.Fans) == 0 && len(sm.Throttles) == 0
+}
+
+// String returns a string representation of SensorsMetric.
+func (sm SensorsMetric) String() string {
+	if sm.NoSensors() {
+		return fmt.Sprintf("no sensors\nTimeStamp: %v", sm.TimeStamp)
+	}
+	var sb strings.Builder
+	for _, t := range sm.Temperatures {
+		fmt.Fprintf(&sb, "Temperature: %s %s %.1fC (high %.1fC, critical %.1fC)\n", t.Chip, t.Label, t.Current, t.High, t.Critical)
+	}
+	for _, f := range sm.Fans {
+		fmt.Fprintf(&sb, "Fan: %s %s %.0f RPM\n", f.Chip, f.Label, f.RPM)
+	}
+	for _, t := range sm.Throttles {
+		fmt.Fprintf(&sb, "Throttle: cpu%d core %d package %d\n", t.CPU, t.Core, t.Package)
+	}
+	fmt.Fprintf(&sb, "TimeStamp: %v", sm.TimeStamp)
+	return sb.String()
+}
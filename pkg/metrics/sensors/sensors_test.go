@@ -0,0 +1,56 @@
+package sensors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMeasureSensorsMetrics(t *testing.T) {
+	t.Parallel()
+	got, err := measureSensorsMetrics("testdata/sys")
+	require.Nil(t, err)
+	// temp2 and fan3 of nct6775 can't be read, so they are skipped.
+	expectedTemps := []Temperature{
+		{Chip: "coretemp", Label: "Package id 0", Current: 45, High: 80, Critical: 100},
+		{Chip: "coretemp", Label: "Core 0", Current: 43.5, High: 80, Critical: 100},
+		{Chip: "nct6775", Label: "temp1", Current: 38},
+		{Chip: "x86_pkg_temp", Label: "thermal_zone0", Current: 46, High: 85, Critical: 105},
+	}
+	assert.Equal(t, expectedTemps, got.Temperatures)
+	expectedFans := []Fan{
+		{Chip: "nct6775", Label: "CPU fan", RPM: 1250},
+		{Chip: "nct6775", Label: "fan2", RPM: 0},
+	}
+	assert.Equal(t, expectedFans, got.Fans)
+	// cpu2's core_throttle_count can't be parsed, only it is skipped.
+	expectedThrottles := []Throttle{
+		{CPU: 0, Core: 3, Package: 7},
+		{CPU: 1, Core: 0, Package: 7},
+	}
+	assert.Equal(t, expectedThrottles, got.Throttles)
+	assert.False(t, got.NoSensors())
+	assert.NotZero(t, got.TimeStamp)
+}
+
+func TestMeasureSensorsMetrics_NoSensors(t *testing.T) {
+	t.Parallel()
+	got, err := measureSensorsMetrics(t.TempDir())
+	require.Nil(t, err)
+	assert.True(t, got.NoSensors())
+	assert.Contains(t, got.String(), "no sensors")
+}
+
+func TestString(t *testing.T) {
+	t.Parallel()
+	sm := SensorsMetric{
+		Temperatures: []Temperature{{Chip: "coretemp", Label: "Core 0", Current: 43.5, High: 80, Critical: 100}},
+		Fans:         []Fan{{Chip: "nct6775", Label: "CPU fan", RPM: 1250}},
+		Throttles:    []Throttle{{CPU: 0, Core: 3, Package: 7}},
+	}
+	s := sm.String()
+	assert.Contains(t, s, "Temperature: coretemp Core 0 43.5C (high 80.0C, critical 100.0C)")
+	assert.Contains(t, s, "Fan: nct6775 CPU fan 1250 RPM")
+	assert.Contains(t, s, "Throttle: cpu0 core 3 package 7")
+}
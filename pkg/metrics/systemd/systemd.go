@@ -0,0 +1,231 @@
+package systemd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/travis-james/system-monitor/pkg/metrics"
+)
+
+// properties are the unit properties SystemdMetric is built from.
+var properties = []string{
+	"Id", "ActiveState", "SubState", "NRestarts", "StateChangeTimestamp", "ControlGroup",
+	"CPUUsageNSec", "MemoryCurrent", "TasksCurrent", "IOReadBytes", "IOWriteBytes",
+}
+
+// timestampLayout is how systemctl shows timestamps, ex: Mon 2024-01-01 12:00:00 UTC.
+const timestampLayout = "Mon 2006-01-02 15:04:05 MST"
+
+// Manager gets the state of units from systemd.
+type Manager interface {
+	// ListUnits returns the names of the loaded service units.
+	ListUnits() ([]string, error)
+	// ShowUnits returns the given properties of each unit, in the same
+	// order as names.
+	ShowUnits(names, properties []string) ([]map[string]string, error)
+}
+
+// SystemdMetric is the health of systemd units, with their cgroup usage over
+// TimeInterval.
+type SystemdMetric struct {
+	Units        []Unit
+	Failed       []string  // Units in the failed state.
+	TimeInterval float64   // The time interval CPU and IO are taken over.
+	TimeStamp    time.Time // Time the measurement was taken.
+}
+
+// Unit is the state and resource usage of a single unit. Usage is 0 when
+// the unit's accounting is off.
+type Unit struct {
+	Name         string
+	ActiveState  string        // ex: active, inactive, failed, activating.
+	SubState     string        // ex: running, exited, dead, auto-restart.
+	Restarts     uint64        // Times systemd restarted the unit since it was loaded.
+	StateChange  time.Time     // When the unit last changed ActiveState, zero if it never has.
+	SinceChange  time.Duration // Time since StateChange.
+	ControlGroup string        // ex: /system.slice/nginx.service.
+	CPU          float64       // Percent of a single core used by the unit's cgroup.
+	Memory       uint64        // Bytes of memory charged to the unit's cgroup.
+	Tasks        uint64        // Processes and threads in the unit's cgroup.
+	ReadBytes    float64       // Bytes read from storage per second.
+	WriteBytes   float64       // Bytes written to storage per second.
+}
+
+// MeasureSystemdMetrics is the public wrapper for measureSystemdMetrics,
+// asking systemctl. units are the unit names to measure, or every loaded
+// service when empty.
+func MeasureSystemdMetrics(seconds float64, units []string) (SystemdMetric, error) {
+	return measureSystemdMetrics(Systemctl{}, seconds, units)
+}
+
+func measureSystemdMetrics(manager Manager, seconds float64, units []string) (SystemdMetric, error) {
+	if seconds <= 0 {
+		return SystemdMetric{}, metrics.ErrInvalidInterval
+	}
+	if len(units) == 0 {
+		var err error
+		units, err = manager.ListUnits()
+		if err != nil {
+			return SystemdMetric{}, fmt.Errorf("error when listing units: %w", metrics.Classify(err))
+		}
+	}
+	if len(units) == 0 {
+		return SystemdMetric{TimeInterval: seconds, TimeStamp: time.Now()}, nil
+	}
+	start, err := manager.ShowUnits(units, properties)
+	if err != nil {
+		return SystemdMetric{}, fmt.Errorf("error when getting start units: %w", metrics.Classify(err))
+	}
+
+	time.Sleep(time.Duration(seconds * float64(time.Second)))
+
+	end, err := manager.ShowUnits(units, properties)
+	if err != nil {
+		return SystemdMetric{}, fmt.Errorf("error when getting end units: %w", metrics.Classify(err))
+	}
+	if len(start) != len(end) {
+		return SystemdMetric{}, fmt.Errorf("expected %d units, got %d", len(start), len(end))
+	}
+	sm := SystemdMetric{TimeInterval: seconds, TimeStamp: time.Now()}
+	for i, props := range end {
+		unit := Unit{
+			Name:         props["Id"],
+			ActiveState:  props["ActiveState"],
+			SubState:     props["SubState"],
+			Restarts:     counter(props, "NRestarts"),
+			ControlGroup: props["ControlGroup"],
+			Memory:       counter(props, "MemoryCurrent"),
+			Tasks:        counter(props, "TasksCurrent"),
+		}
+		if unit.Name == "" {
+			unit.Name = units[i]
+		}
+		if changed, err := time.Parse(timestampLayout, props["StateChangeTimestamp"]); err == nil {
+			unit.StateChange = changed
+			unit.SinceChange = sm.TimeStamp.Sub(changed)
+		}
+		nsec := rate(counter(start[i], "CPUUsageNSec"), counter(props, "CPUUsageNSec"), seconds)
+		unit.CPU = nsec / float64(time.Second) * 100
+		unit.ReadBytes = rate(counter(start[i], "IOReadBytes"), counter(props, "IOReadBytes"), seconds)
+		unit.WriteBytes = rate(counter(start[i], "IOWriteBytes"), counter(props, "IOWriteBytes"), seconds)
+		if unit.ActiveState == "failed" {
+			sm.Failed = append(sm.Failed, unit.Name)
+		}
+		sm.Units = append(sm.Units, unit)
+	}
+	return sm, nil
+}
+
+// counter returns a numeric property, 0 when it is missing or "[not set]"
+// (the max uint64) because accounting is off.
+func counter(props map[string]string, name string) uint64 {
+	v, err := strconv.ParseUint(props[name], 10, 64)
+	if err != nil || v == math.MaxUint64 {
+		return 0
+	}
+	return v
+}
+
+// rate returns the per second increase of a counter, a counter that went
+// backwards (ex: the unit restarted) counts as no increase.
+func rate(start, end uint64, seconds float64) float64 {
+	if end < start {
+		return 0
+	}
+	return float64(end-start) / seconds
+}
+
+// Systemctl is a Manager that runs systemctl.
+type Systemctl struct{}
+
+// ListUnits runs systemctl list-units for the loaded services.
+func (Systemctl) ListUnits() ([]string, error) {
+	out, err := systemctl("list-units", "--type=service", "--all", "--plain", "--no-legend", "--no-pager")
+	if err != nil {
+		return nil, err
+	}
+	return parseListUnits(bytes.NewReader(out))
+}
+
+// ShowUnits runs systemctl show for the units.
+func (Systemctl) ShowUnits(names, properties []string) ([]map[string]string, error) {
+	args := append([]string{"show", "--no-pager", "--property=" + strings.Join(properties, ",")}, names...)
+	out, err := systemctl(args...)
+	if err != nil {
+		return nil, err
+	}
+	return parseShow(bytes.NewReader(out))
+}
+
+// systemctl runs systemctl with timestamps in UTC, so they can be parsed
+// without knowing the local time zone abbreviations.
+func systemctl(args ...string) ([]byte, error) {
+	cmd := exec.Command("systemctl", args...)
+	cmd.Env = append(os.Environ(), "TZ=UTC", "LC_ALL=C")
+	out, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+		return nil, fmt.Errorf("%w: %s", err, bytes.TrimSpace(exitErr.Stderr))
+	}
+	return out, err
+}
+
+// parseListUnits reads the unit names out of systemctl list-units, ex:
+//
+//	nginx.service loaded active running A high performance web server
+//	● cron.service loaded failed failed Regular background program processing daemon
+func parseListUnits(r io.Reader) ([]string, error) {
+	var units []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(strings.TrimPrefix(strings.TrimSpace(scanner.Text()), "●"))
+		if len(fields) > 0 {
+			units = append(units, fields[0])
+		}
+	}
+	return units, scanner.Err()
+}
+
+// parseShow reads the Key=Value properties of systemctl show, with a blank
+// line between units.
+func parseShow(r io.Reader) ([]map[string]string, error) {
+	var units []map[string]string
+	var props map[string]string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			props = nil
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		if props == nil {
+			props = make(map[string]string)
+			units = append(units, props)
+		}
+		props[key] = value
+	}
+	return units, scanner.Err()
+}
+
+// String returns a string representation of SystemdMetric.
+func (sm SystemdMetric) String() string {
+	var sb strings.Builder
+	for _, u := range sm.Units {
+		fmt.Fprintf(&sb, "Unit %s: %s/%s restarts %d since %v cpu %.2f%% memory %d tasks %d read %.2f/s write %.2f/s\n",
+			u.Name, u.ActiveState, u.SubState, u.Restarts, u.SinceChange.Round(time.Second),
+			u.CPU, u.Memory, u.Tasks, u.ReadBytes, u.WriteBytes)
+	}
+	fmt.Fprintf(&sb, "Failed: %s\nTimeInterval: %.2f\nTimeStamp: %v", strings.Join(sm.Failed, ", "), sm.TimeInterval, sm.TimeStamp)
+	return sb.String()
+}
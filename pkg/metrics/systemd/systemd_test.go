@@ -0,0 +1,155 @@
+package systemd
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/travis-james/system-monitor/pkg/metrics"
+)
+
+// fakeManager is a Manager that reads testdata/list-units, then
+// testdata/show-start on the first ShowUnits and testdata/show-end after, as
+// if time had passed between them.
+type fakeManager struct {
+	calls   int
+	listErr error
+	showErr error
+}
+
+func (fm *fakeManager) ListUnits() ([]string, error) {
+	if fm.listErr != nil {
+		return nil, fm.listErr
+	}
+	f, err := os.Open("testdata/list-units")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseListUnits(f)
+}
+
+func (fm *fakeManager) ShowUnits(names, properties []string) ([]map[string]string, error) {
+	if fm.showErr != nil {
+		return nil, fm.showErr
+	}
+	fm.calls++
+	path := "testdata/show-start"
+	if fm.calls > 1 {
+		path = "testdata/show-end"
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	units, err := parseShow(f)
+	if err != nil {
+		return nil, err
+	}
+	var shown []map[string]string
+	for _, name := range names {
+		i := slices.IndexFunc(units, func(props map[string]string) bool { return props["Id"] == name })
+		if i < 0 {
+			shown = append(shown, map[string]string{"Id": name, "ActiveState": "inactive", "SubState": "dead"})
+			continue
+		}
+		shown = append(shown, units[i])
+	}
+	return shown, nil
+}
+
+func TestMeasureSystemdMetrics(t *testing.T) {
+	t.Parallel()
+	got, err := measureSystemdMetrics(&fakeManager{}, 0.5, nil)
+	require.Nil(t, err)
+	require.Len(t, got.Units, 3)
+
+	nginx := got.Units[0]
+	assert.Equal(t, "nginx.service", nginx.Name)
+	assert.Equal(t, "active", nginx.ActiveState)
+	assert.Equal(t, "running", nginx.SubState)
+	assert.Equal(t, "/system.slice/nginx.service", nginx.ControlGroup)
+	assert.Equal(t, 100.0, nginx.CPU)
+	assert.Equal(t, uint64(52428800), nginx.Memory)
+	assert.Equal(t, uint64(5), nginx.Tasks)
+	assert.Equal(t, 8000.0, nginx.ReadBytes)
+	assert.Zero(t, nginx.WriteBytes, "unset counters should count as 0")
+	changed := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	assert.True(t, changed.Equal(nginx.StateChange))
+	assert.Equal(t, got.TimeStamp.Sub(changed), nginx.SinceChange)
+
+	cron := got.Units[1]
+	assert.Equal(t, uint64(3), cron.Restarts)
+	assert.Zero(t, cron.CPU)
+	assert.Zero(t, cron.Memory)
+	assert.Zero(t, cron.Tasks)
+
+	journald := got.Units[2]
+	assert.InDelta(t, 20.0, journald.CPU, 1e-9)
+	assert.Equal(t, 4000.0, journald.WriteBytes)
+	assert.Zero(t, journald.StateChange)
+	assert.Zero(t, journald.SinceChange)
+
+	assert.Equal(t, []string{"cron.service"}, got.Failed)
+	assert.Equal(t, 0.5, got.TimeInterval)
+	assert.NotZero(t, got.TimeStamp)
+}
+
+func TestMeasureSystemdMetrics_Units(t *testing.T) {
+	t.Parallel()
+	fm := &fakeManager{listErr: errors.New("units shouldn't be listed when they are given")}
+	got, err := measureSystemdMetrics(fm, 0.01, []string{"nginx.service", "missing.service"})
+	require.Nil(t, err)
+	require.Len(t, got.Units, 2)
+	assert.Equal(t, "nginx.service", got.Units[0].Name)
+	assert.Equal(t, "missing.service", got.Units[1].Name)
+	assert.Equal(t, "inactive", got.Units[1].ActiveState)
+	assert.Empty(t, got.Failed)
+}
+
+func TestMeasureSystemdMetrics_Errors(t *testing.T) {
+	t.Parallel()
+	_, err := measureSystemdMetrics(&fakeManager{}, 0, nil)
+	assert.ErrorIs(t, err, metrics.ErrInvalidInterval)
+
+	_, err = measureSystemdMetrics(&fakeManager{listErr: errors.New("mock list error")}, 0.01, nil)
+	assert.ErrorContains(t, err, "mock list error")
+
+	_, err = measureSystemdMetrics(&fakeManager{showErr: errors.New("mock show error")}, 0.01, nil)
+	assert.ErrorContains(t, err, "mock show error")
+}
+
+func TestParseListUnits(t *testing.T) {
+	t.Parallel()
+	f, err := os.Open("testdata/list-units")
+	require.Nil(t, err)
+	defer f.Close()
+	got, err := parseListUnits(f)
+	require.Nil(t, err)
+	assert.Equal(t, []string{"nginx.service", "cron.service", "systemd-journald.service"}, got)
+}
+
+func TestParseShow(t *testing.T) {
+	t.Parallel()
+	got, err := parseShow(strings.NewReader("Id=a.service\nExecStart={ path=/bin/a ; argv[]=/bin/a --x=1 }\n\n\nId=b.service\n"))
+	require.Nil(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, "{ path=/bin/a ; argv[]=/bin/a --x=1 }", got[0]["ExecStart"])
+	assert.Equal(t, "b.service", got[1]["Id"])
+}
+
+func TestString(t *testing.T) {
+	t.Parallel()
+	s := SystemdMetric{
+		Units:  []Unit{{Name: "cron.service", ActiveState: "failed", SubState: "failed", Restarts: 3, SinceChange: 90 * time.Second}},
+		Failed: []string{"cron.service"},
+	}.String()
+	assert.Contains(t, s, "Unit cron.service: failed/failed restarts 3 since 1m30s")
+	assert.Contains(t, s, "Failed: cron.service\n")
+}
@@ -0,0 +1,242 @@
+package vmstat
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/travis-james/system-monitor/pkg/metrics"
+)
+
+// requiredFields must be in /proc/vmstat, the rest of the fields VmstatMetric
+// uses depend on the kernel version and config and count as 0 when missing.
+var requiredFields = []string{"pgfault", "pgmajfault", "pgpgin", "pgpgout", "pswpin", "pswpout"}
+
+// oomKilled matches the kernel log line of an OOM kill, ex:
+//
+//	Out of memory: Killed process 1234 (stress) total-vm:1000kB, anon-rss:900kB, ...
+var oomKilled = regexp.MustCompile(`Killed process (\d+) \(([^)]*)\)(?:.*anon-rss:(\d+)kB)?`)
+
+// VmstatMetric contains memory pressure counters from /proc/vmstat as per
+// second rates over TimeInterval.
+type VmstatMetric struct {
+	MajorFaults    float64     // Page faults that needed disk IO per second.
+	MinorFaults    float64     // Page faults served from memory per second.
+	PageIns        float64     // KiB paged in from disk per second.
+	PageOuts       float64     // KiB paged out to disk per second.
+	SwapIns        float64     // Pages swapped in per second.
+	SwapOuts       float64     // Pages swapped out per second.
+	DirectReclaims float64     // Allocations that stalled to reclaim memory themselves per second.
+	CompactStalls  float64     // Allocations that stalled to compact memory per second.
+	OomKills       uint64      // Processes killed by the OOM killer during the interval.
+	OomVictims     []OomVictim // The processes killed, when the kernel log could be read.
+	TimeInterval   float64     // The time interval rates are taken over.
+	TimeStamp      time.Time   // Time the measurement was taken.
+}
+
+// OomVictim is a process killed by the OOM killer.
+type OomVictim struct {
+	Pid     int
+	Comm    string
+	AnonRSS uint64 // KiB of anonymous memory the process had.
+}
+
+// MeasureVmstatMetrics is the public wrapper for measureVmstatMetrics,
+// reading the live /proc/vmstat and /dev/kmsg.
+func MeasureVmstatMetrics(seconds float64) (VmstatMetric, error) {
+	return measureVmstatMetrics(procVmstatReader("/proc"), kmsgReader("/dev/kmsg"), seconds)
+}
+
+// vmstatFunc is dependency injection for measureVmstatMetrics to read the
+// counters of /proc/vmstat.
+type vmstatFunc func() (map[string]uint64, error)
+
+// kmsgFunc is dependency injection for measureVmstatMetrics to read the
+// messages in the kernel log, oldest first.
+type kmsgFunc func() ([]string, error)
+
+// procVmstatReader returns a vmstatFunc that parses vmstat under procRoot.
+func procVmstatReader(procRoot string) vmstatFunc {
+	return func() (map[string]uint64, error) {
+		f, err := os.Open(filepath.Join(procRoot, "vmstat"))
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return parseVmstat(f)
+	}
+}
+
+// kmsgReader returns a kmsgFunc that reads the records in path, in the
+// /dev/kmsg format "priority,sequence,timestamp,flags;message". /dev/kmsg is
+// read with raw non-blocking reads, one record each, until EAGAIN at the
+// newest record. An *os.File would wait in the runtime poller for the next
+// kernel message instead.
+func kmsgReader(path string) kmsgFunc {
+	return func() ([]string, error) {
+		fd, err := syscall.Open(path, syscall.O_RDONLY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+		if err != nil {
+			return nil, &os.PathError{Op: "open", Path: path, Err: err}
+		}
+		defer syscall.Close(fd)
+		var (
+			log bytes.Buffer
+			buf = make([]byte, 8192) // Larger than a record, the kernel fails reads that can't hold one.
+		)
+		for {
+			n, err := syscall.Read(fd, buf)
+			if errors.Is(err, syscall.EAGAIN) || (err == nil && n == 0) {
+				break
+			}
+			// EPIPE is for records overwritten since the last read, the
+			// next read carries on from the oldest one left.
+			if errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.EINTR) {
+				continue
+			}
+			if err != nil {
+				return parseKmsg(&log), &os.PathError{Op: "read", Path: path, Err: err}
+			}
+			log.Write(buf[:n])
+		}
+		return parseKmsg(&log), nil
+	}
+}
+
+// parseKmsg returns the messages of the kernel log records in r.
+func parseKmsg(r io.Reader) []string {
+	var msgs []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// Lines starting with a space are key=value details of the record
+		// before them.
+		_, msg, found := strings.Cut(scanner.Text(), ";")
+		if found && !strings.HasPrefix(scanner.Text(), " ") {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs
+}
+
+func measureVmstatMetrics(readVmstat vmstatFunc, readKmsg kmsgFunc, seconds float64) (VmstatMetric, error) {
+	if seconds <= 0 {
+		return VmstatMetric{}, metrics.ErrInvalidInterval
+	}
+	start, err := readVmstat()
+	if err != nil {
+		return VmstatMetric{}, fmt.Errorf("error when getting start vmstat: %w", metrics.Classify(err))
+	}
+
+	time.Sleep(time.Duration(seconds * float64(time.Second)))
+
+	end, err := readVmstat()
+	if err != nil {
+		return VmstatMetric{}, fmt.Errorf("error when getting end vmstat: %w", metrics.Classify(err))
+	}
+	for _, field := range requiredFields {
+		if _, exists := end[field]; !exists {
+			return VmstatMetric{}, fmt.Errorf("%s is missing from vmstat", field)
+		}
+	}
+	majorFaults := rate(start["pgmajfault"], end["pgmajfault"], seconds)
+	vm := VmstatMetric{
+		MajorFaults:    majorFaults,
+		MinorFaults:    rate(start["pgfault"], end["pgfault"], seconds) - majorFaults,
+		PageIns:        rate(start["pgpgin"], end["pgpgin"], seconds),
+		PageOuts:       rate(start["pgpgout"], end["pgpgout"], seconds),
+		SwapIns:        rate(start["pswpin"], end["pswpin"], seconds),
+		SwapOuts:       rate(start["pswpout"], end["pswpout"], seconds),
+		DirectReclaims: rate(allocStalls(start), allocStalls(end), seconds),
+		CompactStalls:  rate(start["compact_stall"], end["compact_stall"], seconds),
+		TimeInterval:   seconds,
+		TimeStamp:      time.Now(),
+	}
+	if end["oom_kill"] > start["oom_kill"] {
+		vm.OomKills = end["oom_kill"] - start["oom_kill"]
+		// The kernel log often can't be read without privileges, the
+		// count of kills is still worth reporting without the victims.
+		if msgs, err := readKmsg(); err == nil {
+			vm.OomVictims = lastOomVictims(msgs, int(vm.OomKills))
+		}
+	}
+	return vm, nil
+}
+
+// allocStalls sums the direct reclaim stalls, split by memory zone since
+// Linux 4.10 (allocstall_normal, allocstall_movable, ...).
+func allocStalls(vmstat map[string]uint64) uint64 {
+	var total uint64
+	for field, v := range vmstat {
+		if field == "allocstall" || strings.HasPrefix(field, "allocstall_") {
+			total += v
+		}
+	}
+	return total
+}
+
+// lastOomVictims returns up to n of the most recent OOM kills in msgs,
+// oldest first.
+func lastOomVictims(msgs []string, n int) []OomVictim {
+	var victims []OomVictim
+	for i := len(msgs) - 1; i >= 0 && len(victims) < n; i-- {
+		match := oomKilled.FindStringSubmatch(msgs[i])
+		if match == nil {
+			continue
+		}
+		pid, _ := strconv.Atoi(match[1])
+		anonRSS, _ := strconv.ParseUint(match[3], 10, 64)
+		victims = append([]OomVictim{{Pid: pid, Comm: match[2], AnonRSS: anonRSS}}, victims...)
+	}
+	return victims
+}
+
+// rate returns the per second increase of a counter, a counter that went
+// backwards (ex: wrapped) counts as no increase.
+func rate(start, end uint64, seconds float64) float64 {
+	if end < start {
+		return 0
+	}
+	return float64(end-start) / seconds
+}
+
+// parseVmstat reads the "name value" lines of /proc/vmstat.
+func parseVmstat(r io.Reader) (map[string]uint64, error) {
+	vmstat := make(map[string]uint64)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.Fields(scanner.Text())
+		if len(line) != 2 {
+			continue
+		}
+		v, err := strconv.ParseUint(line[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing %s: %w", line[0], err)
+		}
+		vmstat[line[0]] = v
+	}
+	return vmstat, scanner.Err()
+}
+
+// String returns a string representation of VmstatMetric.
+func (vm VmstatMetric) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb,
+		"MajorFaults: %.2f\nMinorFaults: %.2f\nPageIns: %.2f\nPageOuts: %.2f\nSwapIns: %.2f\nSwapOuts: %.2f\n"+
+			"DirectReclaims: %.2f\nCompactStalls: %.2f\nOomKills: %d\n",
+		vm.MajorFaults, vm.MinorFaults, vm.PageIns, vm.PageOuts, vm.SwapIns, vm.SwapOuts,
+		vm.DirectReclaims, vm.CompactStalls, vm.OomKills,
+	)
+	for _, victim := range vm.OomVictims {
+		fmt.Fprintf(&sb, "OomVictim: %s(%d) anon-rss %d KiB\n", victim.Comm, victim.Pid, victim.AnonRSS)
+	}
+	fmt.Fprintf(&sb, "TimeInterval: %.2f\nTimeStamp: %v", vm.TimeInterval, vm.TimeStamp)
+	return sb.String()
+}
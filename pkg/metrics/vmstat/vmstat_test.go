@@ -0,0 +1,135 @@
+package vmstat
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/travis-james/system-monitor/pkg/metrics"
+)
+
+// fixtureVmstat returns a vmstatFunc that reads testdata/start/vmstat on the
+// first call and testdata/end/vmstat after, as if time had passed between
+// them.
+func fixtureVmstat() vmstatFunc {
+	calls := 0
+	return func() (map[string]uint64, error) {
+		calls++
+		if calls == 1 {
+			return procVmstatReader("testdata/start")()
+		}
+		return procVmstatReader("testdata/end")()
+	}
+}
+
+func TestMeasureVmstatMetrics(t *testing.T) {
+	t.Parallel()
+	got, err := measureVmstatMetrics(fixtureVmstat(), kmsgReader("testdata/kmsg"), 0.5)
+	require.Nil(t, err)
+	assert.Equal(t, 200.0, got.MajorFaults)
+	assert.Equal(t, 3800.0, got.MinorFaults)
+	assert.Equal(t, 1000.0, got.PageIns)
+	assert.Equal(t, 2000.0, got.PageOuts)
+	assert.Equal(t, 20.0, got.SwapIns)
+	assert.Equal(t, 100.0, got.SwapOuts)
+	assert.Equal(t, 10.0, got.DirectReclaims, "allocstall should be summed across zones")
+	assert.Equal(t, 2.0, got.CompactStalls)
+	assert.Equal(t, uint64(2), got.OomKills)
+	assert.Equal(t, []OomVictim{
+		{Pid: 4242, Comm: "stress", AnonRSS: 8000000},
+		{Pid: 4343, Comm: "java", AnonRSS: 2097152},
+	}, got.OomVictims, "only the kills during the interval should be reported")
+	assert.Equal(t, 0.5, got.TimeInterval)
+	assert.NotZero(t, got.TimeStamp)
+}
+
+func TestMeasureVmstatMetrics_NoKmsg(t *testing.T) {
+	t.Parallel()
+	got, err := measureVmstatMetrics(fixtureVmstat(), kmsgReader("testdata/missing"), 0.01)
+	require.Nil(t, err)
+	assert.Equal(t, uint64(2), got.OomKills, "kills should be counted even when the victims are unknown")
+	assert.Empty(t, got.OomVictims)
+}
+
+func TestMeasureVmstatMetrics_NoOomKills(t *testing.T) {
+	t.Parallel()
+	readKmsg := func() ([]string, error) {
+		t.Error("the kernel log shouldn't be read without OOM kills")
+		return nil, nil
+	}
+	got, err := measureVmstatMetrics(procVmstatReader("testdata/end"), readKmsg, 0.01)
+	require.Nil(t, err)
+	assert.Zero(t, got.OomKills)
+	assert.Zero(t, got.MajorFaults)
+}
+
+func TestMeasureVmstatMetrics_Errors(t *testing.T) {
+	t.Parallel()
+	_, err := measureVmstatMetrics(fixtureVmstat(), kmsgReader("testdata/kmsg"), 0)
+	assert.ErrorIs(t, err, metrics.ErrInvalidInterval)
+
+	errVmstat := func() (map[string]uint64, error) { return nil, fs.ErrPermission }
+	_, err = measureVmstatMetrics(errVmstat, kmsgReader("testdata/kmsg"), 0.01)
+	assert.ErrorIs(t, err, metrics.ErrPermission)
+
+	partial := func() (map[string]uint64, error) { return map[string]uint64{"pgfault": 1}, nil }
+	_, err = measureVmstatMetrics(partial, kmsgReader("testdata/kmsg"), 0.01)
+	assert.ErrorContains(t, err, "pgmajfault is missing")
+}
+
+func TestParseVmstat(t *testing.T) {
+	t.Parallel()
+	got, err := parseVmstat(strings.NewReader("pgfault 10\noom_kill 2\n\n"))
+	require.Nil(t, err)
+	assert.Equal(t, map[string]uint64{"pgfault": 10, "oom_kill": 2}, got)
+
+	_, err = parseVmstat(strings.NewReader("pgfault lots\n"))
+	assert.NotNil(t, err)
+}
+
+func TestKmsgReader(t *testing.T) {
+	t.Parallel()
+	got, err := kmsgReader("testdata/kmsg")()
+	require.Nil(t, err)
+	require.Len(t, got, 5, "continuation lines should be skipped")
+	assert.Equal(t, "eth0: link up", got[1])
+}
+
+func TestKmsgReader_EndOfLog(t *testing.T) {
+	t.Parallel()
+	// A FIFO with a writer left open has no end, like /dev/kmsg, so reading
+	// it only stops when the reader returns at EAGAIN.
+	path := filepath.Join(t.TempDir(), "kmsg")
+	require.Nil(t, syscall.Mkfifo(path, 0o600))
+	writer, err := os.OpenFile(path, os.O_RDWR, 0)
+	require.Nil(t, err)
+	defer writer.Close()
+	_, err = writer.WriteString("6,1,100,-;eth0: link up\n")
+	require.Nil(t, err)
+
+	done := make(chan []string)
+	go func() {
+		msgs, err := kmsgReader(path)()
+		assert.Nil(t, err)
+		done <- msgs
+	}()
+	select {
+	case got := <-done:
+		assert.Equal(t, []string{"eth0: link up"}, got)
+	case <-time.After(2 * time.Second):
+		t.Fatal("reading the kernel log blocked at its end")
+	}
+}
+
+func TestString(t *testing.T) {
+	t.Parallel()
+	s := VmstatMetric{OomKills: 1, OomVictims: []OomVictim{{Pid: 4242, Comm: "stress", AnonRSS: 100}}}.String()
+	assert.Contains(t, s, "OomKills: 1\n")
+	assert.Contains(t, s, "OomVictim: stress(4242) anon-rss 100 KiB\n")
+}
@@ -0,0 +1,126 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/travis-james/system-monitor/pkg/snapshot"
+)
+
+// sparkBars are the levels of a Sparkline, lowest first.
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// DefaultSparkWidth is the widest Sparkline WriteTable draws.
+const DefaultSparkWidth = 40
+
+// Point is one value of a timeline, Offset seconds after the report started.
+type Point struct {
+	Offset float64
+	Value  float64
+}
+
+// Summary is the statistics and timeline of one series over a report.
+type Summary struct {
+	Measurement string            // ex: cpu, disk, memory.
+	Field       string            // ex: usage, load1.
+	Tags        map[string]string `json:",omitempty"` // ex: core, device, the snapshot labels are left out.
+	Min         float64
+	Avg         float64
+	Max         float64
+	P95         float64
+	Timeline    []Point
+}
+
+// Report summarizes the snapshots collected over a run.
+type Report struct {
+	Start     time.Time
+	End       time.Time
+	Snapshots int
+	Summaries []Summary
+}
+
+// Summarize builds a Report of snaps, which should be in time order.
+func Summarize(snaps []snapshot.Snapshot) Report {
+	var r Report
+	if len(snaps) == 0 {
+		return r
+	}
+	r.Start, r.End, r.Snapshots = snaps[0].TimeStamp, snaps[len(snaps)-1].TimeStamp, len(snaps)
+	index := make(map[string]int)
+	for _, snap := range snaps {
+		offset := snap.TimeStamp.Sub(r.Start).Seconds()
+		for _, sample := range snap.Metrics() {
+			i, ok := index[sample.Name()]
+			if !ok {
+				i = len(r.Summaries)
+				index[sample.Name()] = i
+				r.Summaries = append(r.Summaries, Summary{Measurement: sample.Measurement, Field: sample.Field, Tags: sample.Tags})
+			}
+			r.Summaries[i].Timeline = append(r.Summaries[i].Timeline, Point{Offset: offset, Value: sample.Value})
+		}
+	}
+	for i := range r.Summaries {
+		r.Summaries[i].summarize()
+	}
+	return r
+}
+
+// summarize fills in the statistics from the timeline. P95 is the nearest
+// rank percentile.
+func (s *Summary) summarize() {
+	values := make([]float64, len(s.Timeline))
+	var sum float64
+	for i, p := range s.Timeline {
+		values[i] = p.Value
+		sum += p.Value
+	}
+	slices.Sort(values)
+	s.Min, s.Max = values[0], values[len(values)-1]
+	s.Avg = sum / float64(len(values))
+	s.P95 = values[int(math.Ceil(0.95*float64(len(values))))-1]
+}
+
+// Name is the measurement, field and tags of s, ex: cpu.usage{core=0}.
+func (s Summary) Name() string {
+	return snapshot.Sample{Measurement: s.Measurement, Field: s.Field, Tags: s.Tags}.Name()
+}
+
+// Sparkline draws the timeline scaled between Min and Max, averaging
+// neighbouring points so it is at most width runes wide.
+func (s Summary) Sparkline(width int) string {
+	n := len(s.Timeline)
+	if n == 0 || width <= 0 {
+		return ""
+	}
+	buckets := min(n, width)
+	var b strings.Builder
+	for i := range buckets {
+		from, to := i*n/buckets, (i+1)*n/buckets
+		var sum float64
+		for _, p := range s.Timeline[from:to] {
+			sum += p.Value
+		}
+		level := 0
+		if s.Max > s.Min {
+			level = int((sum/float64(to-from) - s.Min) / (s.Max - s.Min) * float64(len(sparkBars)-1))
+		}
+		b.WriteRune(sparkBars[level])
+	}
+	return b.String()
+}
+
+// WriteTable writes the report as a table with one row per series.
+func WriteTable(w io.Writer, r Report) error {
+	fmt.Fprintf(w, "%d snapshots over %v from %s\n", r.Snapshots, r.End.Sub(r.Start).Round(time.Millisecond), r.Start.Format(time.RFC3339))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "METRIC\tMIN\tAVG\tMAX\tP95\tTIMELINE")
+	for _, s := range r.Summaries {
+		fmt.Fprintf(tw, "%s\t%.2f\t%.2f\t%.2f\t%.2f\t%s\n", s.Name(), s.Min, s.Avg, s.Max, s.P95, s.Sparkline(DefaultSparkWidth))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,72 @@
+package report
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/travis-james/system-monitor/pkg/metrics/cpu"
+	"github.com/travis-james/system-monitor/pkg/metrics/memory"
+	"github.com/travis-james/system-monitor/pkg/snapshot"
+)
+
+// mockSnapshots returns a snapshot a second for each value of core 0 usage.
+func mockSnapshots(usage ...float64) []snapshot.Snapshot {
+	start := time.Unix(1700000000, 0)
+	var snaps []snapshot.Snapshot
+	for i, u := range usage {
+		snaps = append(snaps, snapshot.Snapshot{
+			Labels:    map[string]string{"host": "web-01"},
+			TimeStamp: start.Add(time.Duration(i) * time.Second),
+			Cpu:       &cpu.CpuMetric{Usage: []float64{u}, NumberOfCores: 1},
+			Memory:    &memory.MemoryMetric{UsedMemory: 100},
+		})
+	}
+	return snaps
+}
+
+func TestSummarize(t *testing.T) {
+	t.Parallel()
+	usage := []float64{10, 20, 30, 40, 50, 60, 70, 80, 90, 100, 15, 25, 35, 45, 55, 65, 75, 85, 95, 5}
+	r := Summarize(mockSnapshots(usage...))
+	assert.Equal(t, 20, r.Snapshots)
+	assert.Equal(t, 19*time.Second, r.End.Sub(r.Start))
+
+	s := r.Summaries[0]
+	assert.Equal(t, "cpu.usage{core=0}", s.Name())
+	assert.Equal(t, 5.0, s.Min)
+	assert.Equal(t, 100.0, s.Max)
+	assert.Equal(t, 52.5, s.Avg)
+	assert.Equal(t, 95.0, s.P95)
+	require.Len(t, s.Timeline, 20)
+	assert.Equal(t, Point{Offset: 2, Value: 30}, s.Timeline[2])
+
+	used := r.Summaries[len(r.Summaries)-3]
+	assert.Equal(t, "memory.used", used.Name())
+	assert.Equal(t, []float64{100, 100, 100, 100}, []float64{used.Min, used.Avg, used.Max, used.P95})
+
+	assert.Equal(t, Report{}, Summarize(nil))
+}
+
+func TestSparkline(t *testing.T) {
+	t.Parallel()
+	s := Summarize(mockSnapshots(0, 50, 100, 100)).Summaries[0]
+	assert.Equal(t, "▁▄██", s.Sparkline(10))
+	assert.Equal(t, "▂█", s.Sparkline(2), "points should be averaged down to the width")
+
+	flat := Summarize(mockSnapshots(7, 7, 7)).Summaries[0]
+	assert.Equal(t, "▁▁▁", flat.Sparkline(10))
+}
+
+func TestWriteTable(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	require.Nil(t, WriteTable(&buf, Summarize(mockSnapshots(0, 100))))
+	lines := strings.Split(buf.String(), "\n")
+	assert.Equal(t, "2 snapshots over 1s from "+time.Unix(1700000000, 0).Format(time.RFC3339), lines[0])
+	assert.Equal(t, "METRIC             MIN     AVG     MAX     P95     TIMELINE", lines[1])
+	assert.Equal(t, "cpu.usage{core=0}  0.00    50.00   100.00  100.00  ▁█", lines[2])
+}
@@ -0,0 +1,388 @@
+package server
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/travis-james/system-monitor/pkg/snapshot"
+)
+
+const (
+	DefaultHistory     = 360             // ex: an hour of snapshots every 10 seconds.
+	DefaultStaleAfter  = 5 * time.Minute // ex: a few missed pushes.
+	DefaultForgetAfter = 24 * time.Hour  // ex: a host that was decommissioned.
+	maxBodySize        = 32 << 20
+)
+
+// Config configures a Server.
+type Config struct {
+	History     int           // Snapshots kept per host, DefaultHistory when 0.
+	StaleAfter  time.Duration // Hosts that haven't pushed for this long are stale, DefaultStaleAfter when 0.
+	ForgetAfter time.Duration // Hosts that haven't pushed for this long are dropped, DefaultForgetAfter when 0.
+}
+
+// Server keeps the snapshots pushed by agents, by host, and answers queries
+// across the fleet. Use Handler to serve it over HTTP.
+type Server struct {
+	cfg   Config
+	now   func() time.Time
+	mu    sync.Mutex
+	hosts map[string]*hostState
+}
+
+// hostState is what the server knows of a host.
+type hostState struct {
+	history  []snapshot.Snapshot // Oldest first, the last is the latest.
+	lastSeen time.Time           // When the host last pushed, by the server's clock.
+}
+
+// HostStatus is the status of a host in the fleet.
+type HostStatus struct {
+	Host      string
+	Labels    map[string]string // Labels of the latest snapshot.
+	Latest    time.Time         // TimeStamp of the latest snapshot.
+	LastSeen  time.Time         // When the host last pushed, by the server's clock.
+	Stale     bool
+	Snapshots int // Snapshots kept in the history.
+}
+
+// Query selects series across the fleet, ex: Metric cpu.usage_total with
+// Above 80 for the busy hosts, or Metric disk.usage with Limit 10 for the
+// fullest disks.
+type Query struct {
+	Metric  string   // measurement.field, ex: disk.usage.
+	Above   *float64 // Only values above this.
+	Below   *float64 // Only values below this.
+	Ascend  bool     // Lowest values first instead of highest.
+	Limit   int      // Results to return, 0 for all.
+	PerHost bool     // Only the highest (or lowest with Ascend) series of each host.
+}
+
+// Match is a series of a host that matched a Query.
+type Match struct {
+	Host      string
+	Series    string // ex: disk.usage{device=/dev/sda1,mountpoint=/}.
+	Value     float64
+	TimeStamp time.Time
+}
+
+// New returns an empty Server.
+func New(cfg Config) *Server {
+	if cfg.History <= 0 {
+		cfg.History = DefaultHistory
+	}
+	if cfg.StaleAfter <= 0 {
+		cfg.StaleAfter = DefaultStaleAfter
+	}
+	if cfg.ForgetAfter <= 0 {
+		cfg.ForgetAfter = DefaultForgetAfter
+	}
+	return &Server{cfg: cfg, now: time.Now, hosts: make(map[string]*hostState)}
+}
+
+// Ingest stores snapshots pushed by agents. Snapshots are kept in time order
+// per host, so late ones (ex: backfilled after an outage) don't replace the
+// latest.
+func (s *Server) Ingest(snaps []snapshot.Snapshot) error {
+	for _, snap := range snaps {
+		if snap.Labels["host"] == "" {
+			return errors.New("snapshot has no host label")
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.forget(now)
+	for _, snap := range snaps {
+		name := snap.Labels["host"]
+		host, exists := s.hosts[name]
+		if !exists {
+			host = &hostState{}
+			s.hosts[name] = host
+		}
+		host.lastSeen = now
+		i := sort.Search(len(host.history), func(i int) bool {
+			return host.history[i].TimeStamp.After(snap.TimeStamp)
+		})
+		host.history = slices.Insert(host.history, i, snap)
+		if extra := len(host.history) - s.cfg.History; extra > 0 {
+			host.history = slices.Delete(host.history, 0, extra)
+		}
+	}
+	return nil
+}
+
+// forget drops the hosts that haven't pushed for ForgetAfter. It is called
+// on every read and write so they go even when no host pushes anymore. s.mu
+// must be held for writing.
+func (s *Server) forget(now time.Time) {
+	maps.DeleteFunc(s.hosts, func(_ string, host *hostState) bool {
+		return now.Sub(host.lastSeen) >= s.cfg.ForgetAfter
+	})
+}
+
+// Hosts returns the status of every host, sorted by name.
+func (s *Server) Hosts() []HostStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.forget(now)
+	statuses := make([]HostStatus, 0, len(s.hosts))
+	for _, name := range slices.Sorted(maps.Keys(s.hosts)) {
+		host := s.hosts[name]
+		latest := host.history[len(host.history)-1]
+		statuses = append(statuses, HostStatus{
+			Host:      name,
+			Labels:    latest.Labels,
+			Latest:    latest.TimeStamp,
+			LastSeen:  host.lastSeen,
+			Stale:     now.Sub(host.lastSeen) >= s.cfg.StaleAfter,
+			Snapshots: len(host.history),
+		})
+	}
+	return statuses
+}
+
+// Stale returns the status of the hosts that stopped pushing.
+func (s *Server) Stale() []HostStatus {
+	var stale []HostStatus
+	for _, status := range s.Hosts() {
+		if status.Stale {
+			stale = append(stale, status)
+		}
+	}
+	return stale
+}
+
+// Latest returns the latest snapshot of host.
+func (s *Server) Latest(host string) (snapshot.Snapshot, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.forget(s.now())
+	state, exists := s.hosts[host]
+	if !exists {
+		return snapshot.Snapshot{}, false
+	}
+	return state.history[len(state.history)-1], true
+}
+
+// History returns the snapshots of host taken in [from, to), zero times
+// leaving that end open.
+func (s *Server) History(host string, from, to time.Time) ([]snapshot.Snapshot, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.forget(s.now())
+	state, exists := s.hosts[host]
+	if !exists {
+		return nil, false
+	}
+	if to.IsZero() {
+		return snapshot.Between(state.history, from, state.history[len(state.history)-1].TimeStamp.Add(1)), true
+	}
+	return snapshot.Between(state.history, from, to), true
+}
+
+// Query returns the latest values of every host's series that match q,
+// highest first unless q.Ascend.
+func (s *Server) Query(q Query) []Match {
+	s.mu.Lock()
+	s.forget(s.now())
+	var matches []Match
+	for name, host := range s.hosts {
+		latest := host.history[len(host.history)-1]
+		for _, sample := range latest.Metrics() {
+			if sample.Measurement+"."+sample.Field != q.Metric {
+				continue
+			}
+			if (q.Above != nil && sample.Value <= *q.Above) || (q.Below != nil && sample.Value >= *q.Below) {
+				continue
+			}
+			matches = append(matches, Match{Host: name, Series: sample.Name(), Value: sample.Value, TimeStamp: latest.TimeStamp})
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.Value != b.Value {
+			return (a.Value < b.Value) == q.Ascend
+		}
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		return a.Series < b.Series
+	})
+	if q.PerHost {
+		seen := make(map[string]bool)
+		matches = slices.DeleteFunc(matches, func(m Match) bool {
+			duplicate := seen[m.Host]
+			seen[m.Host] = true
+			return duplicate
+		})
+	}
+	if q.Limit > 0 && len(matches) > q.Limit {
+		matches = matches[:q.Limit]
+	}
+	return matches
+}
+
+// Handler returns the HTTP API of the server:
+//
+//	POST /api/v1/snapshots            a JSON array of snapshots (or a single one), as sent by the http and push outputs, optionally gzipped
+//	GET  /api/v1/hosts                status of every host
+//	GET  /api/v1/hosts/{host}         latest snapshot of a host
+//	GET  /api/v1/hosts/{host}/history snapshots of a host, ?from= and ?to= as RFC 3339
+//	GET  /api/v1/stale                status of the hosts that stopped pushing
+//	GET  /api/v1/query                ?metric=cpu.usage_total&above=80&below=&order=asc&limit=10&per=host
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/snapshots", s.handleIngest)
+	mux.HandleFunc("GET /api/v1/hosts", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.Hosts())
+	})
+	mux.HandleFunc("GET /api/v1/hosts/{host}", func(w http.ResponseWriter, r *http.Request) {
+		snap, found := s.Latest(r.PathValue("host"))
+		if !found {
+			http.Error(w, "unknown host", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, snap)
+	})
+	mux.HandleFunc("GET /api/v1/hosts/{host}/history", s.handleHistory)
+	mux.HandleFunc("GET /api/v1/stale", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, s.Stale())
+	})
+	mux.HandleFunc("GET /api/v1/query", s.handleQuery)
+	return mux
+}
+
+func (s *Server) handleIngest(w http.ResponseWriter, r *http.Request) {
+	var body io.Reader = http.MaxBytesReader(w, r.Body, maxBodySize)
+	switch r.Header.Get("Content-Encoding") {
+	case "", "identity":
+	case "gzip":
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("error decompressing snapshots: %v", err), http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		// Bound what the body expands to as well as its size on the wire.
+		body = io.LimitReader(gz, maxBodySize)
+	default:
+		http.Error(w, "unsupported content encoding", http.StatusUnsupportedMediaType)
+		return
+	}
+	snaps, err := decodeSnapshots(body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error decoding snapshots: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := s.Ingest(snaps); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	var from, to time.Time
+	for param, t := range map[string]*time.Time{"from": &from, "to": &to} {
+		v := r.URL.Query().Get(param)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid %s: %v", param, err), http.StatusBadRequest)
+			return
+		}
+		*t = parsed
+	}
+	snaps, found := s.History(r.PathValue("host"), from, to)
+	if !found {
+		http.Error(w, "unknown host", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, snaps)
+}
+
+func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	q, err := parseQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, s.Query(q))
+}
+
+// parseQuery reads a Query out of the URL parameters of r.
+func parseQuery(r *http.Request) (Query, error) {
+	params := r.URL.Query()
+	q := Query{
+		Metric:  params.Get("metric"),
+		Ascend:  params.Get("order") == "asc",
+		PerHost: params.Get("per") == "host",
+	}
+	if q.Metric == "" {
+		return Query{}, errors.New("metric is required, ex: metric=cpu.usage_total")
+	}
+	for param, bound := range map[string]**float64{"above": &q.Above, "below": &q.Below} {
+		if v := params.Get(param); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return Query{}, fmt.Errorf("invalid %s: %v", param, err)
+			}
+			*bound = &f
+		}
+	}
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return Query{}, fmt.Errorf("invalid limit: %q", v)
+		}
+		q.Limit = limit
+	}
+	return q, nil
+}
+
+// decodeSnapshots reads a JSON array of snapshots or a single snapshot.
+func decodeSnapshots(r io.Reader) ([]snapshot.Snapshot, error) {
+	var raw json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+	if raw[0] != '[' {
+		var snap snapshot.Snapshot
+		err := json.Unmarshal(raw, &snap)
+		return []snapshot.Snapshot{snap}, err
+	}
+	var snaps []snapshot.Snapshot
+	err := json.Unmarshal(raw, &snaps)
+	return snaps, err
+}
+
+// writeJSON writes v as the JSON response, an empty list rather than null
+// for no results.
+func writeJSON(w http.ResponseWriter, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("error encoding response: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if string(data) == "null" {
+		data = []byte("[]")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
@@ -0,0 +1,273 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/travis-james/system-monitor/pkg/metrics/cpu"
+	"github.com/travis-james/system-monitor/pkg/metrics/disk"
+	"github.com/travis-james/system-monitor/pkg/sink"
+	"github.com/travis-james/system-monitor/pkg/snapshot"
+)
+
+var start = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func mockSnapshot(host string, at time.Time, usage float64, diskUsage ...float64) snapshot.Snapshot {
+	snap := snapshot.Snapshot{
+		Labels:    map[string]string{"host": host},
+		TimeStamp: at,
+		Cpu:       &cpu.CpuMetric{Usage: []float64{usage, usage / 2}, NumberOfCores: 2},
+	}
+	for i, u := range diskUsage {
+		mount := fmt.Sprintf("/mnt/%d", i)
+		if snap.Disks == nil {
+			snap.Disks = make(map[string]disk.DiskMetric)
+		}
+		snap.Disks[mount] = disk.DiskMetric{Device: fmt.Sprintf("/dev/sd%c", 'a'+i), Mountpoint: mount, DiskUsage: disk.DiskUsage{Usage: u}}
+	}
+	return snap
+}
+
+// fleet starts a server and pushes snapshots to it from an in-process agent
+// per host, like the http output of the CLI would.
+func fleet(t *testing.T, srv *Server, snaps ...snapshot.Snapshot) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewServer(srv.Handler())
+	t.Cleanup(ts.Close)
+	agents := make(map[string]*sink.HTTPSink)
+	for _, snap := range snaps {
+		host := snap.Labels["host"]
+		if agents[host] == nil {
+			agents[host] = sink.NewHTTPSink(sink.HTTPConfig{URL: ts.URL + "/api/v1/snapshots", BatchSize: 2})
+		}
+		require.Nil(t, agents[host].Write(snap))
+	}
+	var wg sync.WaitGroup
+	for _, agent := range agents {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, agent.Close())
+		}()
+	}
+	wg.Wait()
+	return ts
+}
+
+// get decodes the JSON response of a GET to ts.
+func get(t *testing.T, ts *httptest.Server, path string, v any) int {
+	t.Helper()
+	resp, err := http.Get(ts.URL + path)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		require.Nil(t, json.NewDecoder(resp.Body).Decode(v))
+	}
+	return resp.StatusCode
+}
+
+func TestServer(t *testing.T) {
+	t.Parallel()
+	srv := New(Config{History: 2})
+	ts := fleet(t, srv,
+		mockSnapshot("web-01", start, 10, 50),
+		mockSnapshot("web-01", start.Add(time.Minute), 90, 55),
+		mockSnapshot("web-01", start.Add(2*time.Minute), 95, 60),
+		mockSnapshot("db-01", start, 30, 70, 95),
+	)
+
+	var hosts []HostStatus
+	require.Equal(t, http.StatusOK, get(t, ts, "/api/v1/hosts", &hosts))
+	require.Len(t, hosts, 2)
+	assert.Equal(t, "db-01", hosts[0].Host)
+	assert.Equal(t, "web-01", hosts[1].Host)
+	assert.Equal(t, 2, hosts[1].Snapshots, "history should be bounded")
+	assert.True(t, start.Add(2*time.Minute).Equal(hosts[1].Latest))
+	assert.False(t, hosts[1].Stale)
+
+	var latest snapshot.Snapshot
+	require.Equal(t, http.StatusOK, get(t, ts, "/api/v1/hosts/web-01", &latest))
+	assert.Equal(t, 95.0, latest.Cpu.Usage[0])
+	assert.Equal(t, http.StatusNotFound, get(t, ts, "/api/v1/hosts/nope", &latest))
+
+	var history []snapshot.Snapshot
+	require.Equal(t, http.StatusOK, get(t, ts, "/api/v1/hosts/web-01/history", &history))
+	assert.Len(t, history, 2)
+	from := start.Add(90 * time.Second).Format(time.RFC3339)
+	require.Equal(t, http.StatusOK, get(t, ts, "/api/v1/hosts/web-01/history?from="+from, &history))
+	assert.Len(t, history, 1)
+}
+
+func TestServer_Query(t *testing.T) {
+	t.Parallel()
+	ts := fleet(t, New(Config{}),
+		mockSnapshot("web-01", start, 85, 50),
+		mockSnapshot("web-02", start, 20, 10),
+		mockSnapshot("db-01", start, 99, 70, 95),
+	)
+
+	var matches []Match
+	require.Equal(t, http.StatusOK, get(t, ts, "/api/v1/query?metric=cpu.usage&above=80", &matches))
+	require.Len(t, matches, 2)
+	assert.Equal(t, Match{Host: "db-01", Series: "cpu.usage{core=0}", Value: 99, TimeStamp: start}, matches[0])
+	assert.Equal(t, "web-01", matches[1].Host)
+
+	require.Equal(t, http.StatusOK, get(t, ts, "/api/v1/query?metric=cpu.usage_total&above=60", &matches))
+	require.Len(t, matches, 2, "one series per host")
+	assert.Equal(t, Match{Host: "db-01", Series: "cpu.usage_total", Value: 74.25, TimeStamp: start}, matches[0])
+	assert.Equal(t, "web-01", matches[1].Host)
+
+	require.Equal(t, http.StatusOK, get(t, ts, "/api/v1/query?metric=disk.usage&limit=2", &matches))
+	require.Len(t, matches, 2)
+	assert.Equal(t, "disk.usage{device=/dev/sdb,mountpoint=/mnt/1}", matches[0].Series)
+	assert.Equal(t, 70.0, matches[1].Value)
+
+	require.Equal(t, http.StatusOK, get(t, ts, "/api/v1/query?metric=disk.usage&per=host", &matches))
+	assert.Len(t, matches, 3, "only the fullest disk of each host should be kept")
+
+	require.Equal(t, http.StatusOK, get(t, ts, "/api/v1/query?metric=cpu.usage&order=asc&limit=1", &matches))
+	assert.Equal(t, 10.0, matches[0].Value)
+
+	require.Equal(t, http.StatusOK, get(t, ts, "/api/v1/query?metric=cpu.usage&below=0", &matches))
+	assert.Empty(t, matches)
+
+	assert.Equal(t, http.StatusBadRequest, get(t, ts, "/api/v1/query", &matches))
+	assert.Equal(t, http.StatusBadRequest, get(t, ts, "/api/v1/query?metric=cpu.usage&above=lots", &matches))
+}
+
+func TestServer_Stale(t *testing.T) {
+	t.Parallel()
+	srv := New(Config{StaleAfter: time.Minute})
+	now := start
+	srv.now = func() time.Time { return now }
+	require.Nil(t, srv.Ingest([]snapshot.Snapshot{mockSnapshot("web-01", start, 10)}))
+	now = start.Add(2 * time.Minute)
+	require.Nil(t, srv.Ingest([]snapshot.Snapshot{mockSnapshot("web-02", now, 10)}))
+
+	stale := srv.Stale()
+	require.Len(t, stale, 1)
+	assert.Equal(t, "web-01", stale[0].Host)
+	assert.Equal(t, start, stale[0].LastSeen)
+
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+	require.Equal(t, http.StatusOK, get(t, ts, "/api/v1/stale", &stale))
+	assert.Len(t, stale, 1)
+	require.Nil(t, srv.Ingest([]snapshot.Snapshot{mockSnapshot("stale", now, 10)}))
+	var latest snapshot.Snapshot
+	require.Equal(t, http.StatusOK, get(t, ts, "/api/v1/hosts/stale", &latest), "a host named stale should be reachable")
+	assert.Equal(t, "stale", latest.Labels["host"])
+}
+
+func TestServer_Forget(t *testing.T) {
+	t.Parallel()
+	srv := New(Config{StaleAfter: time.Minute, ForgetAfter: time.Hour})
+	now := start
+	srv.now = func() time.Time { return now }
+	require.Nil(t, srv.Ingest([]snapshot.Snapshot{mockSnapshot("web-01", start, 10)}))
+	now = start.Add(30 * time.Minute)
+	require.Nil(t, srv.Ingest([]snapshot.Snapshot{mockSnapshot("web-02", now, 10)}))
+	assert.Len(t, srv.Stale(), 1, "a stale host should be kept until ForgetAfter")
+
+	now = start.Add(time.Hour)
+	require.Nil(t, srv.Ingest([]snapshot.Snapshot{mockSnapshot("web-02", now, 10)}))
+	hosts := srv.Hosts()
+	require.Len(t, hosts, 1)
+	assert.Equal(t, "web-02", hosts[0].Host)
+	_, found := srv.Latest("web-01")
+	assert.False(t, found)
+}
+
+func TestServer_ForgetWithoutPushes(t *testing.T) {
+	t.Parallel()
+	srv := New(Config{StaleAfter: time.Minute, ForgetAfter: time.Hour})
+	now := start
+	srv.now = func() time.Time { return now }
+	require.Nil(t, srv.Ingest([]snapshot.Snapshot{mockSnapshot("web-01", start, 10)}))
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+
+	// Every host stopped pushing, only reads arrive from here on.
+	now = start.Add(time.Hour)
+	var hosts []HostStatus
+	require.Equal(t, http.StatusOK, get(t, ts, "/api/v1/hosts", &hosts))
+	assert.Empty(t, hosts)
+	require.Equal(t, http.StatusOK, get(t, ts, "/api/v1/stale", &hosts))
+	assert.Empty(t, hosts)
+	var snap snapshot.Snapshot
+	assert.Equal(t, http.StatusNotFound, get(t, ts, "/api/v1/hosts/web-01", &snap))
+	assert.Empty(t, srv.Query(Query{Metric: "cpu.usage_total"}))
+}
+
+func TestServer_Backfill(t *testing.T) {
+	t.Parallel()
+	srv := New(Config{})
+	require.Nil(t, srv.Ingest([]snapshot.Snapshot{mockSnapshot("web-01", start.Add(time.Minute), 50)}))
+	require.Nil(t, srv.Ingest([]snapshot.Snapshot{mockSnapshot("web-01", start, 10)}))
+	latest, found := srv.Latest("web-01")
+	require.True(t, found)
+	assert.Equal(t, 50.0, latest.Cpu.Usage[0], "a late snapshot shouldn't replace the latest")
+	history, _ := srv.History("web-01", time.Time{}, time.Time{})
+	require.Len(t, history, 2)
+	assert.True(t, start.Equal(history[0].TimeStamp))
+}
+
+func TestServer_PushAgents(t *testing.T) {
+	t.Parallel()
+	srv := New(Config{})
+	ts := httptest.NewServer(srv.Handler())
+	defer ts.Close()
+	var wg sync.WaitGroup
+	for _, host := range []string{"web-01", "web-02", "db-01"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			agent, err := sink.NewPushSink(sink.PushConfig{URL: ts.URL + "/api/v1/snapshots", BatchSize: 3, SpoolDir: t.TempDir()})
+			if !assert.Nil(t, err) {
+				return
+			}
+			for i := range 5 {
+				assert.Nil(t, agent.Write(mockSnapshot(host, start.Add(time.Duration(i)*time.Minute), float64(i))))
+			}
+			assert.Nil(t, agent.Close())
+		}()
+	}
+	wg.Wait()
+
+	hosts := srv.Hosts()
+	require.Len(t, hosts, 3)
+	for _, h := range hosts {
+		assert.Equal(t, 5, h.Snapshots, "gzipped batches should be accepted from %s", h.Host)
+	}
+}
+
+func TestServer_Ingest(t *testing.T) {
+	t.Parallel()
+	ts := httptest.NewServer(New(Config{}).Handler())
+	defer ts.Close()
+	post := func(body string) int {
+		resp, err := http.Post(ts.URL+"/api/v1/snapshots", "application/json", strings.NewReader(body))
+		require.Nil(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusNoContent, post(`{"Labels":{"host":"web-01"}}`), "a single snapshot should be accepted")
+	assert.Equal(t, http.StatusBadRequest, post(`[{"Labels":{}}]`), "snapshots need a host")
+	assert.Equal(t, http.StatusBadRequest, post(`[{`))
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/api/v1/snapshots", strings.NewReader(`[]`))
+	require.Nil(t, err)
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	require.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "a body that isn't gzipped should be rejected")
+}
@@ -0,0 +1,54 @@
+package sink
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Backoff configures how a failed send is retried. Each retry waits twice as
+// long as the one before, starting at Initial and capped at Max.
+type Backoff struct {
+	Retries int           // Times to retry after the first attempt fails.
+	Initial time.Duration // Wait before the first retry.
+	Max     time.Duration // Longest wait between retries, 0 for no cap.
+}
+
+// DefaultBackoff retries 3 times over roughly 3.5 seconds.
+var DefaultBackoff = Backoff{Retries: 3, Initial: 500 * time.Millisecond, Max: 5 * time.Second}
+
+// permanentError is a failed send that retrying won't fix, ex: the endpoint
+// rejected the request as malformed.
+type permanentError struct {
+	err error
+}
+
+func (pe permanentError) Error() string { return pe.err.Error() }
+func (pe permanentError) Unwrap() error { return pe.err }
+
+// isPermanent reports whether err is, or wraps, a permanentError.
+func isPermanent(err error) bool {
+	return errors.As(err, new(permanentError))
+}
+
+// retry calls send until it succeeds, fails permanently, or the retries run
+// out, returning the last error.
+func (b Backoff) retry(send func() error) error {
+	wait := b.Initial
+	err := send()
+	for attempt := 0; err != nil && attempt < b.Retries; attempt++ {
+		if isPermanent(err) {
+			return err
+		}
+		time.Sleep(wait)
+		wait *= 2
+		if b.Max > 0 && wait > b.Max {
+			wait = b.Max
+		}
+		err = send()
+	}
+	if err != nil && !isPermanent(err) {
+		return fmt.Errorf("giving up after %d attempts: %w", b.Retries+1, err)
+	}
+	return err
+}
@@ -0,0 +1,49 @@
+package sink
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetry_SucceedsAfterFailures(t *testing.T) {
+	t.Parallel()
+	calls := 0
+	b := Backoff{Retries: 3, Initial: time.Millisecond}
+	err := b.retry(func() error {
+		calls++
+		if calls < 3 {
+			return errors.New("mock send error")
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, calls)
+}
+
+func TestRetry_GivesUp(t *testing.T) {
+	t.Parallel()
+	calls := 0
+	sendErr := errors.New("mock send error")
+	b := Backoff{Retries: 2, Initial: time.Millisecond, Max: 2 * time.Millisecond}
+	err := b.retry(func() error {
+		calls++
+		return sendErr
+	})
+	assert.ErrorIs(t, err, sendErr)
+	assert.Equal(t, 3, calls)
+}
+
+func TestRetry_Permanent(t *testing.T) {
+	t.Parallel()
+	calls := 0
+	b := Backoff{Retries: 3, Initial: time.Millisecond}
+	err := b.retry(func() error {
+		calls++
+		return permanentError{errors.New("mock bad request")}
+	})
+	assert.True(t, isPermanent(err))
+	assert.Equal(t, 1, calls, "permanent errors shouldn't be retried")
+}
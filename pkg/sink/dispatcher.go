@@ -0,0 +1,188 @@
+package sink
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/travis-james/system-monitor/pkg/snapshot"
+)
+
+// Policy is what a Dispatcher does with a snapshot when a sink's queue is
+// full.
+type Policy string
+
+const (
+	PolicyDrop  Policy = "drop"  // Drop the snapshot for that sink and count it.
+	PolicyBlock Policy = "block" // Wait for the sink to make room.
+)
+
+// DefaultQueueSize is the queue length used when QueueConfig.Size is unset.
+const DefaultQueueSize = 16
+
+// QueueConfig configures the queue in front of a sink.
+type QueueConfig struct {
+	Size   int    // Snapshots the queue holds, defaults to DefaultQueueSize.
+	Policy Policy // Defaults to PolicyDrop.
+}
+
+// SinkStats counts what happened to the snapshots sent to a sink.
+type SinkStats struct {
+	Name      string
+	Written   uint64 // Snapshots the sink accepted.
+	Dropped   uint64 // Snapshots dropped because the queue was full.
+	Errors    uint64 // Failed writes, flushes and closes.
+	LastError string
+}
+
+// queue feeds one sink from its own goroutine so a slow sink only holds up
+// itself.
+type queue struct {
+	name    string
+	sink    Sink
+	policy  Policy
+	ch      chan snapshot.Snapshot
+	done    chan struct{}
+	written atomic.Uint64
+	dropped atomic.Uint64
+	errors  atomic.Uint64
+	mu      sync.Mutex
+	lastErr error
+	exitErr error // Flush and Close errors, read once done is closed.
+}
+
+// Dispatcher fans every snapshot out to a set of sinks.
+type Dispatcher struct {
+	mu     sync.RWMutex
+	queues []*queue
+	closed bool
+}
+
+// NewDispatcher returns a Dispatcher with no sinks.
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{}
+}
+
+// Add starts sending snapshots to s through a queue configured by cfg. name
+// identifies the sink in Stats and errors.
+func (d *Dispatcher) Add(name string, s Sink, cfg QueueConfig) error {
+	if cfg.Size <= 0 {
+		cfg.Size = DefaultQueueSize
+	}
+	switch cfg.Policy {
+	case "":
+		cfg.Policy = PolicyDrop
+	case PolicyDrop, PolicyBlock:
+	default:
+		return fmt.Errorf("invalid queue policy: %s", cfg.Policy)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return errors.New("dispatcher is closed")
+	}
+	q := &queue{
+		name:   name,
+		sink:   s,
+		policy: cfg.Policy,
+		ch:     make(chan snapshot.Snapshot, cfg.Size),
+		done:   make(chan struct{}),
+	}
+	d.queues = append(d.queues, q)
+	go q.run()
+	return nil
+}
+
+// Write queues snap for every sink. It only waits on sinks with PolicyBlock,
+// write errors are counted in Stats rather than returned.
+func (d *Dispatcher) Write(snap snapshot.Snapshot) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return
+	}
+	for _, q := range d.queues {
+		if q.policy == PolicyBlock {
+			q.ch <- snap
+			continue
+		}
+		select {
+		case q.ch <- snap:
+		default:
+			q.dropped.Add(1)
+		}
+	}
+}
+
+// Stats returns the counters of every sink in the order they were added.
+func (d *Dispatcher) Stats() []SinkStats {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	stats := make([]SinkStats, 0, len(d.queues))
+	for _, q := range d.queues {
+		s := SinkStats{
+			Name:    q.name,
+			Written: q.written.Load(),
+			Dropped: q.dropped.Load(),
+			Errors:  q.errors.Load(),
+		}
+		q.mu.Lock()
+		if q.lastErr != nil {
+			s.LastError = q.lastErr.Error()
+		}
+		q.mu.Unlock()
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+// Close waits for every queue to drain, then flushes and closes the sinks.
+// Snapshots written after Close are ignored.
+func (d *Dispatcher) Close() error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	for _, q := range d.queues {
+		close(q.ch)
+	}
+	d.mu.Unlock()
+
+	var errs []error
+	for _, q := range d.queues {
+		<-q.done
+		errs = append(errs, q.exitErr)
+	}
+	return errors.Join(errs...)
+}
+
+// run writes queued snapshots until the queue is closed, then flushes and
+// closes the sink.
+func (q *queue) run() {
+	defer close(q.done)
+	for snap := range q.ch {
+		if err := q.sink.Write(snap); err != nil {
+			q.fail(err)
+			continue
+		}
+		q.written.Add(1)
+	}
+	if err := q.sink.Flush(); err != nil {
+		q.fail(err)
+		q.exitErr = fmt.Errorf("error flushing %s: %w", q.name, err)
+	}
+	if err := q.sink.Close(); err != nil {
+		q.fail(err)
+		q.exitErr = errors.Join(q.exitErr, fmt.Errorf("error closing %s: %w", q.name, err))
+	}
+}
+
+func (q *queue) fail(err error) {
+	q.errors.Add(1)
+	q.mu.Lock()
+	q.lastErr = err
+	q.mu.Unlock()
+}
@@ -0,0 +1,107 @@
+package sink
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/travis-james/system-monitor/pkg/snapshot"
+)
+
+// mockSink records what it is sent. Writes wait on gate when it is set and
+// fail with err when it is set.
+type mockSink struct {
+	mu      sync.Mutex
+	gate    chan struct{}
+	err     error
+	written []snapshot.Snapshot
+	flushed bool
+	closed  bool
+}
+
+func (ms *mockSink) Write(snap snapshot.Snapshot) error {
+	if ms.gate != nil {
+		<-ms.gate
+	}
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.err != nil {
+		return ms.err
+	}
+	ms.written = append(ms.written, snap)
+	return nil
+}
+
+func (ms *mockSink) Flush() error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.flushed = true
+	return nil
+}
+
+func (ms *mockSink) Close() error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.closed = true
+	return nil
+}
+
+func TestDispatcher(t *testing.T) {
+	t.Parallel()
+	first, second := &mockSink{}, &mockSink{}
+	d := NewDispatcher()
+	require.Nil(t, d.Add("first", first, QueueConfig{}))
+	require.Nil(t, d.Add("second", second, QueueConfig{Policy: PolicyBlock}))
+	for range 3 {
+		d.Write(mockSnapshot())
+	}
+	require.Nil(t, d.Close())
+
+	for _, ms := range []*mockSink{first, second} {
+		assert.Len(t, ms.written, 3)
+		assert.True(t, ms.flushed)
+		assert.True(t, ms.closed)
+	}
+	assert.Equal(t, []SinkStats{{Name: "first", Written: 3}, {Name: "second", Written: 3}}, d.Stats())
+
+	d.Write(mockSnapshot())
+	assert.Len(t, first.written, 3, "writes after close should be ignored")
+}
+
+func TestDispatcher_SlowSinkDrops(t *testing.T) {
+	t.Parallel()
+	slow, fast := &mockSink{gate: make(chan struct{})}, &mockSink{}
+	d := NewDispatcher()
+	require.Nil(t, d.Add("slow", slow, QueueConfig{Size: 1}))
+	require.Nil(t, d.Add("fast", fast, QueueConfig{Size: 10, Policy: PolicyBlock}))
+	// The slow sink takes the first snapshot and blocks on it, the second
+	// fills its queue and the rest are dropped without holding up fast.
+	for range 5 {
+		d.Write(mockSnapshot())
+	}
+	close(slow.gate)
+	require.Nil(t, d.Close())
+
+	stats := d.Stats()
+	assert.Equal(t, uint64(5), stats[1].Written)
+	assert.Equal(t, uint64(5), stats[0].Written+stats[0].Dropped)
+	assert.GreaterOrEqual(t, stats[0].Dropped, uint64(3))
+}
+
+func TestDispatcher_Errors(t *testing.T) {
+	t.Parallel()
+	failing := &mockSink{err: errors.New("disk full")}
+	d := NewDispatcher()
+	require.Nil(t, d.Add("failing", failing, QueueConfig{}))
+	d.Write(mockSnapshot())
+	d.Write(mockSnapshot())
+	require.Nil(t, d.Close())
+	assert.Equal(t, []SinkStats{{Name: "failing", Errors: 2, LastError: "disk full"}}, d.Stats())
+}
+
+func TestDispatcher_InvalidPolicy(t *testing.T) {
+	t.Parallel()
+	assert.NotNil(t, NewDispatcher().Add("stdout", &mockSink{}, QueueConfig{Policy: "maybe"}))
+}
@@ -0,0 +1,135 @@
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/travis-james/system-monitor/pkg/snapshot"
+)
+
+// GraphiteConfig configures a GraphiteSink.
+type GraphiteConfig struct {
+	Address   string            // Carbon plaintext listener, ex: localhost:2003.
+	Prefix    string            // Prepended to every metric path, ex: "sysmon" gives sysmon.cpu.usage.
+	Tags      map[string]string // Added to every line, on top of the snapshot's labels.
+	BatchSize int               // Snapshots to buffer before sending, 1 or less sends every snapshot.
+	Timeout   time.Duration     // Dial and write timeout, defaults to 5 seconds.
+	Backoff   Backoff
+}
+
+// GraphiteSink sends snapshots to Carbon over TCP in the plaintext protocol,
+// using Graphite 1.1 tags (path;tag=value) for labels.
+type GraphiteSink struct {
+	cfg     GraphiteConfig
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	pending int // Snapshots in buf.
+}
+
+// NewGraphiteSink returns a GraphiteSink that sends to cfg.Address.
+func NewGraphiteSink(cfg GraphiteConfig) *GraphiteSink {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	return &GraphiteSink{cfg: cfg}
+}
+
+// Write buffers snap and sends the buffer once BatchSize snapshots are in it.
+func (gs *GraphiteSink) Write(snap snapshot.Snapshot) error {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.buf.WriteString(GraphiteLines(snap, gs.cfg.Prefix, gs.cfg.Tags))
+	gs.pending++
+	if gs.pending < gs.cfg.BatchSize {
+		return nil
+	}
+	return gs.flush()
+}
+
+// Flush sends everything buffered.
+func (gs *GraphiteSink) Flush() error {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	return gs.flush()
+}
+
+// Close flushes what is left in the buffer.
+func (gs *GraphiteSink) Close() error {
+	return gs.Flush()
+}
+
+// flush sends the buffer over a new connection, retrying with backoff. The
+// buffer is dropped even when every attempt fails.
+func (gs *GraphiteSink) flush() error {
+	if gs.buf.Len() == 0 {
+		return nil
+	}
+	body := bytes.Clone(gs.buf.Bytes())
+	gs.buf.Reset()
+	gs.pending = 0
+	return gs.cfg.Backoff.retry(func() error {
+		conn, err := net.DialTimeout("tcp", gs.cfg.Address, gs.cfg.Timeout)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		if err := conn.SetWriteDeadline(time.Now().Add(gs.cfg.Timeout)); err != nil {
+			return err
+		}
+		_, err = conn.Write(body)
+		return err
+	})
+}
+
+// GraphiteLines serializes snap to the plaintext protocol, one line per
+// sample, ex:
+//
+//	sysmon.cpu.usage;core=0;host=web-01 10.5 1700000000
+func GraphiteLines(snap snapshot.Snapshot, prefix string, tags map[string]string) string {
+	var sb strings.Builder
+	for _, sample := range snap.Samples() {
+		merged := maps.Clone(sample.Tags)
+		maps.Copy(merged, tags)
+		path := graphitePath(sample.Measurement) + "." + graphitePath(sample.Field)
+		if prefix != "" {
+			path = prefix + "." + path
+		}
+		sb.WriteString(path)
+		for _, k := range slices.Sorted(maps.Keys(merged)) {
+			if merged[k] == "" {
+				continue
+			}
+			fmt.Fprintf(&sb, ";%s=%s", graphiteTag(k), graphiteTag(merged[k]))
+		}
+		fmt.Fprintf(&sb, " %s %d\n", strconv.FormatFloat(sample.Value, 'f', -1, 64), sample.TimeStamp.Unix())
+	}
+	return sb.String()
+}
+
+// graphitePath replaces the characters that would split a path node
+// (whitespace, tag separators and dots) with underscores.
+func graphitePath(s string) string {
+	return graphiteReplace(s, " \t\n;.")
+}
+
+// graphiteTag replaces the characters that aren't allowed in a tag name or
+// value with underscores.
+func graphiteTag(s string) string {
+	return graphiteReplace(s, " \t\n;=~!^")
+}
+
+func graphiteReplace(s, special string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(special, r) {
+			return '_'
+		}
+		return r
+	}, s)
+}
@@ -0,0 +1,76 @@
+package sink
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCarbon is an in-process Carbon plaintext listener that sends every line
+// it receives to lines.
+func fakeCarbon(t *testing.T) (string, chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	t.Cleanup(func() { ln.Close() })
+	lines := make(chan string, 100)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				scanner := bufio.NewScanner(conn)
+				for scanner.Scan() {
+					lines <- scanner.Text()
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), lines
+}
+
+func TestGraphiteLines(t *testing.T) {
+	t.Parallel()
+	got := GraphiteLines(mockSnapshot(), "sysmon", map[string]string{"env": "prod"})
+	assert.Contains(t, got, "sysmon.cpu.usage;core=0;env=prod;host=web_01 10.5 1700000000\n")
+	assert.Contains(t, got, "sysmon.memory.used;env=prod;host=web_01 1024 1700000000\n")
+}
+
+func TestGraphiteSink(t *testing.T) {
+	t.Parallel()
+	addr, lines := fakeCarbon(t)
+	gs := NewGraphiteSink(GraphiteConfig{Address: addr, Prefix: "sysmon", BatchSize: 2, Backoff: Backoff{Retries: 1, Initial: time.Millisecond}})
+	require.Nil(t, gs.Write(mockSnapshot()))
+	select {
+	case line := <-lines:
+		t.Fatalf("expected first snapshot to be buffered, got %q", line)
+	case <-time.After(50 * time.Millisecond):
+	}
+	require.Nil(t, gs.Write(mockSnapshot()))
+	for range 16 {
+		select {
+		case line := <-lines:
+			assert.Contains(t, line, "sysmon.")
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for lines")
+		}
+	}
+}
+
+func TestGraphiteSink_Unreachable(t *testing.T) {
+	t.Parallel()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	gs := NewGraphiteSink(GraphiteConfig{Address: addr, Backoff: Backoff{Retries: 1, Initial: time.Millisecond}})
+	assert.NotNil(t, gs.Write(mockSnapshot()))
+}
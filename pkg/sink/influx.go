@@ -0,0 +1,154 @@
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/travis-james/system-monitor/pkg/snapshot"
+)
+
+// InfluxConfig configures an InfluxSink.
+type InfluxConfig struct {
+	URL       string            // Write endpoint, ex: http://localhost:8086/api/v2/write?org=o&bucket=b or .../write?db=d for 1.x.
+	Token     string            // Sent as "Authorization: Token <Token>" when set.
+	Prefix    string            // Prepended to every measurement name, ex: "sysmon_" gives sysmon_cpu.
+	Tags      map[string]string // Added to every line, on top of the snapshot's labels.
+	BatchSize int               // Snapshots to buffer before writing, 1 or less writes every snapshot.
+	Backoff   Backoff
+	Client    *http.Client // Defaults to a client with a 10 second timeout.
+}
+
+// InfluxSink writes snapshots to InfluxDB's HTTP write API in line protocol.
+type InfluxSink struct {
+	cfg     InfluxConfig
+	mu      sync.Mutex
+	buf     bytes.Buffer
+	pending int // Snapshots in buf.
+}
+
+// NewInfluxSink returns an InfluxSink that writes to cfg.URL.
+func NewInfluxSink(cfg InfluxConfig) *InfluxSink {
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &InfluxSink{cfg: cfg}
+}
+
+// Write buffers snap and writes the buffer once BatchSize snapshots are in it.
+func (is *InfluxSink) Write(snap snapshot.Snapshot) error {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	is.buf.WriteString(InfluxLines(snap, is.cfg.Prefix, is.cfg.Tags))
+	is.pending++
+	if is.pending < is.cfg.BatchSize {
+		return nil
+	}
+	return is.flush()
+}
+
+// Flush writes everything buffered.
+func (is *InfluxSink) Flush() error {
+	is.mu.Lock()
+	defer is.mu.Unlock()
+	return is.flush()
+}
+
+// Close flushes what is left in the buffer.
+func (is *InfluxSink) Close() error {
+	return is.Flush()
+}
+
+// flush posts the buffer, retrying with backoff. The buffer is dropped even
+// when every attempt fails so a dead server can't grow it without bound.
+func (is *InfluxSink) flush() error {
+	if is.buf.Len() == 0 {
+		return nil
+	}
+	body := bytes.Clone(is.buf.Bytes())
+	is.buf.Reset()
+	is.pending = 0
+	return is.cfg.Backoff.retry(func() error {
+		req, err := http.NewRequest(http.MethodPost, is.cfg.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		if is.cfg.Token != "" {
+			req.Header.Set("Authorization", "Token "+is.cfg.Token)
+		}
+		resp, err := is.cfg.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			return fmt.Errorf("influx write returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+		}
+		return nil
+	})
+}
+
+// InfluxLines serializes snap to line protocol, one line per measurement and
+// tag set with every field of it, ex:
+//
+//	sysmon_cpu,core=0,host=web-01 usage=10.5,frequency=2400 1700000000000000000
+func InfluxLines(snap snapshot.Snapshot, prefix string, tags map[string]string) string {
+	type series struct {
+		key    string
+		fields []string
+		ts     int64
+	}
+	var (
+		order []string
+		lines = make(map[string]*series)
+	)
+	for _, sample := range snap.Samples() {
+		merged := maps.Clone(sample.Tags)
+		maps.Copy(merged, tags)
+		var key strings.Builder
+		key.WriteString(influxEscape(prefix+sample.Measurement, ", "))
+		for _, k := range slices.Sorted(maps.Keys(merged)) {
+			if merged[k] == "" {
+				continue
+			}
+			fmt.Fprintf(&key, ",%s=%s", influxEscape(k, ",= "), influxEscape(merged[k], ",= "))
+		}
+		s, exists := lines[key.String()]
+		if !exists {
+			s = &series{key: key.String(), ts: sample.TimeStamp.UnixNano()}
+			lines[s.key] = s
+			order = append(order, s.key)
+		}
+		s.fields = append(s.fields, influxEscape(sample.Field, ",= ")+"="+strconv.FormatFloat(sample.Value, 'f', -1, 64))
+	}
+	var sb strings.Builder
+	for _, key := range order {
+		s := lines[key]
+		fmt.Fprintf(&sb, "%s %s %d\n", s.key, strings.Join(s.fields, ","), s.ts)
+	}
+	return sb.String()
+}
+
+// influxEscape backslash escapes every character of special in s.
+func influxEscape(s, special string) string {
+	if !strings.ContainsAny(s, special) {
+		return s
+	}
+	var sb strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(special, r) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
@@ -0,0 +1,109 @@
+package sink
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/travis-james/system-monitor/pkg/metrics/cpu"
+	"github.com/travis-james/system-monitor/pkg/metrics/memory"
+	"github.com/travis-james/system-monitor/pkg/snapshot"
+)
+
+func mockSnapshot() snapshot.Snapshot {
+	return snapshot.Snapshot{
+		Labels:    map[string]string{"host": "web 01"},
+		TimeStamp: time.Unix(1700000000, 0),
+		Cpu:       &cpu.CpuMetric{Usage: []float64{10.5, 20}, NumberOfCores: 2, LoadAvg1: 1.5, LoadAvg5: 1, LoadAvg15: 0.5},
+		Memory:    &memory.MemoryMetric{TotalMemory: 4096, UsedMemory: 1024, AvailableMemory: 2048, UsedPercent: 25},
+	}
+}
+
+// fakeInflux is an in-process InfluxDB write endpoint that fails the first
+// failures requests and records the bodies of the rest.
+type fakeInflux struct {
+	mu       sync.Mutex
+	failures int
+	bodies   []string
+	auth     string
+}
+
+func (fi *fakeInflux) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	if fi.failures > 0 {
+		fi.failures--
+		http.Error(w, "mock overloaded", http.StatusServiceUnavailable)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	fi.bodies = append(fi.bodies, string(body))
+	fi.auth = r.Header.Get("Authorization")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func TestInfluxLines(t *testing.T) {
+	t.Parallel()
+	got := InfluxLines(mockSnapshot(), "sysmon_", map[string]string{"env": "prod"})
+	expected := "sysmon_cpu,core=0,env=prod,host=web\\ 01 usage=10.5 1700000000000000000\n" +
+		"sysmon_cpu,core=1,env=prod,host=web\\ 01 usage=20 1700000000000000000\n" +
+		"sysmon_cpu,env=prod,host=web\\ 01 usage_total=15.25,cores=2,load1=1.5,load5=1,load15=0.5 1700000000000000000\n" +
+		"sysmon_memory,env=prod,host=web\\ 01 total=4096,used=1024,available=2048,usage=25 1700000000000000000\n"
+	assert.Equal(t, expected, got)
+}
+
+func TestInfluxSink_BatchesAndRetries(t *testing.T) {
+	t.Parallel()
+	fake := &fakeInflux{failures: 2}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	is := NewInfluxSink(InfluxConfig{
+		URL:       server.URL + "/api/v2/write?org=o&bucket=b",
+		Token:     "secret",
+		BatchSize: 2,
+		Backoff:   Backoff{Retries: 3, Initial: time.Millisecond},
+	})
+	require.Nil(t, is.Write(mockSnapshot()))
+	fake.mu.Lock()
+	assert.Empty(t, fake.bodies, "first snapshot should be buffered")
+	fake.mu.Unlock()
+
+	require.Nil(t, is.Write(mockSnapshot()))
+	fake.mu.Lock()
+	require.Len(t, fake.bodies, 1)
+	assert.Equal(t, 8, strings.Count(fake.bodies[0], "\n"))
+	assert.Equal(t, "Token secret", fake.auth)
+	fake.mu.Unlock()
+
+	require.Nil(t, is.Write(mockSnapshot()))
+	require.Nil(t, is.Close())
+	fake.mu.Lock()
+	assert.Len(t, fake.bodies, 2)
+	fake.mu.Unlock()
+}
+
+func TestInfluxSink_GivesUp(t *testing.T) {
+	t.Parallel()
+	fake := &fakeInflux{failures: 10}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	is := NewInfluxSink(InfluxConfig{URL: server.URL, Backoff: Backoff{Retries: 1, Initial: time.Millisecond}})
+	err := is.Write(mockSnapshot())
+	assert.ErrorContains(t, err, "503")
+	// The failed batch is dropped rather than sent again.
+	assert.Nil(t, is.Flush())
+}
+
+func TestInfluxSink_DefaultTimeout(t *testing.T) {
+	t.Parallel()
+	// A hung endpoint mustn't block the sink's queue, and so shutdown, forever.
+	assert.NotZero(t, NewInfluxSink(InfluxConfig{}).cfg.Client.Timeout)
+}
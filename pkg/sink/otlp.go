@@ -0,0 +1,423 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/travis-james/system-monitor/pkg/snapshot"
+)
+
+const (
+	OTLPProtocolHTTP = "http/protobuf"
+	OTLPProtocolGRPC = "grpc"
+
+	otlpHTTPPath = "/v1/metrics"
+	otlpGRPCPath = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+)
+
+// OTLPConfig configures an OTLPSink.
+type OTLPConfig struct {
+	Endpoint           string            // Collector base URL, ex: http://localhost:4318 for HTTP or http://localhost:4317 for gRPC.
+	Protocol           string            // OTLPProtocolHTTP (the default) or OTLPProtocolGRPC.
+	Headers            map[string]string // Added to every request, ex: for authentication.
+	ResourceAttributes map[string]string // Added to the host's resource attributes.
+	BatchSize          int               // Snapshots to buffer before exporting, 1 or less exports every snapshot.
+	Timeout            time.Duration     // Per request timeout, defaults to 10 seconds.
+	Backoff            Backoff
+}
+
+// OTLPSink exports snapshots as OpenTelemetry metrics over OTLP, named after
+// the system metrics semantic conventions (system.cpu.utilization,
+// system.memory.usage, system.filesystem.usage, system.disk.io, ...).
+type OTLPSink struct {
+	cfg     OTLPConfig
+	client  *http.Client
+	url     string
+	mu      sync.Mutex
+	pending []snapshot.Snapshot
+}
+
+// NewOTLPSink returns an OTLPSink that exports to cfg.Endpoint. gRPC is sent
+// as HTTP/2, without TLS for http:// endpoints.
+func NewOTLPSink(cfg OTLPConfig) (*OTLPSink, error) {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	ot := &OTLPSink{cfg: cfg, client: &http.Client{Timeout: cfg.Timeout, Transport: transport}}
+	endpoint := strings.TrimSuffix(cfg.Endpoint, "/")
+	switch cfg.Protocol {
+	case "", OTLPProtocolHTTP:
+		ot.cfg.Protocol = OTLPProtocolHTTP
+		ot.url = endpoint + otlpHTTPPath
+	case OTLPProtocolGRPC:
+		var protocols http.Protocols
+		protocols.SetHTTP2(true)
+		protocols.SetUnencryptedHTTP2(true)
+		transport.Protocols = &protocols
+		ot.url = endpoint + otlpGRPCPath
+	default:
+		return nil, fmt.Errorf("invalid OTLP protocol: %q", cfg.Protocol)
+	}
+	return ot, nil
+}
+
+// Write buffers snap and exports the buffer once BatchSize snapshots are in it.
+func (ot *OTLPSink) Write(snap snapshot.Snapshot) error {
+	ot.mu.Lock()
+	defer ot.mu.Unlock()
+	ot.pending = append(ot.pending, snap)
+	if len(ot.pending) < ot.cfg.BatchSize {
+		return nil
+	}
+	return ot.flush()
+}
+
+// Flush exports everything buffered.
+func (ot *OTLPSink) Flush() error {
+	ot.mu.Lock()
+	defer ot.mu.Unlock()
+	return ot.flush()
+}
+
+// Close flushes what is left in the buffer.
+func (ot *OTLPSink) Close() error {
+	return ot.Flush()
+}
+
+// flush exports the buffer, retrying with backoff. The buffer is dropped
+// even when every attempt fails.
+func (ot *OTLPSink) flush() error {
+	if len(ot.pending) == 0 {
+		return nil
+	}
+	body := OTLPRequest(ot.pending, ot.cfg.ResourceAttributes)
+	ot.pending = nil
+	return ot.cfg.Backoff.retry(func() error {
+		if ot.cfg.Protocol == OTLPProtocolGRPC {
+			return ot.sendGRPC(body)
+		}
+		return ot.sendHTTP(body)
+	})
+}
+
+func (ot *OTLPSink) sendHTTP(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, ot.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range ot.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := ot.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("OTLP export returned %s", resp.Status)
+	}
+	return nil
+}
+
+// sendGRPC calls MetricsService/Export with body as the only message, framed
+// with the gRPC length prefix, and checks grpc-status in the trailers.
+func (ot *OTLPSink) sendGRPC(body []byte) error {
+	framed := make([]byte, 5, 5+len(body))
+	binary.BigEndian.PutUint32(framed[1:], uint32(len(body)))
+	framed = append(framed, body...)
+	req, err := http.NewRequest(http.MethodPost, ot.url, bytes.NewReader(framed))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	for k, v := range ot.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := ot.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body) // Trailers are only set once the body is read.
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("OTLP export returned %s", resp.Status)
+	}
+	status := resp.Trailer.Get("Grpc-Status")
+	msg := resp.Trailer.Get("Grpc-Message")
+	if status == "" { // Trailers-only responses put the status in the headers.
+		status = resp.Header.Get("Grpc-Status")
+		msg = resp.Header.Get("Grpc-Message")
+	}
+	if status != "0" {
+		return fmt.Errorf("OTLP export returned grpc-status %s: %s", status, msg)
+	}
+	return nil
+}
+
+// otlpAttr is a single attribute, value is a string or an int64.
+type otlpAttr struct {
+	key   string
+	value any
+}
+
+// otlpPoint is a single NumberDataPoint.
+type otlpPoint struct {
+	attrs    []otlpAttr
+	value    float64
+	interval float64 // Seconds the value covers, for delta sums.
+}
+
+// otlpMetric is a single Metric. Sums are cumulative unless delta is set.
+type otlpMetric struct {
+	name, description, unit string
+	sum, monotonic, delta   bool
+	points                  []otlpPoint
+}
+
+// otlpMetrics maps snap onto the OpenTelemetry system metrics semantic
+// conventions. Percentages become 0-1 utilizations, and throughput rates
+// become delta sums over the interval they were measured across.
+func otlpMetrics(snap snapshot.Snapshot) []otlpMetric {
+	var metrics []otlpMetric
+	if c := snap.Cpu; c != nil {
+		util := otlpMetric{name: "system.cpu.utilization", description: "CPU usage over the collection interval.", unit: "1"}
+		for i, usage := range c.Usage {
+			util.points = append(util.points, otlpPoint{attrs: []otlpAttr{{"cpu.logical_number", int64(i)}}, value: usage / 100})
+		}
+		freq := otlpMetric{name: "system.cpu.frequency", description: "Current CPU frequency.", unit: "Hz"}
+		for i, mhz := range c.Frequency {
+			freq.points = append(freq.points, otlpPoint{attrs: []otlpAttr{{"cpu.logical_number", int64(i)}}, value: mhz * 1e6})
+		}
+		metrics = append(metrics, util, freq,
+			otlpMetric{name: "system.cpu.logical.count", unit: "{cpu}", sum: true, points: []otlpPoint{{value: float64(c.NumberOfCores)}}},
+			otlpMetric{name: "system.cpu.physical.count", unit: "{cpu}", sum: true, points: []otlpPoint{{value: float64(c.Inventory.PhysicalCores)}}},
+			otlpMetric{name: "system.cpu.load_average.1m", unit: "{thread}", points: []otlpPoint{{value: c.LoadAvg1}}},
+			otlpMetric{name: "system.cpu.load_average.5m", unit: "{thread}", points: []otlpPoint{{value: c.LoadAvg5}}},
+			otlpMetric{name: "system.cpu.load_average.15m", unit: "{thread}", points: []otlpPoint{{value: c.LoadAvg15}}},
+		)
+	}
+	if m := snap.Memory; m != nil {
+		metrics = append(metrics,
+			otlpMetric{name: "system.memory.usage", description: "Reports memory in use by state.", unit: "By", sum: true,
+				points: []otlpPoint{{attrs: []otlpAttr{{"system.memory.state", "used"}}, value: float64(m.UsedMemory)}}},
+			otlpMetric{name: "system.linux.memory.available", description: "An estimate of how much memory is available for starting new applications, without causing swapping.", unit: "By", sum: true,
+				points: []otlpPoint{{value: float64(m.AvailableMemory)}}},
+		)
+	}
+	if len(snap.Disks) > 0 {
+		var (
+			fsUsage = otlpMetric{name: "system.filesystem.usage", description: "Reports a filesystem's space usage across different states.", unit: "By", sum: true}
+			fsUtil  = otlpMetric{name: "system.filesystem.utilization", unit: "1"}
+			inodes  = otlpMetric{name: "system.filesystem.inodes.usage", unit: "{inode}", sum: true}
+			diskIO  = otlpMetric{name: "system.disk.io", unit: "By", sum: true, monotonic: true, delta: true}
+			diskOps = otlpMetric{name: "system.disk.operations", unit: "{operation}", sum: true, monotonic: true, delta: true}
+		)
+		for _, name := range slices.Sorted(maps.Keys(snap.Disks)) {
+			dm := snap.Disks[name]
+			device, mountpoint := dm.Device, dm.Mountpoint
+			if device == "" {
+				device = name
+			}
+			mode := "rw"
+			if dm.ReadOnly {
+				mode = "ro"
+			}
+			fsAttrs := func(state string) []otlpAttr {
+				attrs := []otlpAttr{
+					{"system.device", device},
+					{"system.filesystem.mountpoint", mountpoint},
+					{"system.filesystem.type", dm.Fstype},
+					{"system.filesystem.mode", mode},
+				}
+				if state != "" {
+					attrs = append(attrs, otlpAttr{"system.filesystem.state", state})
+				}
+				return attrs
+			}
+			fsUsage.points = append(fsUsage.points,
+				otlpPoint{attrs: fsAttrs("used"), value: float64(dm.Used)},
+				otlpPoint{attrs: fsAttrs("free"), value: float64(dm.Free)},
+			)
+			fsUtil.points = append(fsUtil.points, otlpPoint{attrs: fsAttrs(""), value: dm.Usage / 100})
+			inodes.points = append(inodes.points,
+				otlpPoint{attrs: fsAttrs("used"), value: float64(dm.InodesUsed)},
+				otlpPoint{attrs: fsAttrs("free"), value: float64(dm.InodesFree)},
+			)
+			ioAttrs := func(direction string) []otlpAttr {
+				return []otlpAttr{{"system.device", device}, {"disk.io.direction", direction}}
+			}
+			diskIO.points = append(diskIO.points,
+				otlpPoint{attrs: ioAttrs("read"), value: dm.ReadThroughput * dm.Interval, interval: dm.Interval},
+				otlpPoint{attrs: ioAttrs("write"), value: dm.WriteThroughput * dm.Interval, interval: dm.Interval},
+			)
+			diskOps.points = append(diskOps.points,
+				otlpPoint{attrs: ioAttrs("read"), value: dm.ReadOps * dm.Interval, interval: dm.Interval},
+				otlpPoint{attrs: ioAttrs("write"), value: dm.WriteOps * dm.Interval, interval: dm.Interval},
+			)
+		}
+		metrics = append(metrics, fsUsage, fsUtil, inodes, diskIO, diskOps)
+	}
+	if n := snap.Netstat; n != nil {
+		conns := otlpMetric{name: "system.network.connection.count", unit: "{connection}", sum: true}
+		for _, state := range slices.Sorted(maps.Keys(n.TcpStates)) {
+			conns.points = append(conns.points, otlpPoint{
+				attrs: []otlpAttr{{"network.transport", "tcp"}, {"network.connection.state", strings.ToLower(state)}},
+				value: float64(n.TcpStates[state]),
+			})
+		}
+		conns.points = append(conns.points, otlpPoint{attrs: []otlpAttr{{"network.transport", "udp"}}, value: float64(n.UdpTotal)})
+		metrics = append(metrics, conns)
+	}
+	return append(metrics, otlpGauges(snap)...)
+}
+
+// otlpMapped is the samples that otlpMetrics maps onto the semantic
+// conventions, by measurement and then field, with every field when empty.
+var otlpMapped = map[string][]string{
+	"cpu":     nil,
+	"disk":    nil,
+	"memory":  nil,
+	"netstat": {"tcp_sockets", "udp_total"},
+}
+
+// otlpGauges returns a gauge named system_monitor.<measurement>.<field> for
+// every sample the semantic conventions have no metric for, ex: vmstat and
+// systemd, with the sample's tags as attributes.
+func otlpGauges(snap snapshot.Snapshot) []otlpMetric {
+	var (
+		gauges []otlpMetric
+		byName = make(map[string]int)
+	)
+	for _, sample := range snap.Metrics() {
+		if fields, mapped := otlpMapped[sample.Measurement]; mapped && (fields == nil || slices.Contains(fields, sample.Field)) {
+			continue
+		}
+		name := "system_monitor." + sample.Measurement + "." + sample.Field
+		i, exists := byName[name]
+		if !exists {
+			i = len(gauges)
+			byName[name] = i
+			gauges = append(gauges, otlpMetric{name: name})
+		}
+		var attrs []otlpAttr
+		for _, k := range slices.Sorted(maps.Keys(sample.Tags)) {
+			attrs = append(attrs, otlpAttr{k, sample.Tags[k]})
+		}
+		gauges[i].points = append(gauges[i].points, otlpPoint{attrs: attrs, value: sample.Value})
+	}
+	return gauges
+}
+
+// otlpResource maps snap's host labels onto the host and os resource
+// semantic conventions, adding extra on top.
+func otlpResource(snap snapshot.Snapshot, extra map[string]string) []otlpAttr {
+	attrs := map[string]string{
+		"service.name": "system-monitor",
+		"host.name":    snap.Labels["host"],
+		"host.id":      snap.Labels["machine_id"],
+		"os.type":      snap.Labels["os"],
+		"os.version":   snap.Labels["kernel"],
+	}
+	if snap.Host != nil {
+		attrs["host.arch"] = snap.Host.KernelArch
+	}
+	maps.Copy(attrs, extra)
+	var result []otlpAttr
+	for _, k := range slices.Sorted(maps.Keys(attrs)) {
+		if attrs[k] != "" {
+			result = append(result, otlpAttr{k, attrs[k]})
+		}
+	}
+	return result
+}
+
+// OTLPRequest encodes snaps as an ExportMetricsServiceRequest, one
+// ResourceMetrics per snapshot.
+func OTLPRequest(snaps []snapshot.Snapshot, resourceAttributes map[string]string) []byte {
+	var req protoBuf
+	for _, snap := range snaps {
+		var resource protoBuf
+		for _, attr := range otlpResource(snap, resourceAttributes) {
+			resource.message(1, encodeAttr(attr))
+		}
+		var scope protoBuf
+		scope.string(1, "github.com/travis-james/system-monitor")
+		var scopeMetrics protoBuf
+		scopeMetrics.message(1, scope)
+
+		ts := uint64(snap.TimeStamp.UnixNano())
+		for _, m := range otlpMetrics(snap) {
+			if len(m.points) == 0 {
+				continue
+			}
+			var points protoBuf
+			for _, p := range m.points {
+				start := ts
+				if m.delta {
+					start = ts - uint64(p.interval*float64(time.Second))
+				}
+				var point protoBuf
+				point.fixed64(2, start)
+				point.fixed64(3, ts)
+				point.double(4, p.value)
+				for _, attr := range p.attrs {
+					point.message(7, encodeAttr(attr))
+				}
+				points.message(1, point)
+			}
+			var metric protoBuf
+			metric.string(1, m.name)
+			metric.string(2, m.description)
+			metric.string(3, m.unit)
+			if m.sum {
+				temporality := uint64(2) // AGGREGATION_TEMPORALITY_CUMULATIVE
+				if m.delta {
+					temporality = 1 // AGGREGATION_TEMPORALITY_DELTA
+				}
+				points.varint(2, temporality)
+				if m.monotonic {
+					points.varint(3, 1)
+				}
+				metric.message(7, points)
+			} else {
+				metric.message(5, points)
+			}
+			scopeMetrics.message(2, metric)
+		}
+
+		var resourceMetrics protoBuf
+		resourceMetrics.message(1, resource)
+		resourceMetrics.message(2, scopeMetrics)
+		req.message(1, resourceMetrics)
+	}
+	return req
+}
+
+// encodeAttr encodes a KeyValue with a string or int AnyValue.
+func encodeAttr(attr otlpAttr) protoBuf {
+	var value protoBuf
+	switch v := attr.value.(type) {
+	case int64:
+		value.int64(3, v)
+	case string:
+		value.bytes(1, []byte(v))
+	default:
+		value.bytes(1, []byte(fmt.Sprint(v)))
+	}
+	var kv protoBuf
+	kv.string(1, attr.key)
+	kv.message(2, value)
+	return kv
+}
@@ -0,0 +1,239 @@
+package sink
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/travis-james/system-monitor/pkg/metrics/disk"
+	"github.com/travis-james/system-monitor/pkg/metrics/netstat"
+	"github.com/travis-james/system-monitor/pkg/metrics/vmstat"
+	"github.com/travis-james/system-monitor/pkg/snapshot"
+)
+
+// protoFields is a decoded protobuf message, values are uint64 for varint
+// and fixed64 fields and []byte for length delimited ones.
+type protoFields map[int][]any
+
+func decodeProto(t *testing.T, b []byte) protoFields {
+	t.Helper()
+	fields := make(protoFields)
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		require.Greater(t, n, 0)
+		b = b[n:]
+		field := int(key >> 3)
+		switch key & 7 {
+		case wireVarint:
+			v, n := binary.Uvarint(b)
+			require.Greater(t, n, 0)
+			fields[field] = append(fields[field], v)
+			b = b[n:]
+		case wireFixed64:
+			fields[field] = append(fields[field], binary.LittleEndian.Uint64(b))
+			b = b[8:]
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			require.Greater(t, n, 0)
+			fields[field] = append(fields[field], b[n:n+int(l)])
+			b = b[n+int(l):]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+	}
+	return fields
+}
+
+func (pf protoFields) messages(t *testing.T, field int) []protoFields {
+	var result []protoFields
+	for _, v := range pf[field] {
+		result = append(result, decodeProto(t, v.([]byte)))
+	}
+	return result
+}
+
+func (pf protoFields) string(field int) string {
+	if len(pf[field]) == 0 {
+		return ""
+	}
+	return string(pf[field][0].([]byte))
+}
+
+// exportedMetric is what the fake collector keeps of each metric it receives.
+type exportedMetric struct {
+	unit   string
+	sum    bool
+	values []float64
+}
+
+// decodeExport returns the resource attributes of the first ResourceMetrics
+// and every metric, keyed by name, in an ExportMetricsServiceRequest.
+func decodeExport(t *testing.T, body []byte) (map[string]string, map[string]exportedMetric) {
+	t.Helper()
+	resourceMetrics := decodeProto(t, body).messages(t, 1)
+	require.NotEmpty(t, resourceMetrics)
+	attrs := make(map[string]string)
+	for _, kv := range resourceMetrics[0].messages(t, 1)[0].messages(t, 1) {
+		attrs[kv.string(1)] = kv.messages(t, 2)[0].string(1)
+	}
+	metrics := make(map[string]exportedMetric)
+	for _, rm := range resourceMetrics {
+		for _, sm := range rm.messages(t, 2) {
+			for _, m := range sm.messages(t, 2) {
+				em := exportedMetric{unit: m.string(3)}
+				data := m.messages(t, 5)
+				if len(data) == 0 {
+					data = m.messages(t, 7)
+					em.sum = true
+				}
+				for _, point := range data[0].messages(t, 1) {
+					em.values = append(em.values, math.Float64frombits(point[4][0].(uint64)))
+				}
+				metrics[m.string(1)] = em
+			}
+		}
+	}
+	return attrs, metrics
+}
+
+// fakeCollector is an in-process OTLP collector for both HTTP and gRPC that
+// records the body of every export.
+type fakeCollector struct {
+	mu     sync.Mutex
+	bodies [][]byte
+	paths  []string
+}
+
+func (fc *fakeCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if r.Header.Get("Content-Type") == "application/grpc" {
+		if len(body) < 5 || int(binary.BigEndian.Uint32(body[1:5])) != len(body)-5 {
+			w.Header().Set("Grpc-Status", "13")
+			return
+		}
+		body = body[5:]
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Write([]byte{0, 0, 0, 0, 0}) // Empty ExportMetricsServiceResponse.
+		w.Header().Set(http.TrailerPrefix+"Grpc-Status", "0")
+	}
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.bodies = append(fc.bodies, body)
+	fc.paths = append(fc.paths, r.URL.Path)
+}
+
+func otlpSnapshot() snapshot.Snapshot {
+	snap := mockSnapshot()
+	snap.Labels = map[string]string{"host": "web-01", "machine_id": "abc-123", "os": "linux", "kernel": "6.8.0"}
+	snap.Disks = map[string]disk.DiskMetric{"/": {
+		Device:         "/dev/sda1",
+		Mountpoint:     "/",
+		DiskUsage:      disk.DiskUsage{Used: 30, Free: 70, Usage: 30, Fstype: "ext4"},
+		DiskThroughput: disk.DiskThroughput{ReadThroughput: 100, WriteThroughput: 50, Interval: 2},
+	}}
+	return snap
+}
+
+func TestOTLPRequest(t *testing.T) {
+	t.Parallel()
+	attrs, metrics := decodeExport(t, OTLPRequest([]snapshot.Snapshot{otlpSnapshot()}, map[string]string{"deployment.environment": "prod"}))
+	assert.Equal(t, map[string]string{
+		"deployment.environment": "prod",
+		"host.id":                "abc-123",
+		"host.name":              "web-01",
+		"os.type":                "linux",
+		"os.version":             "6.8.0",
+		"service.name":           "system-monitor",
+	}, attrs)
+
+	assert.Equal(t, exportedMetric{unit: "1", values: []float64{0.105, 0.2}}, metrics["system.cpu.utilization"])
+	assert.Equal(t, exportedMetric{unit: "{thread}", values: []float64{1.5}}, metrics["system.cpu.load_average.1m"])
+	assert.Equal(t, exportedMetric{unit: "By", sum: true, values: []float64{1024}}, metrics["system.memory.usage"])
+	assert.Equal(t, exportedMetric{unit: "By", sum: true, values: []float64{30, 70}}, metrics["system.filesystem.usage"])
+	assert.Equal(t, exportedMetric{unit: "By", sum: true, values: []float64{200, 100}}, metrics["system.disk.io"])
+	assert.NotContains(t, metrics, "system.cpu.frequency", "metrics with no points shouldn't be sent")
+	assert.NotContains(t, metrics, "system_monitor.cpu.usage", "mapped samples shouldn't be sent twice")
+}
+
+func TestOTLPRequest_Gauges(t *testing.T) {
+	t.Parallel()
+	snap := otlpSnapshot()
+	snap.Vmstat = &vmstat.VmstatMetric{MajorFaults: 12, OomKills: 1}
+	snap.Netstat = &netstat.NetstatMetric{TcpStates: map[string]int{"LISTEN": 2}, UdpTotal: 1, Retransmits: 3}
+	_, metrics := decodeExport(t, OTLPRequest([]snapshot.Snapshot{snap}, nil))
+	assert.Equal(t, exportedMetric{values: []float64{12}}, metrics["system_monitor.vmstat.major_faults"])
+	assert.Equal(t, exportedMetric{values: []float64{1}}, metrics["system_monitor.vmstat.oom_kills"])
+	assert.Equal(t, exportedMetric{values: []float64{3}}, metrics["system_monitor.netstat.retransmits"])
+	assert.Equal(t, exportedMetric{unit: "{connection}", sum: true, values: []float64{2, 1}}, metrics["system.network.connection.count"])
+	assert.NotContains(t, metrics, "system_monitor.netstat.tcp_sockets")
+}
+
+func TestOTLPSink_HTTP(t *testing.T) {
+	t.Parallel()
+	fake := &fakeCollector{}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	ot, err := NewOTLPSink(OTLPConfig{Endpoint: server.URL, BatchSize: 2})
+	require.Nil(t, err)
+	require.Nil(t, ot.Write(otlpSnapshot()))
+	require.Nil(t, ot.Write(otlpSnapshot()))
+	require.Nil(t, ot.Close())
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	require.Len(t, fake.bodies, 1)
+	assert.Equal(t, "/v1/metrics", fake.paths[0])
+	assert.Len(t, decodeProto(t, fake.bodies[0])[1], 2, "one ResourceMetrics per snapshot")
+}
+
+func TestOTLPSink_GRPC(t *testing.T) {
+	t.Parallel()
+	fake := &fakeCollector{}
+	server := httptest.NewUnstartedServer(fake)
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	defer server.Close()
+
+	ot, err := NewOTLPSink(OTLPConfig{Endpoint: server.URL, Protocol: OTLPProtocolGRPC, Backoff: Backoff{Retries: 1, Initial: time.Millisecond}})
+	require.Nil(t, err)
+	require.Nil(t, ot.Write(otlpSnapshot()))
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	require.Len(t, fake.bodies, 1)
+	assert.Equal(t, otlpGRPCPath, fake.paths[0])
+	_, metrics := decodeExport(t, fake.bodies[0])
+	assert.Contains(t, metrics, "system.cpu.utilization")
+}
+
+func TestOTLPSink_GRPCError(t *testing.T) {
+	t.Parallel()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Grpc-Status", "14")
+		w.Header().Set("Grpc-Message", "unavailable")
+	}))
+	server.Config.Protocols = new(http.Protocols)
+	server.Config.Protocols.SetUnencryptedHTTP2(true)
+	server.Start()
+	defer server.Close()
+
+	ot, err := NewOTLPSink(OTLPConfig{Endpoint: server.URL, Protocol: OTLPProtocolGRPC})
+	require.Nil(t, err)
+	assert.ErrorContains(t, ot.Write(otlpSnapshot()), "grpc-status 14: unavailable")
+}
+
+func TestNewOTLPSink_InvalidProtocol(t *testing.T) {
+	t.Parallel()
+	_, err := NewOTLPSink(OTLPConfig{Endpoint: "http://localhost:4318", Protocol: "carrier-pigeon"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,63 @@
+package sink
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// protoBuf is a minimal protocol buffers encoder, just enough of the wire
+// format to build OTLP requests without generated code.
+type protoBuf []byte
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+func (pb *protoBuf) tag(field, wireType int) {
+	*pb = binary.AppendUvarint(*pb, uint64(field)<<3|uint64(wireType))
+}
+
+// varint writes v to field, omitting it when it is the zero default.
+func (pb *protoBuf) varint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	pb.tag(field, wireVarint)
+	*pb = binary.AppendUvarint(*pb, v)
+}
+
+// int64 always writes v, for oneof fields where zero still has to be sent.
+func (pb *protoBuf) int64(field int, v int64) {
+	pb.tag(field, wireVarint)
+	*pb = binary.AppendUvarint(*pb, uint64(v))
+}
+
+func (pb *protoBuf) fixed64(field int, v uint64) {
+	pb.tag(field, wireFixed64)
+	*pb = binary.LittleEndian.AppendUint64(*pb, v)
+}
+
+func (pb *protoBuf) double(field int, v float64) {
+	pb.fixed64(field, math.Float64bits(v))
+}
+
+func (pb *protoBuf) bytes(field int, v []byte) {
+	pb.tag(field, wireBytes)
+	*pb = binary.AppendUvarint(*pb, uint64(len(v)))
+	*pb = append(*pb, v...)
+}
+
+// string writes v to field, omitting it when it is empty.
+func (pb *protoBuf) string(field int, v string) {
+	if v == "" {
+		return
+	}
+	pb.bytes(field, []byte(v))
+}
+
+// message writes an embedded message to field.
+func (pb *protoBuf) message(field int, m protoBuf) {
+	pb.bytes(field, m)
+}
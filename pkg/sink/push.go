@@ -0,0 +1,262 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/travis-james/system-monitor/pkg/snapshot"
+)
+
+const (
+	DefaultPushBatchSize = 10
+	DefaultMaxSpoolSize  = 64 << 20
+	spoolExt             = ".json.gz"
+)
+
+// PushConfig configures a PushSink.
+type PushConfig struct {
+	URL          string            // Endpoint batches are POSTed to, ex: http://monitor:8080/api/v1/snapshots.
+	Headers      map[string]string // Added to every request, ex: Authorization.
+	BatchSize    int               // Snapshots per batch, DefaultPushBatchSize when 0.
+	Backoff      Backoff
+	SpoolDir     string       // Directory unsent batches are queued in, "" drops them like HTTPSink.
+	MaxSpoolSize int64        // Bytes of batches the spool holds before dropping the oldest, DefaultMaxSpoolSize when 0.
+	Client       *http.Client // Defaults to a client with a 10 second timeout.
+}
+
+// PushSink POSTs batches of snapshots as gzipped JSON arrays, the format the
+// server command accepts. Batches that can't be sent are queued on disk and
+// backfilled in order, ahead of new batches, once the endpoint is back.
+type PushSink struct {
+	cfg     PushConfig
+	mu      sync.Mutex
+	pending []snapshot.Snapshot
+	spool   []spooledBatch // Oldest first.
+	spooled int64          // Bytes in spool.
+	next    uint64         // Sequence number of the next spooled batch.
+	dropped int            // Batches dropped from a full spool.
+}
+
+// spooledBatch is a batch queued in PushConfig.SpoolDir.
+type spooledBatch struct {
+	path string
+	size int64
+}
+
+// NewPushSink returns a PushSink posting to cfg.URL. Batches spooled by a
+// previous PushSink in cfg.SpoolDir are sent first, and batches it was still
+// writing when it stopped are removed.
+func NewPushSink(cfg PushConfig) (*PushSink, error) {
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = DefaultPushBatchSize
+	}
+	if cfg.MaxSpoolSize <= 0 {
+		cfg.MaxSpoolSize = DefaultMaxSpoolSize
+	}
+	ps := &PushSink{cfg: cfg}
+	if cfg.SpoolDir == "" {
+		return ps, nil
+	}
+	if err := os.MkdirAll(cfg.SpoolDir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating spool: %w", err)
+	}
+	entries, err := os.ReadDir(cfg.SpoolDir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading spool: %w", err)
+	}
+	// Entries are sorted by name, which is the zero padded sequence number.
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), spoolExt+".tmp") {
+			os.Remove(filepath.Join(cfg.SpoolDir, entry.Name()))
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(entry.Name(), spoolExt), 10, 64)
+		if err != nil || !strings.HasSuffix(entry.Name(), spoolExt) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("error reading spool: %w", err)
+		}
+		ps.spool = append(ps.spool, spooledBatch{path: filepath.Join(cfg.SpoolDir, entry.Name()), size: info.Size()})
+		ps.spooled += info.Size()
+		ps.next = seq + 1
+	}
+	return ps, nil
+}
+
+// Write buffers snap and sends the buffer once BatchSize snapshots are in it.
+func (ps *PushSink) Write(snap snapshot.Snapshot) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.pending = append(ps.pending, snap)
+	if len(ps.pending) < ps.cfg.BatchSize {
+		return nil
+	}
+	return ps.flush()
+}
+
+// Flush sends everything buffered, and the spool.
+func (ps *PushSink) Flush() error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.flush()
+}
+
+// Close flushes what is left, spooling it if it can't be sent.
+func (ps *PushSink) Close() error {
+	return ps.Flush()
+}
+
+// Spooled returns the batches waiting in the spool and the batches dropped
+// because it was full.
+func (ps *PushSink) Spooled() (batches, dropped int) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return len(ps.spool), ps.dropped
+}
+
+// flush sends the buffer as a batch. While there is a backlog the batch goes
+// to the back of the spool so batches arrive in the order they were made.
+func (ps *PushSink) flush() error {
+	if len(ps.pending) == 0 {
+		return ps.drain()
+	}
+	batch, err := encodeBatch(ps.pending)
+	ps.pending = nil
+	if err != nil {
+		return err
+	}
+	if ps.cfg.SpoolDir == "" {
+		return ps.send(batch)
+	}
+	if len(ps.spool) == 0 {
+		err := ps.send(batch)
+		if err == nil || isPermanent(err) {
+			return err
+		}
+		if spoolErr := ps.push(batch); spoolErr != nil {
+			return errors.Join(err, spoolErr)
+		}
+		return fmt.Errorf("batch spooled: %w", err)
+	}
+	if err := ps.push(batch); err != nil {
+		return err
+	}
+	return ps.drain()
+}
+
+// drain sends the spooled batches oldest first, stopping at the first that
+// fails so it is retried before anything newer. Batches the endpoint rejects,
+// or that can't be read back, are dropped since they would block the spool
+// forever.
+func (ps *PushSink) drain() error {
+	var errs []error
+	for len(ps.spool) > 0 {
+		head := ps.spool[0]
+		batch, err := os.ReadFile(head.path)
+		if err != nil {
+			err = permanentError{fmt.Errorf("error reading spooled batch: %w", err)}
+		} else {
+			err = ps.send(batch)
+		}
+		if err != nil && !isPermanent(err) {
+			errs = append(errs, fmt.Errorf("backfill stopped with %d batches spooled: %w", len(ps.spool), err))
+			break
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("dropping spooled batch: %w", err))
+		}
+		ps.pop()
+	}
+	return errors.Join(errs...)
+}
+
+// push adds batch to the back of the spool, dropping the oldest batches
+// while the spool is over MaxSpoolSize.
+func (ps *PushSink) push(batch []byte) error {
+	path := filepath.Join(ps.cfg.SpoolDir, fmt.Sprintf("%020d%s", ps.next, spoolExt))
+	// Written aside and renamed so a crash never leaves half a batch queued.
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, batch, 0o644); err != nil {
+		return fmt.Errorf("error spooling batch: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error spooling batch: %w", err)
+	}
+	ps.next++
+	ps.spool = append(ps.spool, spooledBatch{path: path, size: int64(len(batch))})
+	ps.spooled += int64(len(batch))
+	for ps.spooled > ps.cfg.MaxSpoolSize && len(ps.spool) > 1 {
+		ps.pop()
+		ps.dropped++
+	}
+	return nil
+}
+
+// pop removes the oldest batch of the spool.
+func (ps *PushSink) pop() {
+	os.Remove(ps.spool[0].path)
+	ps.spooled -= ps.spool[0].size
+	ps.spool = slices.Delete(ps.spool, 0, 1)
+}
+
+// send POSTs a batch, retrying with backoff. Batches the endpoint can't
+// accept (400, 413 and 422) fail permanently. Other errors, ex: 401 or 404
+// while the endpoint is misconfigured, keep the batch for later.
+func (ps *PushSink) send(batch []byte) error {
+	return ps.cfg.Backoff.retry(func() error {
+		req, err := http.NewRequest(http.MethodPost, ps.cfg.URL, bytes.NewReader(batch))
+		if err != nil {
+			return permanentError{err}
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Content-Encoding", "gzip")
+		for k, v := range ps.cfg.Headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := ps.cfg.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode/100 == 2 {
+			return nil
+		}
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		err = fmt.Errorf("push returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+		switch resp.StatusCode {
+		case http.StatusBadRequest, http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+			return permanentError{err}
+		}
+		return err
+	})
+}
+
+// encodeBatch returns snaps as a gzipped JSON array.
+func encodeBatch(snaps []snapshot.Snapshot) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(gz).Encode(snaps); err != nil {
+		return nil, fmt.Errorf("error encoding snapshots: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("error compressing snapshots: %w", err)
+	}
+	return buf.Bytes(), nil
+}
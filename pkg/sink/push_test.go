@@ -0,0 +1,233 @@
+package sink
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/travis-james/system-monitor/pkg/snapshot"
+)
+
+// fakePushEndpoint accepts gzipped JSON arrays of snapshots, or fails with
+// status while it is set.
+type fakePushEndpoint struct {
+	mu       sync.Mutex
+	status   int
+	received []time.Time // TimeStamp of every snapshot received, in order.
+	requests int
+}
+
+func (fe *fakePushEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	fe.requests++
+	if fe.status != 0 {
+		http.Error(w, "mock failure", fe.status)
+		return
+	}
+	if r.Header.Get("Content-Encoding") != "gzip" {
+		http.Error(w, "expected gzip", http.StatusBadRequest)
+		return
+	}
+	gz, err := gzip.NewReader(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var snaps []snapshot.Snapshot
+	if err := json.NewDecoder(gz).Decode(&snaps); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, snap := range snaps {
+		fe.received = append(fe.received, snap.TimeStamp)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (fe *fakePushEndpoint) setStatus(status int) {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	fe.status = status
+}
+
+// snapshotAt returns mockSnapshot stamped i seconds after it.
+func snapshotAt(i int) snapshot.Snapshot {
+	snap := mockSnapshot()
+	snap.TimeStamp = snap.TimeStamp.Add(time.Duration(i) * time.Second)
+	return snap
+}
+
+// pushed returns the offsets in seconds of the snapshots fe received.
+func (fe *fakePushEndpoint) pushed() []int {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	var offsets []int
+	for _, ts := range fe.received {
+		offsets = append(offsets, int(ts.Sub(mockSnapshot().TimeStamp)/time.Second))
+	}
+	return offsets
+}
+
+func spoolFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*"+spoolExt))
+	require.Nil(t, err)
+	return files
+}
+
+func TestPushSink(t *testing.T) {
+	t.Parallel()
+	fe := &fakePushEndpoint{}
+	ts := httptest.NewServer(fe)
+	defer ts.Close()
+	ps, err := NewPushSink(PushConfig{URL: ts.URL, BatchSize: 2})
+	require.Nil(t, err)
+	for i := range 5 {
+		require.Nil(t, ps.Write(snapshotAt(i)))
+	}
+	assert.Equal(t, 2, fe.requests, "snapshots should be sent in batches")
+	require.Nil(t, ps.Close())
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, fe.pushed())
+}
+
+func TestPushSink_Backfill(t *testing.T) {
+	t.Parallel()
+	fe := &fakePushEndpoint{status: http.StatusServiceUnavailable}
+	ts := httptest.NewServer(fe)
+	defer ts.Close()
+	dir := t.TempDir()
+	ps, err := NewPushSink(PushConfig{URL: ts.URL, BatchSize: 1, SpoolDir: dir, Backoff: Backoff{Retries: 1, Initial: time.Millisecond}})
+	require.Nil(t, err)
+
+	assert.NotNil(t, ps.Write(snapshotAt(0)))
+	assert.NotNil(t, ps.Write(snapshotAt(1)))
+	assert.Len(t, spoolFiles(t, dir), 2)
+	batches, dropped := ps.Spooled()
+	assert.Equal(t, 2, batches)
+	assert.Zero(t, dropped)
+
+	fe.setStatus(0)
+	require.Nil(t, ps.Write(snapshotAt(2)))
+	assert.Equal(t, []int{0, 1, 2}, fe.pushed(), "the backlog should be sent in order before new batches")
+	assert.Empty(t, spoolFiles(t, dir))
+}
+
+func TestPushSink_SpoolBound(t *testing.T) {
+	t.Parallel()
+	fe := &fakePushEndpoint{status: http.StatusBadGateway}
+	ts := httptest.NewServer(fe)
+	defer ts.Close()
+	batch, err := encodeBatch([]snapshot.Snapshot{snapshotAt(0)})
+	require.Nil(t, err)
+	ps, err := NewPushSink(PushConfig{URL: ts.URL, BatchSize: 1, SpoolDir: t.TempDir(), MaxSpoolSize: int64(len(batch)*2 + 10)})
+	require.Nil(t, err)
+	for i := range 5 {
+		ps.Write(snapshotAt(i))
+	}
+	batches, dropped := ps.Spooled()
+	assert.Equal(t, 2, batches)
+	assert.Equal(t, 3, dropped)
+
+	fe.setStatus(0)
+	require.Nil(t, ps.Flush())
+	assert.Equal(t, []int{3, 4}, fe.pushed(), "the oldest batches should be dropped first")
+}
+
+func TestPushSink_Restart(t *testing.T) {
+	t.Parallel()
+	fe := &fakePushEndpoint{status: http.StatusServiceUnavailable}
+	ts := httptest.NewServer(fe)
+	defer ts.Close()
+	dir := t.TempDir()
+	cfg := PushConfig{URL: ts.URL, BatchSize: 1, SpoolDir: dir}
+	ps, err := NewPushSink(cfg)
+	require.Nil(t, err)
+	ps.Write(snapshotAt(0))
+	ps.Write(snapshotAt(1))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a batch"), 0o644))
+	// A batch being written when the agent stopped.
+	partial := filepath.Join(dir, fmt.Sprintf("%020d%s.tmp", 2, spoolExt))
+	require.NoError(t, os.WriteFile(partial, []byte("half a batch"), 0o644))
+
+	fe.setStatus(0)
+	ps, err = NewPushSink(cfg)
+	require.Nil(t, err)
+	batches, _ := ps.Spooled()
+	assert.Equal(t, 2, batches, "batches spooled before a restart should be picked up")
+	require.Nil(t, ps.Write(snapshotAt(2)))
+	assert.Equal(t, []int{0, 1, 2}, fe.pushed())
+	assert.NoFileExists(t, partial)
+	assert.FileExists(t, filepath.Join(dir, "notes.txt"), "only spool files should be removed")
+}
+
+func TestPushSink_Rejected(t *testing.T) {
+	t.Parallel()
+	fe := &fakePushEndpoint{status: http.StatusBadRequest}
+	ts := httptest.NewServer(fe)
+	defer ts.Close()
+	dir := t.TempDir()
+	ps, err := NewPushSink(PushConfig{URL: ts.URL, BatchSize: 1, SpoolDir: dir, Backoff: Backoff{Retries: 3, Initial: time.Millisecond}})
+	require.Nil(t, err)
+	assert.ErrorContains(t, ps.Write(snapshotAt(0)), "400")
+	assert.Equal(t, 1, fe.requests, "rejected batches shouldn't be retried")
+	assert.Empty(t, spoolFiles(t, dir), "or spooled")
+}
+
+func TestPushSink_UnreadableSpool(t *testing.T) {
+	t.Parallel()
+	fe := &fakePushEndpoint{status: http.StatusServiceUnavailable}
+	ts := httptest.NewServer(fe)
+	defer ts.Close()
+	dir := t.TempDir()
+	ps, err := NewPushSink(PushConfig{URL: ts.URL, BatchSize: 1, SpoolDir: dir})
+	require.Nil(t, err)
+	ps.Write(snapshotAt(0))
+	ps.Write(snapshotAt(1))
+	files := spoolFiles(t, dir)
+	require.Len(t, files, 2)
+	// The oldest batch went missing, ex: removed by hand or a disk error.
+	require.Nil(t, os.Remove(files[0]))
+
+	fe.setStatus(0)
+	assert.ErrorContains(t, ps.Flush(), "dropping spooled batch")
+	assert.Equal(t, []int{1}, fe.pushed(), "the backfill should carry on past the unreadable batch")
+	batches, _ := ps.Spooled()
+	assert.Zero(t, batches)
+}
+
+func TestPushSink_Refused(t *testing.T) {
+	t.Parallel()
+	for _, status := range []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound} {
+		fe := &fakePushEndpoint{status: status}
+		ts := httptest.NewServer(fe)
+		defer ts.Close()
+		dir := t.TempDir()
+		ps, err := NewPushSink(PushConfig{URL: ts.URL, BatchSize: 1, SpoolDir: dir})
+		require.Nil(t, err)
+		assert.ErrorContains(t, ps.Write(snapshotAt(0)), strconv.Itoa(status))
+		assert.ErrorContains(t, ps.Write(snapshotAt(1)), "backfill stopped")
+		assert.Len(t, spoolFiles(t, dir), 2, "batches refused with %d should be kept", status)
+
+		fe.setStatus(0)
+		require.Nil(t, ps.Flush())
+		assert.Equal(t, []int{0, 1}, fe.pushed())
+	}
+}
+
+func TestPushSink_DefaultTimeout(t *testing.T) {
+	t.Parallel()
+	ps, err := NewPushSink(PushConfig{URL: "http://localhost"})
+	require.Nil(t, err)
+	assert.NotZero(t, ps.cfg.Client.Timeout)
+}
@@ -0,0 +1,283 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/travis-james/system-monitor/pkg/snapshot"
+)
+
+// FormatCSV writes one row per sample, see CSVRows.
+const FormatCSV = "csv"
+
+// rotatedSuffix is appended, after a dot, to the path of a rotated file.
+// It sorts in time order.
+const rotatedSuffix = "20060102-150405.000000000"
+
+// csvHeader is the first row of every CSV file.
+var csvHeader = []string{"timestamp", "measurement", "field", "tags", "value"}
+
+// RotateConfig configures a RotatingFileSink.
+type RotateConfig struct {
+	Path     string        // File written to, rotated files are Path.<time>[.gz] next to it.
+	Format   string        // FormatJSON for NDJSON or FormatCSV.
+	MaxSize  int64         // Rotate before the file grows past this many bytes, 0 for no limit.
+	MaxAge   time.Duration // Rotate once the file has been written to for this long, 0 for no limit.
+	MaxFiles int           // Rotated files to keep, 0 keeps them all.
+	Compress bool          // Gzip rotated files.
+}
+
+// Reopener is a sink that can reopen its files, ex: after logrotate moved
+// them away on SIGHUP.
+type Reopener interface {
+	Reopen() error
+}
+
+// RotatingFileSink writes snapshots to a file, rotating it by size and age.
+type RotatingFileSink struct {
+	cfg    RotateConfig
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time
+	now    func() time.Time
+}
+
+// NewRotatingFileSink returns a RotatingFileSink appending to cfg.Path.
+func NewRotatingFileSink(cfg RotateConfig) (*RotatingFileSink, error) {
+	if cfg.Format != FormatJSON && cfg.Format != FormatCSV {
+		return nil, fmt.Errorf("invalid rotating file format: %s", cfg.Format)
+	}
+	rs := &RotatingFileSink{cfg: cfg, now: time.Now}
+	if err := rs.open(); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// Write appends snap to the file, rotating it first if it is too old or snap
+// would take it past MaxSize.
+func (rs *RotatingFileSink) Write(snap snapshot.Snapshot) error {
+	data, err := rs.encode(snap)
+	if err != nil {
+		return err
+	}
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.file == nil {
+		if err := rs.open(); err != nil {
+			return err
+		}
+	}
+	// Snap is still written when rotating fails, so it isn't lost.
+	var rotateErr error
+	tooOld := rs.cfg.MaxAge > 0 && rs.now().Sub(rs.opened) >= rs.cfg.MaxAge
+	tooBig := rs.cfg.MaxSize > 0 && rs.size+int64(len(data)) > rs.cfg.MaxSize
+	if rs.size > 0 && (tooOld || tooBig) {
+		rotateErr = rs.rotate()
+		if rs.file == nil {
+			// The file couldn't be moved aside, keep appending to it.
+			if err := rs.open(); err != nil {
+				return errors.Join(rotateErr, err)
+			}
+		}
+	}
+	if rs.size == 0 && rs.cfg.Format == FormatCSV {
+		data = append(csvLine(csvHeader), data...)
+	}
+	n, err := rs.file.Write(data)
+	rs.size += int64(n)
+	return errors.Join(rotateErr, err)
+}
+
+// Flush syncs the file to disk.
+func (rs *RotatingFileSink) Flush() error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.file == nil {
+		return nil
+	}
+	return rs.file.Sync()
+}
+
+// Close closes the file.
+func (rs *RotatingFileSink) Close() error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.close()
+}
+
+// Reopen closes the file and opens Path again, which is a new file if it was
+// moved away since.
+func (rs *RotatingFileSink) Reopen() error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if err := rs.close(); err != nil {
+		return err
+	}
+	return rs.open()
+}
+
+func (rs *RotatingFileSink) open() error {
+	file, err := os.OpenFile(rs.cfg.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("error opening output file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("error opening output file: %w", err)
+	}
+	rs.file, rs.size, rs.opened = file, info.Size(), rs.now()
+	return nil
+}
+
+func (rs *RotatingFileSink) close() error {
+	if rs.file == nil {
+		return nil
+	}
+	err := rs.file.Close()
+	rs.file = nil
+	return err
+}
+
+// rotate moves the file aside, opens a new file, compresses the rotated file
+// when configured and removes the rotated files past MaxFiles. The new file
+// is open unless rs.file is nil.
+func (rs *RotatingFileSink) rotate() error {
+	if err := rs.close(); err != nil {
+		return err
+	}
+	rotated := rs.cfg.Path + "." + rs.now().Format(rotatedSuffix)
+	if err := os.Rename(rs.cfg.Path, rotated); err != nil {
+		return fmt.Errorf("error rotating output file: %w", err)
+	}
+	if err := rs.open(); err != nil {
+		return err
+	}
+	var compressErr error
+	if rs.cfg.Compress {
+		compressErr = gzipFile(rotated)
+	}
+	return errors.Join(compressErr, rs.prune())
+}
+
+// prune removes the oldest rotated files so at most MaxFiles are left. Only
+// the files this sink rotated are counted, not ex: logrotate's Path.1.gz.
+func (rs *RotatingFileSink) prune() error {
+	if rs.cfg.MaxFiles <= 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(filepath.Dir(rs.cfg.Path))
+	if err != nil {
+		return fmt.Errorf("error listing rotated files: %w", err)
+	}
+	var rotated []string
+	for _, entry := range entries {
+		if !entry.IsDir() && rs.isRotated(entry.Name()) {
+			rotated = append(rotated, filepath.Join(filepath.Dir(rs.cfg.Path), entry.Name()))
+		}
+	}
+	slices.Sort(rotated)
+	for len(rotated) > rs.cfg.MaxFiles {
+		if err := os.Remove(rotated[0]); err != nil {
+			return fmt.Errorf("error removing rotated file: %w", err)
+		}
+		rotated = rotated[1:]
+	}
+	return nil
+}
+
+// isRotated reports whether name is Path.<rotatedSuffix>[.gz].
+func (rs *RotatingFileSink) isRotated(name string) bool {
+	suffix, found := strings.CutPrefix(name, filepath.Base(rs.cfg.Path)+".")
+	if !found {
+		return false
+	}
+	_, err := time.Parse(rotatedSuffix, strings.TrimSuffix(suffix, ".gz"))
+	return err == nil
+}
+
+// gzipFile replaces path with path.gz.
+func gzipFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error compressing rotated file: %w", err)
+	}
+	defer in.Close()
+	out, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("error compressing rotated file: %w", err)
+	}
+	zw := gzip.NewWriter(out)
+	_, err = io.Copy(zw, in)
+	if err == nil {
+		err = zw.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return fmt.Errorf("error compressing rotated file: %w", err)
+	}
+	return os.Remove(path)
+}
+
+func (rs *RotatingFileSink) encode(snap snapshot.Snapshot) ([]byte, error) {
+	if rs.cfg.Format == FormatCSV {
+		var data []byte
+		for _, row := range CSVRows(snap) {
+			data = append(data, csvLine(row)...)
+		}
+		return data, nil
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding snapshot: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// CSVRows flattens snap to one row per sample with the columns timestamp,
+// measurement, field, tags and value, ex:
+//
+//	2023-11-14T22:13:20Z,cpu,usage,core=0;host=web-01,10.5
+func CSVRows(snap snapshot.Snapshot) [][]string {
+	var rows [][]string
+	for _, sample := range snap.Samples() {
+		var tags []string
+		for _, k := range slices.Sorted(maps.Keys(sample.Tags)) {
+			tags = append(tags, k+"="+sample.Tags[k])
+		}
+		rows = append(rows, []string{
+			sample.TimeStamp.UTC().Format(time.RFC3339Nano),
+			sample.Measurement,
+			sample.Field,
+			strings.Join(tags, ";"),
+			strconv.FormatFloat(sample.Value, 'f', -1, 64),
+		})
+	}
+	return rows
+}
+
+func csvLine(row []string) []byte {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(row)
+	w.Flush()
+	return buf.Bytes()
+}
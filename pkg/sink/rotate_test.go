@@ -0,0 +1,160 @@
+package sink
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClock returns a now func that moves forward a second on every call.
+func fakeClock() func() time.Time {
+	now := time.Unix(1700000000, 0)
+	return func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+}
+
+func rotatedFiles(t *testing.T, path string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(path + ".*")
+	require.Nil(t, err)
+	return matches
+}
+
+func TestRotatingFileSink_Size(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "sysmon.ndjson")
+	line, err := (&RotatingFileSink{cfg: RotateConfig{Format: FormatJSON}}).encode(mockSnapshot())
+	require.Nil(t, err)
+
+	rs, err := NewRotatingFileSink(RotateConfig{Path: path, Format: FormatJSON, MaxSize: int64(2 * len(line)), MaxFiles: 2, Compress: true})
+	require.Nil(t, err)
+	rs.now = fakeClock()
+	for range 7 {
+		require.Nil(t, rs.Write(mockSnapshot()))
+	}
+	require.Nil(t, rs.Close())
+
+	// 7 snapshots at 2 per file is 3 rotations with 1 left in the live file,
+	// and only the newest 2 rotations are kept.
+	current, err := os.ReadFile(path)
+	require.Nil(t, err)
+	assert.Equal(t, string(line), string(current))
+	rotated := rotatedFiles(t, path)
+	require.Len(t, rotated, 2)
+	for _, name := range rotated {
+		assert.True(t, strings.HasSuffix(name, ".gz"))
+		file, err := os.Open(name)
+		require.Nil(t, err)
+		zr, err := gzip.NewReader(file)
+		require.Nil(t, err)
+		data, err := io.ReadAll(zr)
+		require.Nil(t, err)
+		file.Close()
+		assert.Equal(t, strings.Repeat(string(line), 2), string(data))
+	}
+}
+
+func TestRotatingFileSink_Age(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "sysmon.csv")
+	rs, err := NewRotatingFileSink(RotateConfig{Path: path, Format: FormatCSV, MaxAge: time.Minute})
+	require.Nil(t, err)
+	now := time.Now()
+	rs.now = func() time.Time { return now }
+	rs.opened = now
+
+	require.Nil(t, rs.Write(mockSnapshot()))
+	require.Nil(t, rs.Write(mockSnapshot()))
+	assert.Empty(t, rotatedFiles(t, path))
+
+	now = now.Add(time.Minute)
+	require.Nil(t, rs.Write(mockSnapshot()))
+	require.Nil(t, rs.Close())
+	require.Len(t, rotatedFiles(t, path), 1)
+
+	data, err := os.ReadFile(path)
+	require.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	assert.Equal(t, "timestamp,measurement,field,tags,value", lines[0], "every file should start with a header")
+	assert.Equal(t, "2023-11-14T22:13:20Z,cpu,usage,core=0;host=web 01,10.5", lines[1])
+	assert.Len(t, lines, 1+len(CSVRows(mockSnapshot())))
+}
+
+func TestRotatingFileSink_Reopen(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "sysmon.ndjson")
+	rs, err := NewRotatingFileSink(RotateConfig{Path: path, Format: FormatJSON})
+	require.Nil(t, err)
+	require.Nil(t, rs.Write(mockSnapshot()))
+
+	// Like logrotate: move the file away, then signal the writer to reopen.
+	require.Nil(t, os.Rename(path, path+".1"))
+	require.Nil(t, rs.Reopen())
+	require.Nil(t, rs.Write(mockSnapshot()))
+	require.Nil(t, rs.Close())
+
+	for _, name := range []string{path, path + ".1"} {
+		data, err := os.ReadFile(name)
+		require.Nil(t, err)
+		assert.Equal(t, 1, strings.Count(string(data), "\n"))
+	}
+}
+
+func TestRotatingFileSink_PruneOnlyOwnFiles(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "sysmon.ndjson")
+	// Files logrotate and others left next to the output.
+	others := []string{path + ".1", path + ".1.gz", path + ".old", path + ".20231114.gz"}
+	for _, name := range others {
+		require.Nil(t, os.WriteFile(name, nil, 0o644))
+	}
+	rs, err := NewRotatingFileSink(RotateConfig{Path: path, Format: FormatJSON, MaxSize: 1, MaxFiles: 1})
+	require.Nil(t, err)
+	rs.now = fakeClock()
+	for range 3 {
+		require.Nil(t, rs.Write(mockSnapshot()))
+	}
+	require.Nil(t, rs.Close())
+	for _, name := range others {
+		assert.FileExists(t, name)
+	}
+	assert.Len(t, rotatedFiles(t, path), len(others)+1)
+}
+
+func TestRotatingFileSink_CompressFails(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "sysmon.ndjson")
+	rs, err := NewRotatingFileSink(RotateConfig{Path: path, Format: FormatJSON, MaxSize: 1, Compress: true})
+	require.Nil(t, err)
+	now := time.Unix(1700000000, 0)
+	rs.now = func() time.Time { return now }
+	require.Nil(t, rs.Write(mockSnapshot()))
+
+	// The compressed file can't be created, so gzip fails.
+	rotated := path + "." + now.Format(rotatedSuffix)
+	require.Nil(t, os.Mkdir(rotated+".gz", 0o755))
+	assert.NotNil(t, rs.Write(mockSnapshot()))
+	require.Nil(t, rs.Close())
+
+	// Both snapshots are kept, the rotated one uncompressed.
+	for _, name := range []string{path, rotated} {
+		data, err := os.ReadFile(name)
+		require.Nil(t, err)
+		assert.Equal(t, 1, strings.Count(string(data), "\n"))
+	}
+}
+
+func TestNewRotatingFileSink_InvalidFormat(t *testing.T) {
+	t.Parallel()
+	_, err := NewRotatingFileSink(RotateConfig{Path: filepath.Join(t.TempDir(), "out"), Format: FormatText})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,176 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/travis-james/system-monitor/pkg/snapshot"
+)
+
+// Sink is somewhere snapshots are written to. Write may buffer, Flush
+// writes out anything buffered and Close flushes and releases the sink.
+type Sink interface {
+	Write(snap snapshot.Snapshot) error
+	Flush() error
+	Close() error
+}
+
+var (
+	_ Sink = (*WriterSink)(nil)
+	_ Sink = (*HTTPSink)(nil)
+	_ Sink = (*PushSink)(nil)
+	_ Sink = (*InfluxSink)(nil)
+	_ Sink = (*GraphiteSink)(nil)
+	_ Sink = (*OTLPSink)(nil)
+	_ Sink = (*StatsDSink)(nil)
+	_ Sink = (*RotatingFileSink)(nil)
+)
+
+// Output formats of a WriterSink.
+const (
+	FormatText = "text" // Snapshot.String().
+	FormatJSON = "json" // One JSON snapshot per line.
+)
+
+// WriterSink writes every snapshot to an io.Writer as text or JSON.
+type WriterSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format string
+	closer io.Closer // Closed by Close when the sink owns w.
+}
+
+// NewWriterSink returns a WriterSink writing to w in format. Closing it
+// doesn't close w.
+func NewWriterSink(w io.Writer, format string) (*WriterSink, error) {
+	if format != FormatText && format != FormatJSON {
+		return nil, fmt.Errorf("invalid output format: %s", format)
+	}
+	return &WriterSink{w: w, format: format}, nil
+}
+
+// NewFileSink returns a WriterSink appending to the file at path, creating it
+// if needed.
+func NewFileSink(path, format string) (*WriterSink, error) {
+	ws, err := NewWriterSink(nil, format)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening output file: %w", err)
+	}
+	ws.w, ws.closer = file, file
+	return ws, nil
+}
+
+// Write writes snap in the sink's format.
+func (ws *WriterSink) Write(snap snapshot.Snapshot) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.format == FormatJSON {
+		return json.NewEncoder(ws.w).Encode(snap)
+	}
+	_, err := io.WriteString(ws.w, snap.String())
+	return err
+}
+
+// Flush does nothing, every Write goes straight to the writer.
+func (ws *WriterSink) Flush() error {
+	return nil
+}
+
+// Close closes the file opened by NewFileSink.
+func (ws *WriterSink) Close() error {
+	if ws.closer == nil {
+		return nil
+	}
+	return ws.closer.Close()
+}
+
+// HTTPConfig configures an HTTPSink.
+type HTTPConfig struct {
+	URL       string            // Endpoint snapshots are POSTed to.
+	Headers   map[string]string // Added to every request, ex: Authorization.
+	BatchSize int               // Snapshots to buffer before posting, 1 or less posts every snapshot.
+	Backoff   Backoff
+	Client    *http.Client // Defaults to a client with a 10 second timeout.
+}
+
+// HTTPSink POSTs snapshots as a JSON array to an HTTP endpoint.
+type HTTPSink struct {
+	cfg     HTTPConfig
+	mu      sync.Mutex
+	pending []snapshot.Snapshot
+}
+
+// NewHTTPSink returns an HTTPSink posting to cfg.URL.
+func NewHTTPSink(cfg HTTPConfig) *HTTPSink {
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &HTTPSink{cfg: cfg}
+}
+
+// Write buffers snap and posts the buffer once BatchSize snapshots are in it.
+func (hs *HTTPSink) Write(snap snapshot.Snapshot) error {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.pending = append(hs.pending, snap)
+	if len(hs.pending) < hs.cfg.BatchSize {
+		return nil
+	}
+	return hs.flush()
+}
+
+// Flush posts everything buffered.
+func (hs *HTTPSink) Flush() error {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	return hs.flush()
+}
+
+// Close flushes what is left in the buffer.
+func (hs *HTTPSink) Close() error {
+	return hs.Flush()
+}
+
+// flush posts the buffer, retrying with backoff. Like the InfluxSink the
+// buffer is dropped even when every attempt fails.
+func (hs *HTTPSink) flush() error {
+	if len(hs.pending) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(hs.pending)
+	hs.pending = nil
+	if err != nil {
+		return fmt.Errorf("error encoding snapshots: %w", err)
+	}
+	return hs.cfg.Backoff.retry(func() error {
+		req, err := http.NewRequest(http.MethodPost, hs.cfg.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range hs.cfg.Headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := hs.cfg.Client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+			return fmt.Errorf("http sink returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+		}
+		return nil
+	})
+}
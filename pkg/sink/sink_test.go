@@ -0,0 +1,92 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/travis-james/system-monitor/pkg/snapshot"
+)
+
+func TestWriterSink(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	ws, err := NewWriterSink(&buf, FormatText)
+	require.Nil(t, err)
+	require.Nil(t, ws.Write(mockSnapshot()))
+	assert.Equal(t, mockSnapshot().String(), buf.String())
+
+	_, err = NewWriterSink(&buf, "yaml")
+	assert.NotNil(t, err)
+}
+
+func TestFileSink(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "out.ndjson")
+	for range 2 {
+		fs, err := NewFileSink(path, FormatJSON)
+		require.Nil(t, err)
+		require.Nil(t, fs.Write(mockSnapshot()))
+		require.Nil(t, fs.Close())
+	}
+
+	data, err := os.ReadFile(path)
+	require.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2, "reopening should append")
+	var snap snapshot.Snapshot
+	require.Nil(t, json.Unmarshal([]byte(lines[1]), &snap))
+	assert.Equal(t, "web 01", snap.Labels["host"])
+}
+
+func TestHTTPSink(t *testing.T) {
+	t.Parallel()
+	var (
+		bodies []string
+		auth   string
+	)
+	failures := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		auth = r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	hs := NewHTTPSink(HTTPConfig{
+		URL:       server.URL,
+		Headers:   map[string]string{"Authorization": "Bearer secret"},
+		BatchSize: 2,
+		Backoff:   Backoff{Retries: 1, Initial: time.Millisecond},
+	})
+	require.Nil(t, hs.Write(mockSnapshot()))
+	assert.Empty(t, bodies)
+	require.Nil(t, hs.Write(mockSnapshot()))
+	require.Nil(t, hs.Close())
+
+	require.Len(t, bodies, 1)
+	assert.Equal(t, "Bearer secret", auth)
+	var snaps []snapshot.Snapshot
+	require.Nil(t, json.Unmarshal([]byte(bodies[0]), &snaps))
+	assert.Len(t, snaps, 2)
+}
+
+func TestHTTPSink_DefaultTimeout(t *testing.T) {
+	t.Parallel()
+	// A hung endpoint mustn't block the sink's queue, and so shutdown, forever.
+	assert.NotZero(t, NewHTTPSink(HTTPConfig{}).cfg.Client.Timeout)
+}
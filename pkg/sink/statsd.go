@@ -0,0 +1,153 @@
+package sink
+
+import (
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/travis-james/system-monitor/pkg/snapshot"
+)
+
+// DefaultMaxPacketSize keeps StatsD packets under a 1500 byte Ethernet MTU
+// once IP and UDP headers are added.
+const DefaultMaxPacketSize = 1432
+
+// StatsDConfig configures a StatsDSink.
+type StatsDConfig struct {
+	Address       string            // StatsD daemon, ex: localhost:8125.
+	Prefix        string            // Prepended to every metric name, ex: "sysmon" gives sysmon.cpu.usage.
+	DogStatsD     bool              // Send tags as DogStatsD |#tag:value, otherwise tags are folded into the name.
+	Tags          map[string]string // Added to every metric when DogStatsD is set.
+	MaxPacketSize int               // Largest UDP payload, defaults to DefaultMaxPacketSize.
+}
+
+// StatsDSink sends every value of a snapshot as a StatsD gauge over UDP,
+// packing as many gauges into each packet as fit under MaxPacketSize.
+type StatsDSink struct {
+	cfg  StatsDConfig
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewStatsDSink returns a StatsDSink that sends to cfg.Address.
+func NewStatsDSink(cfg StatsDConfig) (*StatsDSink, error) {
+	if cfg.MaxPacketSize <= 0 {
+		cfg.MaxPacketSize = DefaultMaxPacketSize
+	}
+	conn, err := net.Dial("udp", cfg.Address)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to statsd: %w", err)
+	}
+	return &StatsDSink{cfg: cfg, conn: conn}, nil
+}
+
+// Write sends every value in snap. UDP is fire and forget, so an error only
+// means the packet couldn't be handed to the network.
+func (ss *StatsDSink) Write(snap snapshot.Snapshot) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	for _, packet := range statsdPackets(StatsDLines(snap, ss.cfg), ss.cfg.MaxPacketSize) {
+		if _, err := ss.conn.Write(packet); err != nil {
+			return fmt.Errorf("error sending to statsd: %w", err)
+		}
+	}
+	return nil
+}
+
+// Flush does nothing, every Write is sent straight away.
+func (ss *StatsDSink) Flush() error {
+	return nil
+}
+
+// Close closes the UDP socket.
+func (ss *StatsDSink) Close() error {
+	return ss.conn.Close()
+}
+
+// StatsDLines serializes snap to StatsD gauges, one per value, ex:
+//
+//	sysmon.cpu.usage:10.5|g|#core:0,host:web-01
+//
+// or without DogStatsD, where the snapshot labels are left out as the daemon
+// is local to the host:
+//
+//	sysmon.cpu.0.usage:10.5|g
+func StatsDLines(snap snapshot.Snapshot, cfg StatsDConfig) []string {
+	var lines []string
+	for _, sample := range snap.Samples() {
+		name := []string{sample.Measurement}
+		if cfg.Prefix != "" {
+			name = append([]string{cfg.Prefix}, name...)
+		}
+		var tags []string
+		if cfg.DogStatsD {
+			merged := maps.Clone(sample.Tags)
+			maps.Copy(merged, cfg.Tags)
+			for _, k := range slices.Sorted(maps.Keys(merged)) {
+				if merged[k] != "" {
+					tags = append(tags, statsdTag(k)+":"+statsdTag(merged[k]))
+				}
+			}
+		} else {
+			for _, k := range slices.Sorted(maps.Keys(sample.Tags)) {
+				if _, isLabel := snap.Labels[k]; !isLabel {
+					name = append(name, statsdName(sample.Tags[k]))
+				}
+			}
+		}
+		name = append(name, statsdName(sample.Field))
+		line := strings.Join(name, ".") + ":" + strconv.FormatFloat(sample.Value, 'f', -1, 64) + "|g"
+		if len(tags) > 0 {
+			line += "|#" + strings.Join(tags, ",")
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// statsdPackets joins lines with newlines into packets no bigger than max. A
+// single line bigger than max gets a packet of its own.
+func statsdPackets(lines []string, max int) [][]byte {
+	var (
+		packets [][]byte
+		packet  []byte
+	)
+	for _, line := range lines {
+		if len(packet) > 0 && len(packet)+1+len(line) > max {
+			packets = append(packets, packet)
+			packet = nil
+		}
+		if len(packet) > 0 {
+			packet = append(packet, '\n')
+		}
+		packet = append(packet, line...)
+	}
+	if len(packet) > 0 {
+		packets = append(packets, packet)
+	}
+	return packets
+}
+
+// statsdName makes s safe to use as a node of a metric name, ex: /dev/sda1
+// becomes dev_sda1 and / becomes root.
+func statsdName(s string) string {
+	s = strings.Trim(strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, s), "_")
+	if s == "" {
+		return "root"
+	}
+	return s
+}
+
+// statsdTag replaces the characters that separate DogStatsD tags.
+func statsdTag(s string) string {
+	return strings.NewReplacer(",", "_", "|", "_", ":", "_", "#", "_", "\n", "_").Replace(s)
+}
@@ -0,0 +1,67 @@
+package sink
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/travis-james/system-monitor/pkg/metrics/disk"
+)
+
+func TestStatsDLines_DogStatsD(t *testing.T) {
+	t.Parallel()
+	snap := mockSnapshot()
+	snap.Disks = map[string]disk.DiskMetric{"/": {Device: "/dev/sda1", Mountpoint: "/", DiskUsage: disk.DiskUsage{Usage: 42}}}
+	got := StatsDLines(snap, StatsDConfig{Prefix: "sysmon", DogStatsD: true, Tags: map[string]string{"env": "prod"}})
+	assert.Contains(t, got, "sysmon.cpu.usage:10.5|g|#core:0,env:prod,host:web 01")
+	assert.Contains(t, got, "sysmon.disk.usage:42|g|#device:/dev/sda1,env:prod,host:web 01,mountpoint:/")
+	assert.Contains(t, got, "sysmon.memory.used:1024|g|#env:prod,host:web 01")
+}
+
+func TestStatsDLines_Plain(t *testing.T) {
+	t.Parallel()
+	snap := mockSnapshot()
+	snap.Disks = map[string]disk.DiskMetric{"/": {Device: "/dev/sda1", Mountpoint: "/", DiskUsage: disk.DiskUsage{Usage: 42}}}
+	got := StatsDLines(snap, StatsDConfig{Tags: map[string]string{"env": "prod"}})
+	assert.Contains(t, got, "cpu.0.usage:10.5|g")
+	assert.Contains(t, got, "cpu.load1:1.5|g")
+	assert.Contains(t, got, "disk.dev_sda1.root.usage:42|g")
+}
+
+func TestStatsDPackets(t *testing.T) {
+	t.Parallel()
+	lines := []string{"aaaa:1|g", "bbbb:2|g", "cccc:3|g", strings.Repeat("d", 30)}
+	got := statsdPackets(lines, 20)
+	expected := [][]byte{
+		[]byte("aaaa:1|g\nbbbb:2|g"),
+		[]byte("cccc:3|g"),
+		[]byte(strings.Repeat("d", 30)),
+	}
+	assert.Equal(t, expected, got)
+}
+
+func TestStatsDSink(t *testing.T) {
+	t.Parallel()
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer listener.Close()
+
+	ss, err := NewStatsDSink(StatsDConfig{Address: listener.LocalAddr().String(), DogStatsD: true, MaxPacketSize: 100})
+	require.Nil(t, err)
+	defer ss.Close()
+	require.Nil(t, ss.Write(mockSnapshot()))
+
+	var received []string
+	buf := make([]byte, 1500)
+	for len(received) < len(StatsDLines(mockSnapshot(), ss.cfg)) {
+		require.Nil(t, listener.SetReadDeadline(time.Now().Add(time.Second)))
+		n, _, err := listener.ReadFrom(buf)
+		require.Nil(t, err)
+		assert.LessOrEqual(t, n, 100)
+		received = append(received, strings.Split(string(buf[:n]), "\n")...)
+	}
+	assert.Contains(t, received, "cpu.usage:20|g|#core:1,host:web 01")
+}
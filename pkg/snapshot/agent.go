@@ -0,0 +1,92 @@
+package snapshot
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+)
+
+// AgentMetric is how the agent itself is doing: the health of each of its
+// collectors and the resources it uses.
+type AgentMetric struct {
+	Collectors       []CollectorStats // Sorted by metric.
+	SkippedIntervals uint64           // Collections missed because an earlier one overran the interval, set by the loop collecting snapshots.
+	CPU              float64          // Percent of a single core used since the previous snapshot.
+	RSS              uint64           // Resident memory in bytes.
+	Goroutines       int
+}
+
+// CollectorStats is the running record of measuring one metric.
+type CollectorStats struct {
+	Metric    string  // ex: cpu, disk.
+	Duration  float64 // Seconds the latest measurement took.
+	Successes uint64
+	Errors    uint64
+	LastError string `json:",omitempty"` // The latest error, kept after later successes.
+}
+
+// record adds the outcome of measuring metric to the collector's stats.
+func (c *Collector) record(metric string, took time.Duration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stats == nil {
+		c.stats = make(map[string]*CollectorStats)
+	}
+	stats, exists := c.stats[metric]
+	if !exists {
+		stats = &CollectorStats{Metric: metric}
+		c.stats[metric] = stats
+	}
+	stats.Duration = took.Seconds()
+	if err != nil {
+		stats.Errors++
+		stats.LastError = err.Error()
+		return
+	}
+	stats.Successes++
+}
+
+// collectAgent measures the agent into snap. Its CPU is taken over the time
+// since the previous call, or since the agent started on the first.
+func (c *Collector) collectAgent(snap *Snapshot) error {
+	usage, err := c.measureUsage(int32(os.Getpid()))
+	if err != nil {
+		return fmt.Errorf("error measuring agent: %w", err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	am := AgentMetric{RSS: usage.RSS, Goroutines: runtime.NumGoroutine()}
+	for _, stats := range c.stats {
+		am.Collectors = append(am.Collectors, *stats)
+	}
+	slices.SortFunc(am.Collectors, func(a, b CollectorStats) int {
+		return strings.Compare(a.Metric, b.Metric)
+	})
+	now, since, before := time.Now(), usage.Started, 0.0
+	if !c.agentAt.IsZero() {
+		since, before = c.agentAt, c.agentCPUTime
+	}
+	if elapsed := now.Sub(since).Seconds(); elapsed > 0 {
+		am.CPU = max(usage.CPUTime-before, 0) / elapsed * 100
+	}
+	c.agentAt, c.agentCPUTime = now, usage.CPUTime
+	snap.Agent = &am
+	return nil
+}
+
+// String returns a string representation of AgentMetric.
+func (am AgentMetric) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "CPU: %.2f%%\nRSS: %d\nGoroutines: %d\nSkippedIntervals: %d",
+		am.CPU, am.RSS, am.Goroutines, am.SkippedIntervals)
+	for _, stats := range am.Collectors {
+		fmt.Fprintf(&sb, "\nCollector %s: %d successes, %d errors, took %.3fs", stats.Metric, stats.Successes, stats.Errors, stats.Duration)
+		if stats.LastError != "" {
+			fmt.Fprintf(&sb, ", last error: %s", stats.LastError)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,93 @@
+package snapshot
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Decode reads every JSON snapshot in r, ex: a single -format=json snapshot
+// or an NDJSON history file.
+func Decode(r io.Reader) ([]Snapshot, error) {
+	var snaps []Snapshot
+	dec := json.NewDecoder(r)
+	for {
+		var snap Snapshot
+		err := dec.Decode(&snap)
+		if errors.Is(err, io.EOF) {
+			return snaps, nil
+		}
+		if err != nil {
+			return snaps, fmt.Errorf("error decoding snapshot %d: %w", len(snaps)+1, err)
+		}
+		snaps = append(snaps, snap)
+	}
+}
+
+// ReadFiles reads the snapshots in every file matching the glob patterns,
+// gunzipping files ending in .gz, and returns them sorted by time.
+func ReadFiles(patterns ...string) ([]Snapshot, error) {
+	var paths []string
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid history pattern %s: %w", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no history files match %s", pattern)
+		}
+		paths = append(paths, matches...)
+	}
+	var snaps []Snapshot
+	for _, path := range paths {
+		read, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		snaps = append(snaps, read...)
+	}
+	slices.SortStableFunc(snaps, func(a, b Snapshot) int {
+		return a.TimeStamp.Compare(b.TimeStamp)
+	})
+	return snaps, nil
+}
+
+func readFile(path string) ([]Snapshot, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening history: %w", err)
+	}
+	defer file.Close()
+	var r io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		zr, err := gzip.NewReader(file)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", path, err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	snaps, err := Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return snaps, nil
+}
+
+// Between returns the snapshots taken in [from, to).
+func Between(snaps []Snapshot, from, to time.Time) []Snapshot {
+	var window []Snapshot
+	for _, snap := range snaps {
+		if !snap.TimeStamp.Before(from) && snap.TimeStamp.Before(to) {
+			window = append(window, snap)
+		}
+	}
+	return window
+}
@@ -0,0 +1,59 @@
+package snapshot
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecode(t *testing.T) {
+	t.Parallel()
+	// NDJSON and an indented snapshot mixed in the same stream.
+	in := `{"TimeStamp":"2023-11-14T22:13:20Z","Memory":{"UsedMemory":1}}
+{"TimeStamp":"2023-11-14T22:13:30Z","Memory":{"UsedMemory":2}}
+{
+  "TimeStamp": "2023-11-14T22:13:40Z"
+}
+`
+	snaps, err := Decode(strings.NewReader(in))
+	require.Nil(t, err)
+	require.Len(t, snaps, 3)
+	assert.Equal(t, uint64(2), snaps[1].Memory.UsedMemory)
+
+	snaps, err = Decode(strings.NewReader(in + "{oops"))
+	assert.ErrorContains(t, err, "snapshot 4")
+	assert.Len(t, snaps, 3)
+}
+
+func TestReadFiles(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	require.Nil(t, os.WriteFile(filepath.Join(dir, "sysmon.ndjson"), []byte(`{"TimeStamp":"2023-11-14T22:13:40Z"}`+"\n"), 0o644))
+	file, err := os.Create(filepath.Join(dir, "sysmon.ndjson.1.gz"))
+	require.Nil(t, err)
+	zw := gzip.NewWriter(file)
+	zw.Write([]byte(`{"TimeStamp":"2023-11-14T22:13:20Z"}` + "\n" + `{"TimeStamp":"2023-11-14T22:13:30Z"}` + "\n"))
+	require.Nil(t, zw.Close())
+	require.Nil(t, file.Close())
+
+	snaps, err := ReadFiles(filepath.Join(dir, "sysmon.ndjson*"))
+	require.Nil(t, err)
+	require.Len(t, snaps, 3)
+	start := time.Date(2023, 11, 14, 22, 13, 20, 0, time.UTC)
+	for i, snap := range snaps {
+		assert.True(t, start.Add(time.Duration(i)*10*time.Second).Equal(snap.TimeStamp), "snapshots should be in time order")
+	}
+
+	window := Between(snaps, start.Add(10*time.Second), start.Add(20*time.Second))
+	require.Len(t, window, 1)
+	assert.True(t, start.Add(10*time.Second).Equal(window[0].TimeStamp))
+
+	_, err = ReadFiles(filepath.Join(dir, "missing*"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,89 @@
+package snapshot
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Source produces snapshots, either live from a Collector or recorded from
+// a Replayer, so the rest of the pipeline can't tell them apart.
+type Source interface {
+	Collect() (Snapshot, error)
+}
+
+var (
+	_ Source = (*Collector)(nil)
+	_ Source = (*Replayer)(nil)
+)
+
+// Replayer is a Source of recorded snapshots, ex: read with ReadFiles. It
+// replays whole snapshots rather than plugging into the collectors' measure
+// funcs since recordings hold the computed metrics, not the raw counters
+// those funcs return.
+type Replayer struct {
+	Speed  float64 // 1 replays in real time, 10 ten times faster, 0 or less as fast as possible.
+	Retime bool    // Set each snapshot's TimeStamp to when it is replayed, the metrics keep their recorded times.
+
+	ctx     context.Context
+	snaps   []Snapshot
+	next    int
+	started time.Time // When the first snapshot was replayed.
+	now     func() time.Time
+	sleep   func(context.Context, time.Duration) error
+}
+
+// NewReplayer returns a Replayer of snaps, which should be in time order,
+// at real time speed. Cancelling ctx stops the replay.
+func NewReplayer(ctx context.Context, snaps []Snapshot) *Replayer {
+	return &Replayer{
+		Speed: 1,
+		ctx:   ctx,
+		snaps: snaps,
+		now:   time.Now,
+		sleep: sleepContext,
+	}
+}
+
+// Collect waits until the next snapshot is due, keeping the recorded gaps
+// between snapshots divided by Speed, and returns it. It returns io.EOF
+// once every snapshot was replayed, or ctx's error if it is cancelled.
+func (r *Replayer) Collect() (Snapshot, error) {
+	if r.next >= len(r.snaps) {
+		return Snapshot{}, io.EOF
+	}
+	snap := r.snaps[r.next]
+	if r.next == 0 {
+		r.started = r.now()
+	} else if r.Speed > 0 {
+		offset := snap.TimeStamp.Sub(r.snaps[0].TimeStamp)
+		due := r.started.Add(time.Duration(float64(offset) / r.Speed))
+		if err := r.sleep(r.ctx, due.Sub(r.now())); err != nil {
+			return Snapshot{}, err
+		}
+	}
+	if err := r.ctx.Err(); err != nil {
+		return Snapshot{}, err
+	}
+	r.next++
+	if r.Retime {
+		snap.TimeStamp = r.now()
+	}
+	return snap, nil
+}
+
+// sleepContext sleeps for d, returning early with ctx's error if it is
+// cancelled.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
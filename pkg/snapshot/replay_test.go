@@ -0,0 +1,79 @@
+package snapshot
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockReplayer returns a Replayer of snapshots taken at the given seconds
+// with a fake clock that only moves when it sleeps, and the sleeps it made.
+func mockReplayer(ctx context.Context, seconds ...int) (*Replayer, *[]time.Duration) {
+	start := time.Unix(1700000000, 0)
+	var snaps []Snapshot
+	for _, s := range seconds {
+		snaps = append(snaps, Snapshot{TimeStamp: start.Add(time.Duration(s) * time.Second)})
+	}
+	r := NewReplayer(ctx, snaps)
+	now := time.Unix(1800000000, 0)
+	var sleeps []time.Duration
+	r.now = func() time.Time { return now }
+	r.sleep = func(_ context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		now = now.Add(d)
+		return nil
+	}
+	return r, &sleeps
+}
+
+func TestReplayer(t *testing.T) {
+	t.Parallel()
+	r, sleeps := mockReplayer(context.Background(), 0, 10, 30)
+	r.Speed = 2
+	for _, expected := range []int64{1700000000, 1700000010, 1700000030} {
+		snap, err := r.Collect()
+		require.Nil(t, err)
+		assert.Equal(t, expected, snap.TimeStamp.Unix(), "recorded timestamps should be kept")
+	}
+	_, err := r.Collect()
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, []time.Duration{5 * time.Second, 10 * time.Second}, *sleeps)
+}
+
+func TestReplayer_Retime(t *testing.T) {
+	t.Parallel()
+	r, _ := mockReplayer(context.Background(), 0, 60)
+	r.Retime = true
+	first, err := r.Collect()
+	require.Nil(t, err)
+	second, err := r.Collect()
+	require.Nil(t, err)
+	assert.Equal(t, int64(1800000000), first.TimeStamp.Unix())
+	assert.Equal(t, int64(1800000060), second.TimeStamp.Unix())
+}
+
+func TestReplayer_AsFastAsPossible(t *testing.T) {
+	t.Parallel()
+	r, sleeps := mockReplayer(context.Background(), 0, 10, 30)
+	r.Speed = 0
+	for range 3 {
+		_, err := r.Collect()
+		require.Nil(t, err)
+	}
+	assert.Empty(t, *sleeps)
+}
+
+func TestReplayer_Cancelled(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithCancel(context.Background())
+	r := NewReplayer(ctx, []Snapshot{{TimeStamp: time.Unix(0, 0)}, {TimeStamp: time.Unix(3600, 0)}})
+	_, err := r.Collect()
+	require.Nil(t, err)
+	cancel()
+	_, err = r.Collect()
+	assert.ErrorIs(t, err, context.Canceled)
+}
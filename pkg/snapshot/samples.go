@@ -0,0 +1,237 @@
+package snapshot
+
+import (
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sample is a single numeric value out of a Snapshot, for outputs that write
+// one value per line or packet.
+type Sample struct {
+	Measurement string            // ex: cpu, disk, memory.
+	Field       string            // ex: usage, load1.
+	Tags        map[string]string // The snapshot's labels plus ex: core, device, mountpoint.
+	Value       float64
+	TimeStamp   time.Time
+}
+
+// Samples flattens the snapshot into one Sample per value. The order is the
+// same for every call so output built from it is stable.
+func (s Snapshot) Samples() []Sample {
+	var samples []Sample
+	add := func(measurement, field string, tags map[string]string, value float64) {
+		merged := maps.Clone(s.Labels)
+		if merged == nil {
+			merged = make(map[string]string)
+		}
+		maps.Copy(merged, tags)
+		samples = append(samples, Sample{
+			Measurement: measurement,
+			Field:       field,
+			Tags:        merged,
+			Value:       value,
+			TimeStamp:   s.TimeStamp,
+		})
+	}
+
+	if s.Cpu != nil {
+		total := 0.0
+		for i, usage := range s.Cpu.Usage {
+			add("cpu", "usage", map[string]string{"core": strconv.Itoa(i)}, usage)
+			total += usage
+		}
+		if len(s.Cpu.Usage) > 0 {
+			// The mean over every core, for one value per host.
+			add("cpu", "usage_total", nil, total/float64(len(s.Cpu.Usage)))
+		}
+		for i, mhz := range s.Cpu.Frequency {
+			add("cpu", "frequency", map[string]string{"core": strconv.Itoa(i)}, mhz)
+		}
+		add("cpu", "cores", nil, float64(s.Cpu.NumberOfCores))
+		// Parts of a partial measurement have no samples rather than 0s.
+		if !s.Cpu.NoLoadAvg {
+			add("cpu", "load1", nil, s.Cpu.LoadAvg1)
+			add("cpu", "load5", nil, s.Cpu.LoadAvg5)
+			add("cpu", "load15", nil, s.Cpu.LoadAvg15)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(s.Disks)) {
+		dm := s.Disks[name]
+		tags := map[string]string{"device": dm.Device, "mountpoint": dm.Mountpoint}
+		if dm.Device == "" {
+			tags["device"] = name
+		}
+		add("disk", "total", tags, float64(dm.Total))
+		add("disk", "used", tags, float64(dm.Used))
+		add("disk", "free", tags, float64(dm.Free))
+		add("disk", "usage", tags, dm.Usage)
+		add("disk", "inodes_used", tags, float64(dm.InodesUsed))
+		add("disk", "inodes_free", tags, float64(dm.InodesFree))
+		add("disk", "inodes_usage", tags, dm.InodesUsage)
+		if dm.DiskThroughput.Interval == 0 {
+			continue
+		}
+		add("disk", "read_bytes", tags, dm.ReadThroughput)
+		add("disk", "write_bytes", tags, dm.WriteThroughput)
+		add("disk", "read_ops", tags, dm.ReadOps)
+		add("disk", "write_ops", tags, dm.WriteOps)
+		add("disk", "iops", tags, dm.TotalIOPS)
+	}
+	if s.Memory != nil {
+		add("memory", "total", nil, float64(s.Memory.TotalMemory))
+		add("memory", "used", nil, float64(s.Memory.UsedMemory))
+		add("memory", "available", nil, float64(s.Memory.AvailableMemory))
+		add("memory", "usage", nil, s.Memory.UsedPercent)
+	}
+	if s.Watch != nil {
+		tags := map[string]string{"pid": strconv.Itoa(int(s.Watch.Pid))}
+		if s.Watch.Match != "" {
+			tags = map[string]string{"match": s.Watch.Match}
+		}
+		add("process", "count", tags, float64(len(s.Watch.Pids)))
+		add("process", "cpu_user", tags, s.Watch.CPUUser)
+		add("process", "cpu_system", tags, s.Watch.CPUSystem)
+		add("process", "rss", tags, float64(s.Watch.RSS))
+		add("process", "pss", tags, float64(s.Watch.PSS))
+		add("process", "swap", tags, float64(s.Watch.Swap))
+		add("process", "threads", tags, float64(s.Watch.Threads))
+		add("process", "fds", tags, float64(s.Watch.FDs))
+		add("process", "read_bytes", tags, s.Watch.ReadBytes)
+		add("process", "write_bytes", tags, s.Watch.WriteBytes)
+		add("process", "voluntary_switches", tags, s.Watch.VoluntarySwitches)
+		add("process", "involuntary_switches", tags, s.Watch.InvoluntarySwitches)
+	}
+	if s.Sched != nil {
+		add("sched", "context_switches", nil, s.Sched.ContextSwitches)
+		add("sched", "interrupts", nil, s.Sched.Interrupts)
+		add("sched", "softirqs", nil, s.Sched.SoftIrqs)
+		add("sched", "forks", nil, s.Sched.Forks)
+		add("sched", "procs_running", nil, float64(s.Sched.ProcsRunning))
+		add("sched", "procs_blocked", nil, float64(s.Sched.ProcsBlocked))
+		add("sched", "threads", nil, float64(s.Sched.Threads))
+	}
+	if s.Sensors != nil {
+		for _, t := range s.Sensors.Temperatures {
+			add("sensors", "temperature", map[string]string{"chip": t.Chip, "label": t.Label}, t.Current)
+		}
+		for _, f := range s.Sensors.Fans {
+			add("sensors", "fan_rpm", map[string]string{"chip": f.Chip, "label": f.Label}, f.RPM)
+		}
+		for _, t := range s.Sensors.Throttles {
+			tags := map[string]string{"cpu": strconv.Itoa(t.CPU)}
+			add("sensors", "core_throttles", tags, float64(t.Core))
+			add("sensors", "package_throttles", tags, float64(t.Package))
+		}
+	}
+	if s.Netstat != nil {
+		for _, state := range slices.Sorted(maps.Keys(s.Netstat.TcpStates)) {
+			add("netstat", "tcp_sockets", map[string]string{"state": state}, float64(s.Netstat.TcpStates[state]))
+		}
+		add("netstat", "tcp_total", nil, float64(s.Netstat.TcpTotal))
+		add("netstat", "listening", nil, float64(s.Netstat.Listening))
+		add("netstat", "udp_total", nil, float64(s.Netstat.UdpTotal))
+		add("netstat", "retransmits", nil, s.Netstat.Retransmits)
+		add("netstat", "resets_sent", nil, s.Netstat.ResetsSent)
+		add("netstat", "estab_resets", nil, s.Netstat.EstabResets)
+		add("netstat", "listen_overflows", nil, s.Netstat.ListenOverflows)
+		add("netstat", "listen_drops", nil, s.Netstat.ListenDrops)
+		add("netstat", "udp_in_errors", nil, s.Netstat.UdpInErrors)
+		add("netstat", "udp_no_ports", nil, s.Netstat.UdpNoPorts)
+		add("netstat", "udp_rcvbuf_errors", nil, s.Netstat.UdpRcvbufErrors)
+		add("netstat", "udp_sndbuf_errors", nil, s.Netstat.UdpSndbufErrors)
+		for _, g := range s.Netstat.Groups {
+			tags := map[string]string{"group": g.Key}
+			add("netstat_group", "tcp", tags, float64(g.Tcp))
+			add("netstat_group", "udp", tags, float64(g.Udp))
+		}
+	}
+	if s.Vmstat != nil {
+		add("vmstat", "major_faults", nil, s.Vmstat.MajorFaults)
+		add("vmstat", "minor_faults", nil, s.Vmstat.MinorFaults)
+		add("vmstat", "page_ins", nil, s.Vmstat.PageIns)
+		add("vmstat", "page_outs", nil, s.Vmstat.PageOuts)
+		add("vmstat", "swap_ins", nil, s.Vmstat.SwapIns)
+		add("vmstat", "swap_outs", nil, s.Vmstat.SwapOuts)
+		add("vmstat", "direct_reclaims", nil, s.Vmstat.DirectReclaims)
+		add("vmstat", "compact_stalls", nil, s.Vmstat.CompactStalls)
+		add("vmstat", "oom_kills", nil, float64(s.Vmstat.OomKills))
+	}
+	if s.Process != nil {
+		add("processes", "total", nil, float64(s.Process.Processes))
+		for _, g := range s.Process.Groups {
+			tags := map[string]string{"group": g.Key}
+			add("process_group", "processes", tags, float64(g.Processes))
+			add("process_group", "cpu", tags, g.CPU)
+			add("process_group", "rss", tags, float64(g.RSS))
+			add("process_group", "read_bytes", tags, g.ReadBytes)
+			add("process_group", "write_bytes", tags, g.WriteBytes)
+		}
+	}
+	if s.Systemd != nil {
+		add("systemd", "failed_units", nil, float64(len(s.Systemd.Failed)))
+		for _, u := range s.Systemd.Units {
+			tags := map[string]string{"unit": u.Name}
+			add("systemd", "active", tags, boolValue(u.ActiveState == "active"))
+			add("systemd", "failed", tags, boolValue(u.ActiveState == "failed"))
+			add("systemd", "restarts", tags, float64(u.Restarts))
+			add("systemd", "cpu", tags, u.CPU)
+			add("systemd", "memory", tags, float64(u.Memory))
+			add("systemd", "tasks", tags, float64(u.Tasks))
+			add("systemd", "read_bytes", tags, u.ReadBytes)
+			add("systemd", "write_bytes", tags, u.WriteBytes)
+		}
+	}
+	if s.Agent != nil {
+		add("agent", "cpu", nil, s.Agent.CPU)
+		add("agent", "rss", nil, float64(s.Agent.RSS))
+		add("agent", "goroutines", nil, float64(s.Agent.Goroutines))
+		add("agent", "skipped_intervals", nil, float64(s.Agent.SkippedIntervals))
+		for _, stats := range s.Agent.Collectors {
+			tags := map[string]string{"metric": stats.Metric}
+			add("collector", "duration", tags, stats.Duration)
+			add("collector", "successes", tags, float64(stats.Successes))
+			add("collector", "errors", tags, float64(stats.Errors))
+		}
+	}
+	return samples
+}
+
+// boolValue returns 1 for true and 0 for false.
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// Metrics is Samples with the snapshot's labels left out of the tags, for
+// comparing or aggregating snapshots of the same host.
+func (s Snapshot) Metrics() []Sample {
+	samples := s.Samples()
+	for i := range samples {
+		maps.DeleteFunc(samples[i].Tags, func(k, _ string) bool {
+			_, isLabel := s.Labels[k]
+			return isLabel
+		})
+		if len(samples[i].Tags) == 0 {
+			samples[i].Tags = nil
+		}
+	}
+	return samples
+}
+
+// Name identifies the series the sample belongs to, ex: cpu.usage{core=0}.
+func (s Sample) Name() string {
+	name := s.Measurement + "." + s.Field
+	if len(s.Tags) == 0 {
+		return name
+	}
+	var tags []string
+	for _, k := range slices.Sorted(maps.Keys(s.Tags)) {
+		tags = append(tags, k+"="+s.Tags[k])
+	}
+	return name + "{" + strings.Join(tags, ",") + "}"
+}
@@ -0,0 +1,175 @@
+package snapshot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/travis-james/system-monitor/pkg/metrics/cpu"
+	"github.com/travis-james/system-monitor/pkg/metrics/disk"
+	"github.com/travis-james/system-monitor/pkg/metrics/memory"
+	"github.com/travis-james/system-monitor/pkg/metrics/netstat"
+	"github.com/travis-james/system-monitor/pkg/metrics/process"
+	"github.com/travis-james/system-monitor/pkg/metrics/sched"
+	"github.com/travis-james/system-monitor/pkg/metrics/sensors"
+	"github.com/travis-james/system-monitor/pkg/metrics/systemd"
+	"github.com/travis-james/system-monitor/pkg/metrics/vmstat"
+)
+
+func TestSamples(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	snap := Snapshot{
+		Labels:    map[string]string{"host": "web-01"},
+		TimeStamp: now,
+		Cpu:       &cpu.CpuMetric{Usage: []float64{10, 20}, NumberOfCores: 2, LoadAvg1: 1.5},
+		Disks: map[string]disk.DiskMetric{
+			"sda": {Device: "/dev/sda", Mountpoint: "/", DiskUsage: disk.DiskUsage{Used: 50, Usage: 50}, DiskThroughput: disk.DiskThroughput{Interval: 1}},
+		},
+		Memory: &memory.MemoryMetric{UsedMemory: 1, AvailableMemory: 2},
+	}
+	got := snap.Samples()
+	require.Len(t, got, 7+12+4)
+	assert.Equal(t, Sample{
+		Measurement: "cpu",
+		Field:       "usage",
+		Tags:        map[string]string{"host": "web-01", "core": "1"},
+		Value:       20,
+		TimeStamp:   now,
+	}, got[1])
+	assert.Equal(t, "usage_total", got[2].Field)
+	assert.Equal(t, 15.0, got[2].Value)
+	assert.Equal(t, "load1", got[4].Field)
+	assert.Equal(t, 1.5, got[4].Value)
+	assert.Equal(t, map[string]string{"host": "web-01", "device": "/dev/sda", "mountpoint": "/"}, got[7].Tags)
+	assert.Equal(t, "usage", got[len(got)-1].Field)
+
+	// The labels shouldn't be shared with, or changed by, the samples.
+	assert.Equal(t, map[string]string{"host": "web-01"}, snap.Labels)
+}
+
+func TestSamples_Partial(t *testing.T) {
+	t.Parallel()
+	snap := Snapshot{
+		Cpu: &cpu.CpuMetric{Usage: []float64{10}, NumberOfCores: 1, NoLoadAvg: true},
+		Disks: map[string]disk.DiskMetric{
+			"tmp": {Device: "tmpfs", Mountpoint: "/tmp", DiskUsage: disk.DiskUsage{Used: 50, Usage: 50}},
+		},
+	}
+	var names []string
+	for _, sample := range snap.Samples() {
+		names = append(names, sample.Measurement+"."+sample.Field)
+	}
+	assert.Equal(t, []string{"cpu.usage", "cpu.usage_total", "cpu.cores",
+		"disk.total", "disk.used", "disk.free", "disk.usage", "disk.inodes_used", "disk.inodes_free", "disk.inodes_usage",
+	}, names, "what wasn't measured shouldn't be reported as 0")
+}
+
+func TestSamples_Watch(t *testing.T) {
+	t.Parallel()
+	snap := Snapshot{Watch: &process.WatchMetric{Match: "nginx", Pids: []int32{100, 101}, RSS: 300}}
+	got := snap.Metrics()
+	require.Len(t, got, 12)
+	assert.Equal(t, "process.count{match=nginx}", got[0].Name())
+	assert.Equal(t, 2.0, got[0].Value)
+	assert.Equal(t, "process.rss{match=nginx}", got[3].Name())
+	assert.Equal(t, 300.0, got[3].Value)
+
+	snap = Snapshot{Watch: &process.WatchMetric{Pid: 100, Pids: []int32{100}}}
+	assert.Equal(t, "process.count{pid=100}", snap.Metrics()[0].Name())
+}
+
+func TestSamples_Agent(t *testing.T) {
+	t.Parallel()
+	snap := Snapshot{Agent: &AgentMetric{
+		Collectors:       []CollectorStats{{Metric: "cpu", Duration: 1.5, Successes: 3, Errors: 1}},
+		SkippedIntervals: 2,
+		RSS:              300,
+	}}
+	got := snap.Metrics()
+	require.Len(t, got, 7)
+	assert.Equal(t, "agent.rss", got[1].Name())
+	assert.Equal(t, 300.0, got[1].Value)
+	assert.Equal(t, "agent.skipped_intervals", got[3].Name())
+	assert.Equal(t, 2.0, got[3].Value)
+	assert.Equal(t, "collector.duration{metric=cpu}", got[4].Name())
+	assert.Equal(t, 1.5, got[4].Value)
+	assert.Equal(t, "collector.errors{metric=cpu}", got[6].Name())
+	assert.Equal(t, 1.0, got[6].Value)
+}
+
+func TestSamples_Sections(t *testing.T) {
+	t.Parallel()
+	snap := Snapshot{
+		Sched: &sched.SchedMetric{ContextSwitches: 1000, ProcsRunning: 3},
+		Sensors: &sensors.SensorsMetric{
+			Temperatures: []sensors.Temperature{{Chip: "coretemp", Label: "Core 0", Current: 45}},
+			Fans:         []sensors.Fan{{Chip: "nct6775", Label: "CPU fan", RPM: 1250}},
+			Throttles:    []sensors.Throttle{{CPU: 1, Core: 3, Package: 7}},
+		},
+		Netstat: &netstat.NetstatMetric{
+			TcpStates:   map[string]int{"TIME_WAIT": 4, "ESTABLISHED": 10},
+			Retransmits: 2.5,
+			Groups:      []netstat.SocketGroup{{Key: "443", Tcp: 12}},
+		},
+		Vmstat:  &vmstat.VmstatMetric{MajorFaults: 5, OomKills: 1},
+		Process: &process.ProcessMetric{Processes: 200, Groups: []process.ProcessGroup{{Key: "nginx", Processes: 4, CPU: 150}}},
+		Systemd: &systemd.SystemdMetric{
+			Units:  []systemd.Unit{{Name: "nginx.service", ActiveState: "active", Restarts: 2}, {Name: "cron.service", ActiveState: "failed"}},
+			Failed: []string{"cron.service"},
+		},
+	}
+	values := make(map[string]float64)
+	for _, s := range snap.Metrics() {
+		values[s.Name()] = s.Value
+	}
+	for name, want := range map[string]float64{
+		"sched.context_switches":                          1000,
+		"sched.procs_running":                             3,
+		"sensors.temperature{chip=coretemp,label=Core 0}": 45,
+		"sensors.fan_rpm{chip=nct6775,label=CPU fan}":     1250,
+		"sensors.package_throttles{cpu=1}":                7,
+		"netstat.tcp_sockets{state=ESTABLISHED}":          10,
+		"netstat.retransmits":                             2.5,
+		"netstat_group.tcp{group=443}":                    12,
+		"vmstat.major_faults":                             5,
+		"vmstat.oom_kills":                                1,
+		"processes.total":                                 200,
+		"process_group.cpu{group=nginx}":                  150,
+		"systemd.failed_units":                            1,
+		"systemd.active{unit=nginx.service}":              1,
+		"systemd.restarts{unit=nginx.service}":            2,
+		"systemd.failed{unit=cron.service}":               1,
+		"systemd.active{unit=cron.service}":               0,
+	} {
+		got, exists := values[name]
+		if assert.True(t, exists, name) {
+			assert.Equal(t, want, got, name)
+		}
+	}
+}
+
+func TestSamples_Empty(t *testing.T) {
+	t.Parallel()
+	assert.Empty(t, Snapshot{}.Samples())
+}
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+	snap := Snapshot{
+		Labels: map[string]string{"host": "web-01"},
+		Cpu:    &cpu.CpuMetric{Usage: []float64{10}, NumberOfCores: 1},
+	}
+	got := snap.Metrics()
+	require.Len(t, got, 6)
+	assert.Equal(t, map[string]string{"core": "0"}, got[0].Tags)
+	assert.Equal(t, "cpu.usage{core=0}", got[0].Name())
+	assert.Nil(t, got[1].Tags)
+	assert.Equal(t, "cpu.usage_total", got[1].Name())
+	assert.Equal(t, "disk.usage{device=/dev/sda,mountpoint=/}", Sample{
+		Measurement: "disk",
+		Field:       "usage",
+		Tags:        map[string]string{"mountpoint": "/", "device": "/dev/sda"},
+	}.Name())
+}
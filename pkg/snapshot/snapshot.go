@@ -0,0 +1,322 @@
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/travis-james/system-monitor/pkg/metrics"
+	"github.com/travis-james/system-monitor/pkg/metrics/cpu"
+	"github.com/travis-james/system-monitor/pkg/metrics/disk"
+	"github.com/travis-james/system-monitor/pkg/metrics/host"
+	"github.com/travis-james/system-monitor/pkg/metrics/memory"
+	"github.com/travis-james/system-monitor/pkg/metrics/netstat"
+	"github.com/travis-james/system-monitor/pkg/metrics/process"
+	"github.com/travis-james/system-monitor/pkg/metrics/sched"
+	"github.com/travis-james/system-monitor/pkg/metrics/sensors"
+	"github.com/travis-james/system-monitor/pkg/metrics/systemd"
+	"github.com/travis-james/system-monitor/pkg/metrics/vmstat"
+)
+
+// Snapshot is every metric collected at one point in time, labelled with the
+// host it came from. Metrics that weren't collected are nil.
+type Snapshot struct {
+	Labels    map[string]string
+	TimeStamp time.Time
+	Host      *host.HostMetric           `json:",omitempty"`
+	Cpu       *cpu.CpuMetric             `json:",omitempty"`
+	Disks     map[string]disk.DiskMetric `json:",omitempty"` // Keyed by the disk name passed to the collector.
+	Memory    *memory.MemoryMetric       `json:",omitempty"`
+	Sched     *sched.SchedMetric         `json:",omitempty"`
+	Sensors   *sensors.SensorsMetric     `json:",omitempty"`
+	Netstat   *netstat.NetstatMetric     `json:",omitempty"`
+	Vmstat    *vmstat.VmstatMetric       `json:",omitempty"`
+	Process   *process.ProcessMetric     `json:",omitempty"`
+	Watch     *process.WatchMetric       `json:",omitempty"`
+	Systemd   *systemd.SystemdMetric     `json:",omitempty"`
+	Agent     *AgentMetric               `json:",omitempty"`
+	Anomalies []Anomaly                  `json:",omitempty"` // Values that deviated from their baseline, see pkg/anomaly.
+}
+
+// Anomaly is a value of a snapshot that is Score standard deviations away
+// from the baseline learned for it.
+type Anomaly struct {
+	Measurement string
+	Field       string
+	Tags        map[string]string `json:",omitempty"` // ex: core, device, the snapshot labels are left out.
+	Value       float64
+	Mean        float64
+	Stddev      float64
+	Score       float64
+}
+
+// String returns a string representation of Anomaly.
+func (a Anomaly) String() string {
+	name := Sample{Measurement: a.Measurement, Field: a.Field, Tags: a.Tags}.Name()
+	return fmt.Sprintf("%s is %.2f, %+.1f sigma from its baseline of %.2f±%.2f", name, a.Value, a.Score, a.Mean, a.Stddev)
+}
+
+// Collector builds snapshots out of the metrics it is asked for.
+type Collector struct {
+	Identity host.Identity
+	Metrics  []string // Metrics to collect: cpu, disk, memory, host, sched, sensors, netstat, vmstat, process, watch, systemd, agent.
+	Disks    []string // Disk names to measure when Metrics has disk.
+	Seconds  float64  // Duration to measure metrics over where applicable.
+
+	NetstatGroupBy netstat.GroupBy // How to break down socket counts when Metrics has netstat.
+	ProcessGroupBy process.GroupBy // How to roll up processes when Metrics has process.
+	ProcessTop     int             // Process groups to keep when Metrics has process, 0 for all.
+	WatchTarget    process.Target  // The processes to follow when Metrics has watch.
+	SystemdUnits   []string        // Units to measure when Metrics has systemd, every service when empty.
+
+	measureCpu     func(float64) (cpu.CpuMetric, error)
+	measureDisk    func(string, float64) (disk.DiskMetric, error)
+	measureMemory  func() (memory.MemoryMetric, error)
+	measureHost    func() (host.HostMetric, error)
+	measureSched   func(float64) (sched.SchedMetric, error)
+	measureSensors func() (sensors.SensorsMetric, error)
+	measureNetstat func(float64, netstat.GroupBy) (netstat.NetstatMetric, error)
+	measureVmstat  func(float64) (vmstat.VmstatMetric, error)
+	measureProcess func(float64, process.GroupBy, int) (process.ProcessMetric, error)
+	measureWatch   func(float64, process.Target) (process.WatchMetric, error)
+	measureSystemd func(float64, []string) (systemd.SystemdMetric, error)
+	measureUsage   func(int32) (process.Usage, error)
+
+	mu           sync.Mutex
+	stats        map[string]*CollectorStats // Keyed by metric, for the agent metric.
+	agentAt      time.Time                  // When the agent was last measured.
+	agentCPUTime float64                    // CPU seconds the agent had used when it was last measured.
+}
+
+// NewCollector returns a Collector that labels its snapshots with identity.
+func NewCollector(identity host.Identity, metrics, disks []string, seconds float64) *Collector {
+	return &Collector{
+		Identity:       identity,
+		Metrics:        metrics,
+		Disks:          disks,
+		Seconds:        seconds,
+		measureCpu:     cpu.MeasureCpuMetrics,
+		measureDisk:    disk.MeasureDiskMetrics,
+		measureMemory:  memory.MeasureMemoryMetrics,
+		measureHost:    host.MeasureHostMetrics,
+		measureSched:   sched.MeasureSchedMetrics,
+		measureSensors: sensors.MeasureSensorsMetrics,
+		measureNetstat: netstat.MeasureNetstatMetrics,
+		measureVmstat:  vmstat.MeasureVmstatMetrics,
+		measureProcess: process.MeasureProcessMetrics,
+		measureWatch:   process.MeasureWatchMetrics,
+		measureSystemd: systemd.MeasureSystemdMetrics,
+		measureUsage:   process.MeasureUsage,
+	}
+}
+
+// Collect measures every metric in c.Metrics. Metrics are measured at the
+// same time so the ones taken over an interval (cpu, disk, sched, netstat,
+// vmstat, process, watch, systemd) all cover the same interval. A metric that fails to be measured is
+// left out of the snapshot and its error is joined into the returned error,
+// so the rest of the snapshot can still be used. How long each metric took
+// and whether it failed is kept for agent, which is measured once the
+// others are done. A metric given more than once is measured once.
+func (c *Collector) Collect() (Snapshot, error) {
+	snap := Snapshot{
+		Labels:    c.Identity.Labels(),
+		TimeStamp: time.Now(),
+	}
+	names := unique(c.Metrics)
+	var (
+		wg   sync.WaitGroup
+		errs = make([]error, len(names))
+	)
+	for i, metric := range names {
+		if metric == "agent" {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			errs[i] = c.collect(metric, &snap)
+			c.record(metric, time.Since(start), errs[i])
+		}()
+	}
+	wg.Wait()
+	if slices.Contains(names, "agent") {
+		errs = append(errs, c.collectAgent(&snap))
+	}
+	return snap, errors.Join(errs...)
+}
+
+// unique returns names without the ones given more than once, keeping the
+// order they were first given in.
+func unique(names []string) []string {
+	var uniq []string
+	for _, name := range names {
+		if !slices.Contains(uniq, name) {
+			uniq = append(uniq, name)
+		}
+	}
+	return uniq
+}
+
+// collect measures a single metric into snap. Each metric has its own field
+// in Snapshot so collect can be called for different metrics at once. A
+// metric that was partly measured, see metrics.ErrPartial, is kept in snap
+// along with its error.
+func (c *Collector) collect(metric string, snap *Snapshot) error {
+	switch metric {
+	case "cpu":
+		cpuMetric, err := c.measureCpu(c.Seconds)
+		if err != nil {
+			err = fmt.Errorf("error measuring CPU: %w", err)
+			if !errors.Is(err, metrics.ErrPartial) {
+				return err
+			}
+		}
+		snap.Cpu = &cpuMetric
+		return err
+	case "disk":
+		if len(c.Disks) == 0 {
+			return errors.New("no disk was chosen to measure")
+		}
+		// Disks are measured at the same time too, so they cover the same
+		// interval as the other metrics.
+		var (
+			wg    sync.WaitGroup
+			mu    sync.Mutex
+			names = unique(c.Disks)
+			errs  = make([]error, len(names))
+		)
+		for i, name := range names {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				diskMetric, err := c.measureDisk(name, c.Seconds)
+				if err != nil {
+					errs[i] = fmt.Errorf("error measuring disk %s: %w", name, err)
+					if !errors.Is(err, metrics.ErrPartial) {
+						return
+					}
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				if snap.Disks == nil {
+					snap.Disks = make(map[string]disk.DiskMetric)
+				}
+				snap.Disks[name] = diskMetric
+			}()
+		}
+		wg.Wait()
+		return errors.Join(errs...)
+	case "memory":
+		memoryMetric, err := c.measureMemory()
+		if err != nil {
+			return fmt.Errorf("error measuring memory: %w", err)
+		}
+		snap.Memory = &memoryMetric
+	case "host":
+		hostMetric, err := c.measureHost()
+		if err != nil {
+			return fmt.Errorf("error measuring host: %w", err)
+		}
+		snap.Host = &hostMetric
+	case "sched":
+		schedMetric, err := c.measureSched(c.Seconds)
+		if err != nil {
+			return fmt.Errorf("error measuring scheduler stats: %w", err)
+		}
+		snap.Sched = &schedMetric
+	case "sensors":
+		sensorsMetric, err := c.measureSensors()
+		if err != nil {
+			return fmt.Errorf("error measuring sensors: %w", err)
+		}
+		snap.Sensors = &sensorsMetric
+	case "netstat":
+		netstatMetric, err := c.measureNetstat(c.Seconds, c.NetstatGroupBy)
+		if err != nil {
+			return fmt.Errorf("error measuring netstat: %w", err)
+		}
+		snap.Netstat = &netstatMetric
+	case "vmstat":
+		vmstatMetric, err := c.measureVmstat(c.Seconds)
+		if err != nil {
+			return fmt.Errorf("error measuring vmstat: %w", err)
+		}
+		snap.Vmstat = &vmstatMetric
+	case "process":
+		processMetric, err := c.measureProcess(c.Seconds, c.ProcessGroupBy, c.ProcessTop)
+		if err != nil {
+			return fmt.Errorf("error measuring processes: %w", err)
+		}
+		snap.Process = &processMetric
+	case "watch":
+		watchMetric, err := c.measureWatch(c.Seconds, c.WatchTarget)
+		if err != nil {
+			return fmt.Errorf("error watching process: %w", err)
+		}
+		snap.Watch = &watchMetric
+	case "systemd":
+		systemdMetric, err := c.measureSystemd(c.Seconds, c.SystemdUnits)
+		if err != nil {
+			return fmt.Errorf("error measuring systemd units: %w", err)
+		}
+		snap.Systemd = &systemdMetric
+	default:
+		return fmt.Errorf("invalid metric type: %s", metric)
+	}
+	return nil
+}
+
+// String returns a string representation of Snapshot.
+func (s Snapshot) String() string {
+	var sb strings.Builder
+	sb.WriteString("Labels:")
+	for _, k := range slices.Sorted(maps.Keys(s.Labels)) {
+		fmt.Fprintf(&sb, " %s=%s", k, s.Labels[k])
+	}
+	fmt.Fprintf(&sb, "\nTimeStamp: %v\n", s.TimeStamp)
+	if s.Host != nil {
+		fmt.Fprintf(&sb, "Host Metrics: %s\n", s.Host.String())
+	}
+	if s.Cpu != nil {
+		fmt.Fprintf(&sb, "CPU Metrics: %s\n", s.Cpu.String())
+	}
+	for _, name := range slices.Sorted(maps.Keys(s.Disks)) {
+		fmt.Fprintf(&sb, "Disk Metrics (%s): %s\n", name, s.Disks[name].String())
+	}
+	if s.Memory != nil {
+		fmt.Fprintf(&sb, "Memory Metrics: %s\n", s.Memory.String())
+	}
+	if s.Sched != nil {
+		fmt.Fprintf(&sb, "Sched Metrics: %s\n", s.Sched.String())
+	}
+	if s.Sensors != nil {
+		fmt.Fprintf(&sb, "Sensors Metrics: %s\n", s.Sensors.String())
+	}
+	if s.Netstat != nil {
+		fmt.Fprintf(&sb, "Netstat Metrics: %s\n", s.Netstat.String())
+	}
+	if s.Vmstat != nil {
+		fmt.Fprintf(&sb, "Vmstat Metrics: %s\n", s.Vmstat.String())
+	}
+	if s.Process != nil {
+		fmt.Fprintf(&sb, "Process Metrics: %s\n", s.Process.String())
+	}
+	if s.Watch != nil {
+		fmt.Fprintf(&sb, "Watch Metrics: %s\n", s.Watch.String())
+	}
+	if s.Systemd != nil {
+		fmt.Fprintf(&sb, "Systemd Metrics: %s\n", s.Systemd.String())
+	}
+	if s.Agent != nil {
+		fmt.Fprintf(&sb, "Agent Metrics: %s\n", s.Agent.String())
+	}
+	for _, a := range s.Anomalies {
+		fmt.Fprintf(&sb, "Anomaly: %s\n", a.String())
+	}
+	return sb.String()
+}
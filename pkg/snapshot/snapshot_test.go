@@ -0,0 +1,225 @@
+package snapshot
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/travis-james/system-monitor/pkg/metrics"
+	"github.com/travis-james/system-monitor/pkg/metrics/cpu"
+	"github.com/travis-james/system-monitor/pkg/metrics/disk"
+	"github.com/travis-james/system-monitor/pkg/metrics/host"
+	"github.com/travis-james/system-monitor/pkg/metrics/memory"
+	"github.com/travis-james/system-monitor/pkg/metrics/netstat"
+	"github.com/travis-james/system-monitor/pkg/metrics/process"
+	"github.com/travis-james/system-monitor/pkg/metrics/sched"
+	"github.com/travis-james/system-monitor/pkg/metrics/sensors"
+	"github.com/travis-james/system-monitor/pkg/metrics/systemd"
+	"github.com/travis-james/system-monitor/pkg/metrics/vmstat"
+)
+
+var mockIdentity = host.Identity{Hostname: "web-01", MachineID: "abc-123", OS: "linux", KernelVersion: "6.8.0"}
+
+func mockCollector(metrics, disks []string) *Collector {
+	c := NewCollector(mockIdentity, metrics, disks, 1)
+	c.measureCpu = func(seconds float64) (cpu.CpuMetric, error) {
+		return cpu.CpuMetric{Usage: []float64{10, 20}, NumberOfCores: 2, TimeInterval: seconds}, nil
+	}
+	c.measureDisk = func(name string, interval float64) (disk.DiskMetric, error) {
+		if name == "missing" {
+			return disk.DiskMetric{}, errors.New("mock disk error")
+		}
+		return disk.DiskMetric{DiskUsage: disk.DiskUsage{Total: 100, Used: 50}}, nil
+	}
+	c.measureMemory = func() (memory.MemoryMetric, error) {
+		return memory.MemoryMetric{UsedMemory: 1, AvailableMemory: 2}, nil
+	}
+	c.measureHost = func() (host.HostMetric, error) {
+		return host.HostMetric{Identity: mockIdentity, Users: 3}, nil
+	}
+	c.measureSched = func(seconds float64) (sched.SchedMetric, error) {
+		return sched.SchedMetric{ContextSwitches: 100, TimeInterval: seconds}, nil
+	}
+	c.measureSensors = func() (sensors.SensorsMetric, error) {
+		return sensors.SensorsMetric{}, nil
+	}
+	c.measureNetstat = func(seconds float64, groupBy netstat.GroupBy) (netstat.NetstatMetric, error) {
+		return netstat.NetstatMetric{TcpTotal: 4, Groups: []netstat.SocketGroup{{Key: string(groupBy)}}, TimeInterval: seconds}, nil
+	}
+	c.measureVmstat = func(seconds float64) (vmstat.VmstatMetric, error) {
+		return vmstat.VmstatMetric{OomKills: 1, TimeInterval: seconds}, nil
+	}
+	c.measureProcess = func(seconds float64, groupBy process.GroupBy, top int) (process.ProcessMetric, error) {
+		return process.ProcessMetric{GroupBy: groupBy, Groups: make([]process.ProcessGroup, top), TimeInterval: seconds}, nil
+	}
+	c.measureWatch = func(seconds float64, target process.Target) (process.WatchMetric, error) {
+		return process.WatchMetric{Pid: target.Pid, Pids: []int32{target.Pid}, TimeInterval: seconds}, nil
+	}
+	c.measureSystemd = func(seconds float64, units []string) (systemd.SystemdMetric, error) {
+		sm := systemd.SystemdMetric{TimeInterval: seconds}
+		for _, name := range units {
+			sm.Units = append(sm.Units, systemd.Unit{Name: name, ActiveState: "active"})
+		}
+		return sm, nil
+	}
+	c.measureUsage = func(pid int32) (process.Usage, error) {
+		return process.Usage{CPUTime: 1, RSS: 4096, Started: time.Now().Add(-10 * time.Second)}, nil
+	}
+	return c
+}
+
+func TestCollect(t *testing.T) {
+	t.Parallel()
+	c := mockCollector([]string{"cpu", "disk", "memory", "host", "sched", "sensors", "netstat", "vmstat", "process", "watch", "systemd"}, []string{"sda"})
+	c.NetstatGroupBy = netstat.GroupByPort
+	c.ProcessGroupBy = process.GroupByUnit
+	c.ProcessTop = 2
+	c.WatchTarget = process.Target{Pid: 1234}
+	c.SystemdUnits = []string{"nginx.service"}
+	got, err := c.Collect()
+	require.Nil(t, err)
+	assert.Equal(t, map[string]string{"host": "web-01", "machine_id": "abc-123", "os": "linux", "kernel": "6.8.0"}, got.Labels)
+	require.NotNil(t, got.Cpu)
+	assert.Equal(t, 2, got.Cpu.NumberOfCores)
+	assert.Equal(t, uint64(50), got.Disks["sda"].Used)
+	require.NotNil(t, got.Memory)
+	require.NotNil(t, got.Host)
+	assert.Equal(t, 3, got.Host.Users)
+	require.NotNil(t, got.Sched)
+	assert.Equal(t, got.Cpu.TimeInterval, got.Sched.TimeInterval)
+	require.NotNil(t, got.Sensors)
+	assert.True(t, got.Sensors.NoSensors())
+	require.NotNil(t, got.Netstat)
+	assert.Equal(t, "port", got.Netstat.Groups[0].Key)
+	require.NotNil(t, got.Vmstat)
+	assert.Equal(t, uint64(1), got.Vmstat.OomKills)
+	require.NotNil(t, got.Process)
+	assert.Equal(t, process.GroupByUnit, got.Process.GroupBy)
+	assert.Len(t, got.Process.Groups, 2)
+	require.NotNil(t, got.Watch)
+	assert.Equal(t, []int32{1234}, got.Watch.Pids)
+	require.NotNil(t, got.Systemd)
+	assert.Equal(t, "nginx.service", got.Systemd.Units[0].Name)
+	assert.NotZero(t, got.TimeStamp)
+}
+
+func TestCollect_PartialErrors(t *testing.T) {
+	t.Parallel()
+	got, err := mockCollector([]string{"cpu", "disk", "bogus"}, []string{"sda", "missing"}).Collect()
+	assert.NotNil(t, err)
+	assert.ErrorContains(t, err, "missing")
+	assert.ErrorContains(t, err, "bogus")
+	assert.NotNil(t, got.Cpu)
+	assert.Len(t, got.Disks, 1)
+	assert.Nil(t, got.Memory)
+}
+
+func TestCollect_Duplicates(t *testing.T) {
+	t.Parallel()
+	c := mockCollector([]string{"cpu", "disk", "cpu", "disk"}, []string{"sda", "sdb", "sda"})
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	c.measureDisk = func(name string, interval float64) (disk.DiskMetric, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls[name]++
+		return disk.DiskMetric{}, nil
+	}
+	got, err := c.Collect()
+	require.Nil(t, err)
+	assert.Equal(t, map[string]int{"sda": 1, "sdb": 1}, calls)
+	assert.Len(t, got.Disks, 2)
+}
+
+func TestCollect_DisksAtOnce(t *testing.T) {
+	t.Parallel()
+	c := mockCollector([]string{"disk"}, []string{"sda", "sdb", "sdc"})
+	c.measureDisk = func(name string, interval float64) (disk.DiskMetric, error) {
+		time.Sleep(100 * time.Millisecond)
+		return disk.DiskMetric{}, nil
+	}
+	start := time.Now()
+	got, err := c.Collect()
+	require.Nil(t, err)
+	assert.Len(t, got.Disks, 3)
+	assert.Less(t, time.Since(start), 250*time.Millisecond)
+}
+
+func TestCollect_Partial(t *testing.T) {
+	t.Parallel()
+	c := mockCollector([]string{"cpu", "disk"}, []string{"sda", "tmpfs"})
+	c.measureCpu = func(seconds float64) (cpu.CpuMetric, error) {
+		return cpu.CpuMetric{Usage: []float64{10}, NumberOfCores: 1}, fmt.Errorf("%w: mock load error", metrics.ErrPartial)
+	}
+	c.measureDisk = func(name string, interval float64) (disk.DiskMetric, error) {
+		dm := disk.DiskMetric{DiskUsage: disk.DiskUsage{Total: 100}}
+		if name == "tmpfs" {
+			return dm, fmt.Errorf("%w: %w", metrics.ErrPartial, metrics.ErrDeviceNotFound)
+		}
+		return dm, nil
+	}
+	got, err := c.Collect()
+	assert.ErrorIs(t, err, metrics.ErrPartial)
+	assert.ErrorIs(t, err, metrics.ErrDeviceNotFound)
+	assert.ErrorContains(t, err, "mock load error")
+	require.NotNil(t, got.Cpu)
+	assert.Equal(t, []float64{10.0}, got.Cpu.Usage)
+	assert.Len(t, got.Disks, 2)
+}
+
+func TestCollect_Agent(t *testing.T) {
+	t.Parallel()
+	c := mockCollector([]string{"cpu", "disk", "agent"}, []string{"missing"})
+	_, err := c.Collect()
+	require.NotNil(t, err)
+	got, err := c.Collect()
+	require.NotNil(t, err)
+	require.NotNil(t, got.Agent)
+	assert.Equal(t, uint64(4096), got.Agent.RSS)
+	assert.NotZero(t, got.Agent.Goroutines)
+	// The mock has used no CPU since the first snapshot.
+	assert.Zero(t, got.Agent.CPU)
+	require.Len(t, got.Agent.Collectors, 2)
+	assert.Equal(t, CollectorStats{Metric: "cpu", Duration: got.Agent.Collectors[0].Duration, Successes: 2}, got.Agent.Collectors[0])
+	assert.Equal(t, "disk", got.Agent.Collectors[1].Metric)
+	assert.Equal(t, uint64(2), got.Agent.Collectors[1].Errors)
+	assert.Contains(t, got.Agent.Collectors[1].LastError, "mock disk error")
+	assert.Contains(t, got.String(), "Collector disk: 0 successes, 2 errors")
+}
+
+func TestCollect_AgentCPU(t *testing.T) {
+	t.Parallel()
+	c := mockCollector([]string{"agent"}, nil)
+	got, err := c.Collect()
+	require.Nil(t, err)
+	require.NotNil(t, got.Agent)
+	// 1 CPU second over the 10 seconds since the mock started.
+	assert.InDelta(t, 10, got.Agent.CPU, 0.1)
+	assert.Empty(t, got.Agent.Collectors)
+
+	c.measureUsage = func(int32) (process.Usage, error) {
+		return process.Usage{}, errors.New("mock usage error")
+	}
+	got, err = c.Collect()
+	assert.ErrorContains(t, err, "mock usage error")
+	assert.Nil(t, got.Agent)
+}
+
+func TestString(t *testing.T) {
+	t.Parallel()
+	got, err := mockCollector([]string{"cpu", "memory"}, nil).Collect()
+	require.Nil(t, err)
+	s := got.String()
+	assert.Contains(t, s, "Labels: host=web-01 kernel=6.8.0 machine_id=abc-123 os=linux")
+	assert.Contains(t, s, "CPU Metrics: ")
+	assert.Contains(t, s, "Memory Metrics: ")
+	assert.NotContains(t, s, "Host Metrics: ")
+	assert.NotContains(t, s, "Anomaly: ")
+
+	got.Anomalies = []Anomaly{{Measurement: "cpu", Field: "usage", Tags: map[string]string{"core": "1"}, Value: 95, Mean: 20, Stddev: 5, Score: 15}}
+	assert.Contains(t, got.String(), "Anomaly: cpu.usage{core=1} is 95.00, +15.0 sigma from its baseline of 20.00±5.00\n")
+}